@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"readability-backend/analysis"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Limits on the size of a validation submission
+const (
+	maxValidationTargets = 50
+	maxValidationSamples = 5000 // Per target
+)
+
+// clientAccuracyPassPercent is the percentage at or above which a
+// measurement reported to POST /api/accuracy passes, as in the frontend's
+// original check
+const clientAccuracyPassPercent = 70
+
+// validationSettings configures server-side accuracy computation
+type validationSettings struct {
+	MaxErrorDeg       float64 `yaml:"max_error_deg"`       // Mean error (degrees) at or below which a validation passes
+	ViewingDistanceCM float64 `yaml:"viewing_distance_cm"` // Assumed when the frontend does not measure it
+	PixelsPerCM       float64 `yaml:"pixels_per_cm"`       // Assumed when the frontend does not measure it (96 dpi)
+}
+
+// validationConfig is set from the configuration at startup (see config.go)
+var validationConfig = defaultConfig().Validation
+
+// validationRequest is the body of POST /api/sessions/:uid/validation
+type validationRequest struct {
+	ScreenWidth       int      `json:"screen_width"` // Defaults to the session's screen size
+	ScreenHeight      int      `json:"screen_height"`
+	PixelsPerCM       *float64 `json:"pixels_per_cm"`       // Measured on the participant's screen, if known
+	ViewingDistanceCM *float64 `json:"viewing_distance_cm"` // Measured for the participant, if known
+	Targets           []struct {
+		X       float64 `json:"x"`
+		Y       float64 `json:"y"`
+		Samples []struct {
+			X         float64   `json:"x"`
+			Y         float64   `json:"y"`
+			Timestamp time.Time `json:"timestamp"`
+		} `json:"samples"`
+	} `json:"targets"`
+}
+
+// computeAccuracy computes a server-side validation from its targets and
+// samples and fills in the measurement. It returns the per-target rows.
+func computeAccuracy(m *AccuracyMeasurement, targets []analysis.ValidationTarget, threshold float64) ([]AccuracyTarget, error) {
+	geometry := analysis.Geometry{
+		ScreenWidth:       float64(m.ScreenWidth),
+		ScreenHeight:      float64(m.ScreenHeight),
+		PixelsPerCM:       m.PixelsPerCM,
+		ViewingDistanceCM: m.ViewingDistanceCM,
+	}
+	result, err := analysis.ComputeAccuracy(targets, geometry)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Method = "server"
+	m.Accuracy = math.Round(result.LegacyScore*10) / 10
+	m.Duration = int(result.Duration.Milliseconds())
+	m.SampleCount = result.SampleCount
+	m.MeanErrorPX = &result.MeanErrorPX
+	m.MeanErrorDeg = &result.MeanErrorDeg
+	m.PrecisionRMSPX = &result.PrecisionRMSPX
+	m.PrecisionRMSDeg = &result.PrecisionRMSDeg
+	m.ThresholdDeg = &threshold
+	m.Passed = result.MeanErrorDeg <= threshold
+
+	rows := make([]AccuracyTarget, len(result.Targets))
+	for i, t := range result.Targets {
+		rows[i] = AccuracyTarget{
+			MeasurementID:   m.ID,
+			SessionID:       m.SessionID,
+			Index:           t.Index,
+			X:               t.X,
+			Y:               t.Y,
+			SampleCount:     t.SampleCount,
+			MeanErrorPX:     t.MeanErrorPX,
+			MeanErrorDeg:    t.MeanErrorDeg,
+			BiasX:           t.BiasX,
+			BiasY:           t.BiasY,
+			PrecisionRMSPX:  t.PrecisionRMSPX,
+			PrecisionRMSDeg: t.PrecisionRMSDeg,
+		}
+	}
+	return rows, nil
+}
+
+// handleSessionValidation computes calibration accuracy from the raw
+// validation samples the frontend recorded and stores the full breakdown
+func handleSessionValidation(c *gin.Context) {
+	db := dbFrom(c)
+	var session StudySession
+	if !findSessionByUID(c, &session) {
+		return
+	}
+	if isFinalSessionStatus(session.Status) {
+		c.JSON(409, gin.H{"error": "Session is already " + session.Status})
+		return
+	}
+	if !requireConsent(c, session) {
+		return
+	}
+
+	var req validationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if len(req.Targets) > maxValidationTargets {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("At most %d targets are allowed", maxValidationTargets)})
+		return
+	}
+
+	measurement := AccuracyMeasurement{
+		SessionID:         session.ID,
+		Timestamp:         time.Now(),
+		ScreenWidth:       req.ScreenWidth,
+		ScreenHeight:      req.ScreenHeight,
+		PixelsPerCM:       validationConfig.PixelsPerCM,
+		ViewingDistanceCM: validationConfig.ViewingDistanceCM,
+	}
+	if measurement.ScreenWidth == 0 || measurement.ScreenHeight == 0 {
+		measurement.ScreenWidth, measurement.ScreenHeight = session.ScreenWidth, session.ScreenHeight
+	}
+	if req.PixelsPerCM != nil {
+		measurement.PixelsPerCM = *req.PixelsPerCM
+	}
+	if req.ViewingDistanceCM != nil {
+		measurement.ViewingDistanceCM = *req.ViewingDistanceCM
+	}
+
+	var targets []analysis.ValidationTarget
+	var samples []ValidationSample
+	for i, t := range req.Targets {
+		if len(t.Samples) > maxValidationSamples {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Target %d has more than %d samples", i, maxValidationSamples)})
+			return
+		}
+		target := analysis.ValidationTarget{X: t.X, Y: t.Y}
+		for _, s := range t.Samples {
+			if math.IsNaN(s.X) || math.IsNaN(s.Y) || math.IsInf(s.X, 0) || math.IsInf(s.Y, 0) {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("Target %d has a sample with invalid coordinates", i)})
+				return
+			}
+			target.Samples = append(target.Samples, analysis.Sample{X: s.X, Y: s.Y, Time: s.Timestamp})
+			samples = append(samples, ValidationSample{TargetIndex: i, X: s.X, Y: s.Y, Timestamp: s.Timestamp})
+		}
+		targets = append(targets, target)
+	}
+
+	rows, err := computeAccuracy(&measurement, targets, validationConfig.MaxErrorDeg)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Session", "Targets").Create(&measurement).Error; err != nil {
+			return err
+		}
+		for i := range rows {
+			rows[i].MeasurementID = measurement.ID
+		}
+		if err := tx.Create(&rows).Error; err != nil {
+			return err
+		}
+		for i := range samples {
+			samples[i].MeasurementID = measurement.ID
+		}
+		return tx.CreateInBatches(&samples, gazeInsertBatchSize).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to save accuracy measurement: " + err.Error()})
+		return
+	}
+	measurement.Targets = rows
+
+	c.JSON(201, gin.H{
+		"success": true,
+		"id":      measurement.ID,
+		"passed":  measurement.Passed,
+		"data":    measurement,
+	})
+}
+
+// handleAdminSessionAccuracy lists a session's accuracy measurements with
+// their per-target breakdown
+func handleAdminSessionAccuracy(c *gin.Context) {
+	db := dbFrom(c)
+	var session StudySession
+	if !findSession(c, &session) {
+		return
+	}
+
+	var measurements []AccuracyMeasurement
+	err := db.Preload("Targets", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("\"index\" ASC")
+	}).Where("session_id = ?", session.ID).Order("timestamp ASC, id ASC").Find(&measurements).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch accuracy measurements: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    measurements,
+	})
+}
+
+// recomputeAccuracy recomputes a server-side measurement from its stored
+// samples with the given pass threshold
+func recomputeAccuracy(db *gorm.DB, m AccuracyMeasurement, threshold float64) error {
+	var stored []AccuracyTarget
+	if err := db.Where("measurement_id = ?", m.ID).Order("\"index\" ASC").Find(&stored).Error; err != nil {
+		return err
+	}
+	var samples []ValidationSample
+	if err := db.Where("measurement_id = ?", m.ID).Order("target_index ASC, id ASC").Find(&samples).Error; err != nil {
+		return err
+	}
+
+	targets := make([]analysis.ValidationTarget, len(stored))
+	for i, t := range stored {
+		targets[i] = analysis.ValidationTarget{X: t.X, Y: t.Y}
+	}
+	for _, s := range samples {
+		if s.TargetIndex >= 0 && s.TargetIndex < len(targets) {
+			targets[s.TargetIndex].Samples = append(targets[s.TargetIndex].Samples, analysis.Sample{X: s.X, Y: s.Y, Time: s.Timestamp})
+		}
+	}
+
+	rows, err := computeAccuracy(&m, targets, threshold)
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Session", "Targets").Save(&m).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("measurement_id = ?", m.ID).Delete(&AccuracyTarget{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+// handleAdminRecomputeAccuracy recomputes every server-side measurement
+// from its stored samples, e.g. after changing the pass threshold. A
+// max_error_deg in the body overrides the configured threshold.
+func handleAdminRecomputeAccuracy(c *gin.Context) {
+	db := dbFrom(c)
+	var req struct {
+		MaxErrorDeg *float64 `json:"max_error_deg"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+			return
+		}
+	}
+	threshold := validationConfig.MaxErrorDeg
+	if req.MaxErrorDeg != nil {
+		if *req.MaxErrorDeg <= 0 {
+			c.JSON(400, gin.H{"error": "max_error_deg must be positive"})
+			return
+		}
+		threshold = *req.MaxErrorDeg
+	}
+
+	var measurements []AccuracyMeasurement
+	if err := db.Where("method = ?", "server").Order("id ASC").Find(&measurements).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch accuracy measurements: " + err.Error()})
+		return
+	}
+
+	// A measurement that cannot be recomputed (e.g. its samples were lost)
+	// keeps its stored result and is reported instead of stopping the rest
+	type skippedMeasurement struct {
+		ID        uint   `json:"id"`
+		SessionID uint   `json:"session_id"`
+		Error     string `json:"error"`
+	}
+	passed := 0
+	skipped := []skippedMeasurement{}
+	for _, m := range measurements {
+		if err := recomputeAccuracy(db, m, threshold); err != nil {
+			skipped = append(skipped, skippedMeasurement{ID: m.ID, SessionID: m.SessionID, Error: err.Error()})
+			continue
+		}
+		var updated AccuracyMeasurement
+		if err := db.Select("passed").First(&updated, m.ID).Error; err == nil && updated.Passed {
+			passed++
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"success":       true,
+		"measurements":  len(measurements) - len(skipped),
+		"passed":        passed,
+		"skipped":       skipped,
+		"max_error_deg": threshold,
+		"message":       "Accuracy recomputed successfully",
+	})
+}
@@ -1,9 +1,12 @@
 #!/bin/bash
 
 # Simple terminal-based admin interface for Readability Study
-# Usage: ./admin-cli.sh
+# Usage: ADMIN_TOKEN=<token> ./admin-cli.sh
+#
+# Create a token with: go run . token create --name <name> --role editor
 
 API_URL="${API_URL:-http://localhost:8080}"
+ADMIN_TOKEN="${ADMIN_TOKEN:-}"
 
 # Colors
 RED='\033[0;31m'
@@ -33,7 +36,9 @@ show_info() {
 
 # API functions
 api_get() {
-    local response=$(curl -s -w "\n%{http_code}" "$API_URL$1")
+    local response=$(curl -s -w "\n%{http_code}" \
+        -H "Authorization: Bearer $ADMIN_TOKEN" \
+        "$API_URL$1")
     local http_code=$(echo "$response" | tail -n1)
     local body=$(echo "$response" | sed '$d')
     
@@ -49,6 +54,7 @@ api_get() {
 
 api_post() {
     local response=$(curl -s -w "\n%{http_code}" -X POST "$API_URL$1" \
+        -H "Authorization: Bearer $ADMIN_TOKEN" \
         -H "Content-Type: application/json" \
         -d "$2")
     local http_code=$(echo "$response" | tail -n1)
@@ -66,6 +72,7 @@ api_post() {
 
 api_put() {
     local response=$(curl -s -w "\n%{http_code}" -X PUT "$API_URL$1" \
+        -H "Authorization: Bearer $ADMIN_TOKEN" \
         -H "Content-Type: application/json" \
         -d "$2")
     local http_code=$(echo "$response" | tail -n1)
@@ -82,7 +89,9 @@ api_put() {
 }
 
 api_delete() {
-    local response=$(curl -s -w "\n%{http_code}" -X DELETE "$API_URL$1")
+    local response=$(curl -s -w "\n%{http_code}" -X DELETE \
+        -H "Authorization: Bearer $ADMIN_TOKEN" \
+        "$API_URL$1")
     local http_code=$(echo "$response" | tail -n1)
     local body=$(echo "$response" | sed '$d')
     
@@ -623,6 +632,13 @@ if ! command -v curl &> /dev/null; then
     exit 1
 fi
 
+if [[ -z "$ADMIN_TOKEN" ]]; then
+    show_error "ADMIN_TOKEN is not set."
+    echo "Create a token with: go run . token create --name <name> --role editor"
+    echo "Then run: ADMIN_TOKEN=<token> ./admin-cli.sh"
+    exit 1
+fi
+
 # Check dependencies and connection before starting
 if ! check_api_connection; then
     echo ""
@@ -0,0 +1,165 @@
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Geometry describes the screen and viewing position needed to convert
+// pixel errors to visual angle
+type Geometry struct {
+	ScreenWidth       float64 // px
+	ScreenHeight      float64 // px
+	PixelsPerCM       float64
+	ViewingDistanceCM float64 // Eye to screen; the eye is assumed level with the screen centre
+}
+
+// Validate reports whether the geometry can be used to compute accuracy
+func (g Geometry) Validate() error {
+	if g.ScreenWidth <= 0 || g.ScreenHeight <= 0 {
+		return errors.New("screen width and height must be positive")
+	}
+	if g.PixelsPerCM <= 0 {
+		return errors.New("pixels_per_cm must be positive")
+	}
+	if g.ViewingDistanceCM <= 0 {
+		return errors.New("viewing_distance_cm must be positive")
+	}
+	return nil
+}
+
+// angle returns the visual angle in degrees between two screen positions
+func (g Geometry) angle(x1, y1, x2, y2 float64) float64 {
+	cx, cy := g.ScreenWidth/2, g.ScreenHeight/2
+	ax, ay := (x1-cx)/g.PixelsPerCM, (y1-cy)/g.PixelsPerCM
+	bx, by := (x2-cx)/g.PixelsPerCM, (y2-cy)/g.PixelsPerCM
+	d := g.ViewingDistanceCM
+
+	// atan2 of the cross and dot products stays accurate for the small
+	// angles between successive samples, where acos of the cosine does not
+	dot := ax*bx + ay*by + d*d
+	crossX, crossY, crossZ := ay*d-d*by, d*bx-ax*d, ax*by-ay*bx
+	cross := math.Sqrt(crossX*crossX + crossY*crossY + crossZ*crossZ)
+	return math.Atan2(cross, dot) * 180 / math.Pi
+}
+
+// ValidationTarget is a point the participant looked at during validation
+// and the gaze samples predicted while they did, in temporal order
+type ValidationTarget struct {
+	X, Y    float64
+	Samples []Sample
+}
+
+// TargetAccuracy is the error measured at one validation target
+type TargetAccuracy struct {
+	Index           int
+	X, Y            float64
+	SampleCount     int
+	MeanErrorPX     float64 // Mean distance from the target
+	MeanErrorDeg    float64 // Mean visual angle from the target
+	BiasX, BiasY    float64 // Mean offset of the samples from the target (px)
+	PrecisionRMSPX  float64 // RMS of distances between successive samples
+	PrecisionRMSDeg float64
+	LegacyScore     float64 // Percentage score as computed by the original frontend check
+}
+
+// Accuracy summarizes a validation over all targets. Accuracy is the mean
+// of the per-target errors, so every target counts equally however many
+// samples it has; precision pools successive-sample distances over targets.
+type Accuracy struct {
+	Targets         []TargetAccuracy
+	SampleCount     int
+	MeanErrorPX     float64
+	MeanErrorDeg    float64
+	PrecisionRMSPX  float64
+	PrecisionRMSDeg float64
+	LegacyScore     float64
+	Duration        time.Duration // From the first to the last sample
+}
+
+// ComputeAccuracy computes accuracy and precision from validation samples.
+// Every target needs at least one sample.
+func ComputeAccuracy(targets []ValidationTarget, g Geometry) (Accuracy, error) {
+	if err := g.Validate(); err != nil {
+		return Accuracy{}, err
+	}
+	if len(targets) == 0 {
+		return Accuracy{}, errors.New("at least one validation target is required")
+	}
+
+	var result Accuracy
+	var s2sPX, s2sDeg float64
+	s2sCount := 0
+	var first, last time.Time
+	halfHeight := g.ScreenHeight / 2
+
+	for i, t := range targets {
+		if len(t.Samples) == 0 {
+			return Accuracy{}, fmt.Errorf("target %d has no samples", i)
+		}
+
+		ta := TargetAccuracy{Index: i, X: t.X, Y: t.Y, SampleCount: len(t.Samples)}
+		var sumSqPX, sumSqDeg float64
+		for j, s := range t.Samples {
+			dist := math.Hypot(s.X-t.X, s.Y-t.Y)
+			ta.MeanErrorPX += dist
+			ta.MeanErrorDeg += g.angle(s.X, s.Y, t.X, t.Y)
+			ta.BiasX += s.X - t.X
+			ta.BiasY += s.Y - t.Y
+			if dist <= halfHeight {
+				ta.LegacyScore += 100 - dist/halfHeight*100
+			}
+
+			if j > 0 {
+				prev := t.Samples[j-1]
+				sumSqPX += math.Pow(math.Hypot(s.X-prev.X, s.Y-prev.Y), 2)
+				sumSqDeg += math.Pow(g.angle(s.X, s.Y, prev.X, prev.Y), 2)
+			}
+
+			if !s.Time.IsZero() {
+				if first.IsZero() || s.Time.Before(first) {
+					first = s.Time
+				}
+				if s.Time.After(last) {
+					last = s.Time
+				}
+			}
+		}
+
+		n := float64(len(t.Samples))
+		ta.MeanErrorPX /= n
+		ta.MeanErrorDeg /= n
+		ta.BiasX /= n
+		ta.BiasY /= n
+		ta.LegacyScore /= n
+		if len(t.Samples) > 1 {
+			pairs := float64(len(t.Samples) - 1)
+			ta.PrecisionRMSPX = math.Sqrt(sumSqPX / pairs)
+			ta.PrecisionRMSDeg = math.Sqrt(sumSqDeg / pairs)
+		}
+		s2sPX += sumSqPX
+		s2sDeg += sumSqDeg
+		s2sCount += len(t.Samples) - 1
+
+		result.Targets = append(result.Targets, ta)
+		result.SampleCount += len(t.Samples)
+		result.MeanErrorPX += ta.MeanErrorPX
+		result.MeanErrorDeg += ta.MeanErrorDeg
+		result.LegacyScore += ta.LegacyScore
+	}
+
+	n := float64(len(targets))
+	result.MeanErrorPX /= n
+	result.MeanErrorDeg /= n
+	result.LegacyScore /= n
+	if s2sCount > 0 {
+		result.PrecisionRMSPX = math.Sqrt(s2sPX / float64(s2sCount))
+		result.PrecisionRMSDeg = math.Sqrt(s2sDeg / float64(s2sCount))
+	}
+	if !first.IsZero() {
+		result.Duration = last.Sub(first)
+	}
+	return result, nil
+}
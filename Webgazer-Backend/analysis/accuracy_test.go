@@ -0,0 +1,109 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// 1000x800 screen at 10 px/cm viewed from 60 cm
+var testGeometry = Geometry{ScreenWidth: 1000, ScreenHeight: 800, PixelsPerCM: 10, ViewingDistanceCM: 60}
+
+func TestGeometryAngle(t *testing.T) {
+	deg := math.Pi / 180
+	tests := []struct {
+		name           string
+		x1, y1, x2, y2 float64
+		want           float64
+	}{
+		{"same point", 300, 200, 300, 200, 0},
+		// 60 cm off-centre at 60 cm is atan(1)
+		{"45 degrees", 500, 400, 1100, 400, 45},
+		{"1 degree from centre", 500, 400, 500 + 600*math.Tan(deg), 400, 1},
+		{"1 degree vertically", 500, 400, 500, 400 - 600*math.Tan(deg), 1},
+		// Symmetric about the centre: 2*atan(5/60)
+		{"across the centre", 450, 400, 550, 400, 2 * math.Atan(5.0/60) / deg},
+		// Off-axis, the same pixel distance subtends less: atan(20/60) - atan(10/60)
+		{"off-axis", 600, 400, 700, 400, (math.Atan(20.0/60) - math.Atan(10.0/60)) / deg},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testGeometry.angle(tt.x1, tt.y1, tt.x2, tt.y2); !near(got, tt.want, 1e-9) {
+				t.Errorf("angle = %.12g, want %.12g", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeAccuracy(t *testing.T) {
+	at := func(ms int, x, y float64) Sample {
+		return Sample{X: x, Y: y, Time: t0.Add(time.Duration(ms) * time.Millisecond)}
+	}
+	targets := []ValidationTarget{
+		// 10 px either side of the centre: no bias, 20 px between samples
+		{X: 500, Y: 400, Samples: []Sample{at(0, 510, 400), at(100, 490, 400)}},
+		// Consistently 30 px right and 40 px below
+		{X: 200, Y: 200, Samples: []Sample{at(1000, 230, 240), at(1100, 230, 240), at(1200, 230, 240)}},
+	}
+
+	got, err := ComputeAccuracy(targets, testGeometry)
+	if err != nil {
+		t.Fatalf("ComputeAccuracy: %v", err)
+	}
+
+	deg := math.Pi / 180
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"target 0 error px", got.Targets[0].MeanErrorPX, 10},
+		{"target 0 error deg", got.Targets[0].MeanErrorDeg, math.Atan(1.0/60) / deg},
+		{"target 0 bias x", got.Targets[0].BiasX, 0},
+		{"target 0 precision px", got.Targets[0].PrecisionRMSPX, 20},
+		{"target 0 legacy score", got.Targets[0].LegacyScore, 100 - 10.0/400*100},
+		{"target 1 error px", got.Targets[1].MeanErrorPX, 50},
+		{"target 1 bias x", got.Targets[1].BiasX, 30},
+		{"target 1 bias y", got.Targets[1].BiasY, 40},
+		{"target 1 precision px", got.Targets[1].PrecisionRMSPX, 0},
+		{"target 1 legacy score", got.Targets[1].LegacyScore, 100 - 50.0/400*100},
+		// Targets count equally, whatever their number of samples
+		{"mean error px", got.MeanErrorPX, 30},
+		{"mean error deg", got.MeanErrorDeg, (got.Targets[0].MeanErrorDeg + got.Targets[1].MeanErrorDeg) / 2},
+		// Successive-sample distances are pooled: sqrt((20² + 0 + 0) / 3)
+		{"precision px", got.PrecisionRMSPX, 20 / math.Sqrt(3)},
+		{"legacy score", got.LegacyScore, (97.5 + 87.5) / 2},
+	}
+	for _, tt := range tests {
+		if !near(tt.got, tt.want, 1e-9) {
+			t.Errorf("%s = %.12g, want %.12g", tt.name, tt.got, tt.want)
+		}
+	}
+	if got.SampleCount != 5 {
+		t.Errorf("sample count = %d, want 5", got.SampleCount)
+	}
+	if got.Duration != 1200*time.Millisecond {
+		t.Errorf("duration = %v, want 1.2s", got.Duration)
+	}
+}
+
+func TestComputeAccuracyErrors(t *testing.T) {
+	target := []ValidationTarget{{X: 500, Y: 400, Samples: []Sample{{X: 500, Y: 400}}}}
+	tests := []struct {
+		name     string
+		targets  []ValidationTarget
+		geometry Geometry
+	}{
+		{"no targets", nil, testGeometry},
+		{"target without samples", []ValidationTarget{target[0], {X: 100, Y: 100}}, testGeometry},
+		{"no screen size", target, Geometry{PixelsPerCM: 10, ViewingDistanceCM: 60}},
+		{"no pixel density", target, Geometry{ScreenWidth: 1000, ScreenHeight: 800, ViewingDistanceCM: 60}},
+		{"no viewing distance", target, Geometry{ScreenWidth: 1000, ScreenHeight: 800, PixelsPerCM: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ComputeAccuracy(tt.targets, tt.geometry); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+// Package analysis contains eye-movement analysis algorithms that operate on
+// plain gaze samples, independent of how they are stored.
+package analysis
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Fixation detection algorithms
+const (
+	AlgorithmIVT = "ivt" // Velocity-threshold identification
+	AlgorithmIDT = "idt" // Dispersion-threshold identification
+)
+
+// Sample is a single gaze sample in screen pixels
+type Sample struct {
+	X     float64
+	Y     float64
+	Time  time.Time
+	Panel string
+	Phase string
+
+	// Segment groups samples that may belong to the same fixation. Samples
+	// in different segments (e.g. different panels) are never merged.
+	Segment string
+}
+
+// Params configures fixation detection
+type Params struct {
+	Algorithm           string        // AlgorithmIVT or AlgorithmIDT
+	VelocityThreshold   float64       // I-VT: maximum fixation velocity in px/s
+	DispersionThreshold float64       // I-DT: maximum (max x - min x) + (max y - min y) in px
+	MinDuration         time.Duration // Shorter candidate fixations are discarded
+	MaxGap              time.Duration // Gaps between samples longer than this end a fixation (track loss)
+}
+
+// DefaultParams returns thresholds suited to webcam eye tracking at
+// roughly 10-30 Hz. I-DT is the default because point-to-point velocities
+// are unreliable at such low, noisy sampling rates.
+func DefaultParams() Params {
+	return Params{
+		Algorithm:           AlgorithmIDT,
+		VelocityThreshold:   1000,
+		DispersionThreshold: 100,
+		MinDuration:         100 * time.Millisecond,
+		MaxGap:              250 * time.Millisecond,
+	}
+}
+
+// Validate reports whether the parameters can be used for detection
+func (p Params) Validate() error {
+	switch p.Algorithm {
+	case AlgorithmIVT:
+		if p.VelocityThreshold <= 0 {
+			return fmt.Errorf("velocity_threshold must be positive")
+		}
+	case AlgorithmIDT:
+		if p.DispersionThreshold <= 0 {
+			return fmt.Errorf("dispersion_threshold must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown algorithm %q (expected %q or %q)", p.Algorithm, AlgorithmIVT, AlgorithmIDT)
+	}
+	if p.MinDuration < 0 {
+		return fmt.Errorf("min_duration must not be negative")
+	}
+	if p.MaxGap <= 0 {
+		return fmt.Errorf("max_gap must be positive")
+	}
+	return nil
+}
+
+// Fixation is a period where gaze stayed within a small region
+type Fixation struct {
+	Index       int
+	Start       time.Time
+	End         time.Time
+	Duration    time.Duration
+	X           float64 // Centroid
+	Y           float64 // Centroid
+	Dispersion  float64
+	SampleCount int
+	Panel       string
+	Phase       string
+	Segment     string
+	FirstSample int // Index of the first sample in the input slice
+	LastSample  int // Index of the last sample in the input slice
+}
+
+// Saccade is the movement between two consecutive fixations in a segment.
+// No saccade is recorded across a tracking gap, since the eyes may have
+// moved anywhere while the tracker lost them.
+type Saccade struct {
+	Index        int
+	FromFixation int
+	ToFixation   int
+	Start        time.Time
+	End          time.Time
+	Duration     time.Duration
+	StartX       float64
+	StartY       float64
+	EndX         float64
+	EndY         float64
+	Amplitude    float64 // Distance between fixation centroids in px
+	PeakVelocity float64 // px/s
+	Panel        string
+}
+
+// Detect identifies fixations and the saccades between them. Samples must
+// be sorted by time.
+func Detect(samples []Sample, p Params) ([]Fixation, []Saccade, error) {
+	if err := p.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	var fixations []Fixation
+	for _, run := range splitRuns(samples, p.MaxGap) {
+		switch p.Algorithm {
+		case AlgorithmIVT:
+			fixations = append(fixations, detectIVT(samples, run, p)...)
+		case AlgorithmIDT:
+			fixations = append(fixations, detectIDT(samples, run, p)...)
+		}
+	}
+
+	for i := range fixations {
+		fixations[i].Index = i
+	}
+	return fixations, saccadesBetween(samples, fixations, p.MaxGap), nil
+}
+
+// run is a half-open range of sample indices without segment changes or
+// tracking gaps
+type run struct{ start, end int }
+
+func splitRuns(samples []Sample, maxGap time.Duration) []run {
+	var runs []run
+	start := 0
+	for i := 1; i <= len(samples); i++ {
+		if i == len(samples) ||
+			samples[i].Segment != samples[i-1].Segment ||
+			samples[i].Time.Sub(samples[i-1].Time) > maxGap {
+			if i > start {
+				runs = append(runs, run{start, i})
+			}
+			start = i
+		}
+	}
+	return runs
+}
+
+// velocity returns the point-to-point velocity of sample i in px/s
+func velocity(samples []Sample, i int) float64 {
+	if i == 0 {
+		return 0
+	}
+	dt := samples[i].Time.Sub(samples[i-1].Time).Seconds()
+	if dt <= 0 {
+		return 0
+	}
+	return math.Hypot(samples[i].X-samples[i-1].X, samples[i].Y-samples[i-1].Y) / dt
+}
+
+func detectIVT(samples []Sample, r run, p Params) []Fixation {
+	var fixations []Fixation
+	groupStart := -1
+	for i := r.start; i <= r.end; i++ {
+		if i < r.end && (i == r.start || velocity(samples, i) < p.VelocityThreshold) {
+			if groupStart < 0 {
+				groupStart = i
+			}
+			continue
+		}
+		if groupStart >= 0 {
+			if f, ok := newFixation(samples, groupStart, i-1, p.MinDuration); ok {
+				fixations = append(fixations, f)
+			}
+		}
+		// The sample after a fast movement is the first one at the new
+		// location, so it starts the next candidate fixation
+		groupStart = i
+	}
+	return fixations
+}
+
+func detectIDT(samples []Sample, r run, p Params) []Fixation {
+	var fixations []Fixation
+	i := r.start
+	for i < r.end {
+		// Grow the window until it spans the minimum duration
+		j := i
+		for j+1 < r.end && samples[j].Time.Sub(samples[i].Time) < p.MinDuration {
+			j++
+		}
+		if samples[j].Time.Sub(samples[i].Time) < p.MinDuration {
+			break
+		}
+		if dispersion(samples[i:j+1]) > p.DispersionThreshold {
+			i++
+			continue
+		}
+		// Extend while the window stays within the threshold
+		for j+1 < r.end && dispersion(samples[i:j+2]) <= p.DispersionThreshold {
+			j++
+		}
+		if f, ok := newFixation(samples, i, j, p.MinDuration); ok {
+			fixations = append(fixations, f)
+		}
+		i = j + 1
+	}
+	return fixations
+}
+
+func dispersion(samples []Sample) float64 {
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, s := range samples {
+		minX, maxX = math.Min(minX, s.X), math.Max(maxX, s.X)
+		minY, maxY = math.Min(minY, s.Y), math.Max(maxY, s.Y)
+	}
+	return (maxX - minX) + (maxY - minY)
+}
+
+// newFixation builds a fixation from samples[first..last], rejecting it if
+// it is shorter than minDuration
+func newFixation(samples []Sample, first, last int, minDuration time.Duration) (Fixation, bool) {
+	duration := samples[last].Time.Sub(samples[first].Time)
+	if duration < minDuration || last == first {
+		return Fixation{}, false
+	}
+
+	var sumX, sumY float64
+	for _, s := range samples[first : last+1] {
+		sumX += s.X
+		sumY += s.Y
+	}
+	n := float64(last - first + 1)
+	return Fixation{
+		Start:       samples[first].Time,
+		End:         samples[last].Time,
+		Duration:    duration,
+		X:           sumX / n,
+		Y:           sumY / n,
+		Dispersion:  dispersion(samples[first : last+1]),
+		SampleCount: last - first + 1,
+		Panel:       samples[first].Panel,
+		Phase:       samples[first].Phase,
+		Segment:     samples[first].Segment,
+		FirstSample: first,
+		LastSample:  last,
+	}, true
+}
+
+func saccadesBetween(samples []Sample, fixations []Fixation, maxGap time.Duration) []Saccade {
+	var saccades []Saccade
+	for i := 1; i < len(fixations); i++ {
+		from, to := fixations[i-1], fixations[i]
+		if from.Segment != to.Segment {
+			continue
+		}
+
+		peak := 0.0
+		trackLoss := false
+		for k := from.LastSample + 1; k <= to.FirstSample; k++ {
+			if samples[k].Time.Sub(samples[k-1].Time) > maxGap {
+				trackLoss = true
+				break
+			}
+			peak = math.Max(peak, velocity(samples, k))
+		}
+		if trackLoss {
+			continue
+		}
+
+		saccades = append(saccades, Saccade{
+			Index:        len(saccades),
+			FromFixation: from.Index,
+			ToFixation:   to.Index,
+			Start:        from.End,
+			End:          to.Start,
+			Duration:     to.Start.Sub(from.End),
+			StartX:       from.X,
+			StartY:       from.Y,
+			EndX:         to.X,
+			EndY:         to.Y,
+			Amplitude:    math.Hypot(to.X-from.X, to.Y-from.Y),
+			PeakVelocity: peak,
+			Panel:        to.Panel,
+		})
+	}
+	return saccades
+}
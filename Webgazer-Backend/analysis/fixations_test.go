@@ -0,0 +1,211 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func ms(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+// near reports whether got is within tol of want
+func near(got, want, tol float64) bool {
+	return math.Abs(got-want) <= tol
+}
+
+// still returns n samples at (x, y), one every 20ms (50 Hz) from start
+func still(start time.Duration, n int, x, y float64, segment string) []Sample {
+	samples := make([]Sample, n)
+	for i := range samples {
+		samples[i] = Sample{X: x, Y: y, Time: t0.Add(start + time.Duration(i)*20*time.Millisecond), Segment: segment}
+	}
+	return samples
+}
+
+func concat(parts ...[]Sample) []Sample {
+	var samples []Sample
+	for _, p := range parts {
+		samples = append(samples, p...)
+	}
+	return samples
+}
+
+func TestDetect(t *testing.T) {
+	ivt := DefaultParams()
+	ivt.Algorithm = AlgorithmIVT
+	idt := DefaultParams()
+
+	jitter := still(0, 10, 100, 100, "")
+	for i := range jitter {
+		if i%2 == 1 {
+			jitter[i].X += 20
+			jitter[i].Y -= 20
+		}
+	}
+
+	tests := []struct {
+		name      string
+		samples   []Sample
+		params    Params
+		fixations []Point // Expected centroids
+		durations []time.Duration
+		saccades  []float64 // Expected amplitudes
+	}{
+		{
+			name:      "idt two fixations",
+			samples:   concat(still(0, 10, 100, 100, ""), still(200*time.Millisecond, 10, 400, 100, "")),
+			params:    idt,
+			fixations: []Point{{100, 100}, {400, 100}},
+			durations: []time.Duration{180 * time.Millisecond, 180 * time.Millisecond},
+			saccades:  []float64{300},
+		},
+		{
+			name:      "ivt two fixations",
+			samples:   concat(still(0, 10, 100, 100, ""), still(200*time.Millisecond, 10, 400, 100, "")),
+			params:    ivt,
+			fixations: []Point{{100, 100}, {400, 100}},
+			durations: []time.Duration{180 * time.Millisecond, 180 * time.Millisecond},
+			saccades:  []float64{300},
+		},
+		{
+			name:      "idt jitter within dispersion threshold",
+			samples:   jitter,
+			params:    idt,
+			fixations: []Point{{110, 90}},
+			durations: []time.Duration{180 * time.Millisecond},
+		},
+		{
+			name:      "idt short fixation discarded",
+			samples:   concat(still(0, 4, 100, 100, ""), still(80*time.Millisecond, 10, 400, 100, "")),
+			params:    idt,
+			fixations: []Point{{400, 100}},
+			durations: []time.Duration{180 * time.Millisecond},
+		},
+		{
+			name:      "ivt short fixation discarded",
+			samples:   concat(still(0, 4, 100, 100, ""), still(80*time.Millisecond, 10, 400, 100, "")),
+			params:    ivt,
+			fixations: []Point{{400, 100}},
+			durations: []time.Duration{180 * time.Millisecond},
+		},
+		{
+			name:      "no saccade across track loss",
+			samples:   concat(still(0, 10, 100, 100, ""), still(time.Second, 10, 400, 100, "")),
+			params:    idt,
+			fixations: []Point{{100, 100}, {400, 100}},
+			durations: []time.Duration{180 * time.Millisecond, 180 * time.Millisecond},
+		},
+		{
+			name:      "track loss ends a fixation in place",
+			samples:   concat(still(0, 10, 100, 100, ""), still(time.Second, 10, 100, 100, "")),
+			params:    ivt,
+			fixations: []Point{{100, 100}, {100, 100}},
+			durations: []time.Duration{180 * time.Millisecond, 180 * time.Millisecond},
+		},
+		{
+			name:      "segments are never merged",
+			samples:   concat(still(0, 10, 100, 100, "A"), still(200*time.Millisecond, 10, 100, 100, "B")),
+			params:    idt,
+			fixations: []Point{{100, 100}, {100, 100}},
+			durations: []time.Duration{180 * time.Millisecond, 180 * time.Millisecond},
+		},
+		{
+			name:    "no samples",
+			samples: nil,
+			params:  idt,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixations, saccades, err := Detect(tt.samples, tt.params)
+			if err != nil {
+				t.Fatalf("Detect: %v", err)
+			}
+			if len(fixations) != len(tt.fixations) {
+				t.Fatalf("got %d fixations, want %d: %+v", len(fixations), len(tt.fixations), fixations)
+			}
+			for i, f := range fixations {
+				if f.Index != i {
+					t.Errorf("fixation %d has index %d", i, f.Index)
+				}
+				if !near(f.X, tt.fixations[i].X, 1e-9) || !near(f.Y, tt.fixations[i].Y, 1e-9) {
+					t.Errorf("fixation %d centroid = (%g, %g), want (%g, %g)", i, f.X, f.Y, tt.fixations[i].X, tt.fixations[i].Y)
+				}
+				if f.Duration != tt.durations[i] {
+					t.Errorf("fixation %d duration = %v, want %v", i, f.Duration, tt.durations[i])
+				}
+			}
+			if len(saccades) != len(tt.saccades) {
+				t.Fatalf("got %d saccades, want %d: %+v", len(saccades), len(tt.saccades), saccades)
+			}
+			for i, s := range saccades {
+				if !near(s.Amplitude, tt.saccades[i], 1e-9) {
+					t.Errorf("saccade %d amplitude = %g, want %g", i, s.Amplitude, tt.saccades[i])
+				}
+				if s.FromFixation != i || s.ToFixation != i+1 {
+					t.Errorf("saccade %d joins fixations %d and %d", i, s.FromFixation, s.ToFixation)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectSaccadeTiming(t *testing.T) {
+	samples := concat(still(0, 10, 100, 100, ""), still(200*time.Millisecond, 10, 400, 500, ""))
+	_, saccades, err := Detect(samples, DefaultParams())
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if len(saccades) != 1 {
+		t.Fatalf("got %d saccades, want 1", len(saccades))
+	}
+	s := saccades[0]
+	if s.Start != t0.Add(180*time.Millisecond) || s.End != t0.Add(200*time.Millisecond) {
+		t.Errorf("saccade runs from %v to %v", s.Start.Sub(t0), s.End.Sub(t0))
+	}
+	// 500 px in one 20ms sample interval
+	if !near(s.Amplitude, 500, 1e-9) || !near(s.PeakVelocity, 25000, 1e-6) {
+		t.Errorf("amplitude = %g, peak velocity = %g; want 500, 25000", s.Amplitude, s.PeakVelocity)
+	}
+}
+
+func TestParamsValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Params)
+		valid  bool
+	}{
+		{"defaults", func(p *Params) {}, true},
+		{"ivt", func(p *Params) { p.Algorithm = AlgorithmIVT }, true},
+		{"unknown algorithm", func(p *Params) { p.Algorithm = "hmm" }, false},
+		{"zero dispersion", func(p *Params) { p.DispersionThreshold = 0 }, false},
+		{"zero velocity", func(p *Params) { p.Algorithm = AlgorithmIVT; p.VelocityThreshold = 0 }, false},
+		{"negative min duration", func(p *Params) { p.MinDuration = -time.Millisecond }, false},
+		{"zero max gap", func(p *Params) { p.MaxGap = 0 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := DefaultParams()
+			tt.modify(&p)
+			if err := p.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestVelocity(t *testing.T) {
+	samples := []Sample{
+		{X: 0, Y: 0, Time: t0},
+		{X: 30, Y: 40, Time: t0.Add(100 * time.Millisecond)},
+		{X: 30, Y: 40, Time: t0.Add(100 * time.Millisecond)},
+	}
+	for i, want := range []float64{0, 500, 0} {
+		if got := velocity(samples, i); math.Abs(got-want) > 1e-9 {
+			t.Errorf("velocity(%d) = %g, want %g", i, got, want)
+		}
+	}
+}
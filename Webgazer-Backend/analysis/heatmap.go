@@ -0,0 +1,139 @@
+package analysis
+
+import "math"
+
+// Point is a gaze position in screen pixels
+type Point struct {
+	X, Y float64
+}
+
+// DensityGrid is a Gaussian kernel density estimate of gaze points over a
+// screen, sampled on a grid of Cell×Cell pixel cells
+type DensityGrid struct {
+	Width, Height int // Screen size in pixels
+	Cell          int // Cell size in pixels
+	Cols, Rows    int
+	Values        []float64 // Row-major, Cols×Rows
+	Max           float64   // Largest value in the grid
+}
+
+// Density estimates the density of points over a width×height screen with
+// a Gaussian kernel of standard deviation sigma pixels. The density is
+// computed on cells of about sigma/4 pixels, which is far below the kernel
+// resolution, and interpolated by At. Points off the screen are ignored.
+func Density(points []Point, width, height int, sigma float64) DensityGrid {
+	cell := int(sigma / 4)
+	if cell < 1 {
+		cell = 1
+	}
+	g := DensityGrid{
+		Width:  width,
+		Height: height,
+		Cell:   cell,
+		Cols:   (width + cell - 1) / cell,
+		Rows:   (height + cell - 1) / cell,
+	}
+	if g.Cols <= 0 || g.Rows <= 0 {
+		return g
+	}
+	g.Values = make([]float64, g.Cols*g.Rows)
+
+	for _, p := range points {
+		if p.X < 0 || p.Y < 0 || p.X >= float64(width) || p.Y >= float64(height) {
+			continue
+		}
+		col, row := int(p.X)/cell, int(p.Y)/cell
+		g.Values[row*g.Cols+col]++
+	}
+
+	// The Gaussian is separable: blur rows, then columns
+	kernel := gaussianKernel(sigma / float64(cell))
+	tmp := make([]float64, len(g.Values))
+	convolve(g.Values, tmp, g.Cols, g.Rows, 1, g.Cols, kernel)
+	convolve(tmp, g.Values, g.Rows, g.Cols, g.Cols, 1, kernel)
+
+	for _, v := range g.Values {
+		if v > g.Max {
+			g.Max = v
+		}
+	}
+	return g
+}
+
+// At returns the density at screen pixel (x, y), interpolated bilinearly
+// between cell centres
+func (g DensityGrid) At(x, y float64) float64 {
+	if len(g.Values) == 0 {
+		return 0
+	}
+	fx := x/float64(g.Cell) - 0.5
+	fy := y/float64(g.Cell) - 0.5
+	c0, r0 := int(math.Floor(fx)), int(math.Floor(fy))
+	tx, ty := fx-float64(c0), fy-float64(r0)
+
+	v00 := g.value(c0, r0)
+	v10 := g.value(c0+1, r0)
+	v01 := g.value(c0, r0+1)
+	v11 := g.value(c0+1, r0+1)
+	top := v00 + (v10-v00)*tx
+	bottom := v01 + (v11-v01)*tx
+	return top + (bottom-top)*ty
+}
+
+// value returns the value of a cell, clamping to the edge of the grid
+func (g DensityGrid) value(col, row int) float64 {
+	col = clamp(col, 0, g.Cols-1)
+	row = clamp(row, 0, g.Rows-1)
+	return g.Values[row*g.Cols+col]
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// gaussianKernel returns a normalized kernel truncated at three standard
+// deviations
+func gaussianKernel(sigma float64) []float64 {
+	if sigma <= 0 {
+		return []float64{1}
+	}
+	radius := int(math.Ceil(3 * sigma))
+	kernel := make([]float64, 2*radius+1)
+	sum := 0.0
+	for i := range kernel {
+		d := float64(i - radius)
+		kernel[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+	return kernel
+}
+
+// convolve applies kernel along one axis of a grid. There are n lines of
+// length elements each; consecutive elements of a line are step apart and
+// consecutive lines stride apart.
+func convolve(src, dst []float64, length, n, step, stride int, kernel []float64) {
+	radius := len(kernel) / 2
+	for line := 0; line < n; line++ {
+		base := line * stride
+		for i := 0; i < length; i++ {
+			sum := 0.0
+			for k, w := range kernel {
+				j := i + k - radius
+				if j < 0 || j >= length {
+					continue
+				}
+				sum += w * src[base+j*step]
+			}
+			dst[base+i*step] = sum
+		}
+	}
+}
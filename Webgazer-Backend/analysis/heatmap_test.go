@@ -0,0 +1,106 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDensity(t *testing.T) {
+	// sigma 40 px on 10 px cells is a kernel of 4 cells
+	const sigma = 40
+	tests := []struct {
+		name   string
+		points []Point
+		mass   float64 // Sum of the grid
+	}{
+		{"single point", []Point{{505, 405}}, 1},
+		{"three points", []Point{{205, 205}, {505, 405}, {805, 605}}, 3},
+		{"off-screen points ignored", []Point{{505, 405}, {-1, 10}, {10, 800}, {1000, 10}}, 1},
+		{"no points", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := Density(tt.points, 1000, 800, sigma)
+			if g.Cell != 10 || g.Cols != 100 || g.Rows != 80 {
+				t.Fatalf("grid is %dx%d cells of %d px, want 100x80 of 10 px", g.Cols, g.Rows, g.Cell)
+			}
+			sum := 0.0
+			for _, v := range g.Values {
+				sum += v
+			}
+			// Points away from the edges keep all their mass
+			if !near(sum, tt.mass, 1e-9) {
+				t.Errorf("total density = %g, want %g", sum, tt.mass)
+			}
+		})
+	}
+}
+
+func TestDensityGaussianShape(t *testing.T) {
+	g := Density([]Point{{505, 405}}, 1000, 800, 40)
+	centre := g.value(50, 40)
+	if centre != g.Max {
+		t.Fatalf("peak %g is not at the point's cell (%g)", g.Max, centre)
+	}
+	// A Gaussian falls to exp(-1/2) of its peak one standard deviation
+	// away and exp(-2) at two
+	tests := []struct {
+		col, row int
+		ratio    float64
+	}{
+		{54, 40, math.Exp(-0.5)},
+		{46, 40, math.Exp(-0.5)},
+		{50, 44, math.Exp(-0.5)},
+		{54, 44, math.Exp(-1)},
+		{58, 40, math.Exp(-2)},
+		{50, 53, 0}, // Beyond the kernel's three standard deviations
+	}
+	for _, tt := range tests {
+		if got := g.value(tt.col, tt.row) / centre; !near(got, tt.ratio, 1e-12) {
+			t.Errorf("cell (%d, %d) is %g of the peak, want %g", tt.col, tt.row, got, tt.ratio)
+		}
+	}
+}
+
+func TestDensityAt(t *testing.T) {
+	g := Density([]Point{{505, 405}}, 1000, 800, 40)
+	tests := []struct {
+		name string
+		x, y float64
+		want float64
+	}{
+		{"cell centre", 505, 405, g.value(50, 40)},
+		{"between cell centres", 510, 405, (g.value(50, 40) + g.value(51, 40)) / 2},
+		{"clamped at the edge", 0, 0, g.value(0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.At(tt.x, tt.y); !near(got, tt.want, 1e-15) {
+				t.Errorf("At(%g, %g) = %g, want %g", tt.x, tt.y, got, tt.want)
+			}
+		})
+	}
+
+	if got := (DensityGrid{}).At(1, 1); got != 0 {
+		t.Errorf("empty grid At = %g, want 0", got)
+	}
+}
+
+func TestGaussianKernel(t *testing.T) {
+	for _, sigma := range []float64{0.5, 1, 4, 10} {
+		kernel := gaussianKernel(sigma)
+		if len(kernel) != 2*int(math.Ceil(3*sigma))+1 {
+			t.Errorf("sigma %g: kernel has %d taps", sigma, len(kernel))
+		}
+		sum := 0.0
+		for _, w := range kernel {
+			sum += w
+		}
+		if !near(sum, 1, 1e-12) {
+			t.Errorf("sigma %g: kernel sums to %g", sigma, sum)
+		}
+	}
+	if kernel := gaussianKernel(0); len(kernel) != 1 || kernel[0] != 1 {
+		t.Errorf("zero sigma kernel = %v, want [1]", kernel)
+	}
+}
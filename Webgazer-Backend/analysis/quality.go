@@ -0,0 +1,57 @@
+package analysis
+
+import "time"
+
+// GazeQuality summarizes how well a gaze recording tracked the participant
+type GazeQuality struct {
+	SampleCount  int
+	Duration     time.Duration // From the first to the last sample
+	SamplingRate float64       // Samples per second over Duration, 0 with fewer than two samples
+	TrackLoss    time.Duration // Total length of gaps longer than maxGap
+	OffScreen    int           // Samples outside the screen
+}
+
+// TrackLossPercent returns the share of the recording lost to gaps
+func (q GazeQuality) TrackLossPercent() float64 {
+	if q.Duration <= 0 {
+		return 0
+	}
+	return float64(q.TrackLoss) / float64(q.Duration) * 100
+}
+
+// OffScreenPercent returns the share of samples outside the screen
+func (q GazeQuality) OffScreenPercent() float64 {
+	if q.SampleCount == 0 {
+		return 0
+	}
+	return float64(q.OffScreen) / float64(q.SampleCount) * 100
+}
+
+// ComputeGazeQuality measures the sampling rate, track loss and off-screen
+// samples of a recording on a width×height screen. Samples must be in
+// temporal order. A gap between successive samples longer than maxGap is
+// counted as track loss in full. Off-screen samples are not counted if the
+// screen size is unknown (zero).
+func ComputeGazeQuality(samples []Sample, width, height float64, maxGap time.Duration) GazeQuality {
+	q := GazeQuality{SampleCount: len(samples)}
+	if len(samples) == 0 {
+		return q
+	}
+
+	for i, s := range samples {
+		if width > 0 && height > 0 && (s.X < 0 || s.Y < 0 || s.X >= width || s.Y >= height) {
+			q.OffScreen++
+		}
+		if i > 0 {
+			if gap := s.Time.Sub(samples[i-1].Time); gap > maxGap {
+				q.TrackLoss += gap
+			}
+		}
+	}
+
+	q.Duration = samples[len(samples)-1].Time.Sub(samples[0].Time)
+	if q.Duration > 0 {
+		q.SamplingRate = float64(len(samples)-1) / q.Duration.Seconds()
+	}
+	return q
+}
@@ -0,0 +1,75 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeGazeQuality(t *testing.T) {
+	at := func(ms int, x, y float64) Sample {
+		return Sample{X: x, Y: y, Time: t0.Add(time.Duration(ms) * time.Millisecond)}
+	}
+	tests := []struct {
+		name          string
+		samples       []Sample
+		width, height float64
+		want          GazeQuality
+		trackLossPct  float64
+		offScreenPct  float64
+	}{
+		{
+			name:    "no samples",
+			samples: nil,
+			width:   1000, height: 800,
+			want: GazeQuality{},
+		},
+		{
+			name:    "single sample",
+			samples: []Sample{at(0, 10, 10)},
+			width:   1000, height: 800,
+			want: GazeQuality{SampleCount: 1},
+		},
+		{
+			name:    "steady 10 Hz",
+			samples: []Sample{at(0, 10, 10), at(100, 10, 10), at(200, 10, 10), at(300, 10, 10), at(400, 10, 10)},
+			width:   1000, height: 800,
+			want: GazeQuality{SampleCount: 5, Duration: 400 * time.Millisecond, SamplingRate: 10},
+		},
+		{
+			// The 600ms gap is lost in full; the edge pixel 1000 is off-screen
+			name:    "track loss and off-screen",
+			samples: []Sample{at(0, 10, 10), at(100, 10, 10), at(200, -5, 10), at(800, 10, 10), at(900, 1000, 10)},
+			width:   1000, height: 800,
+			want:         GazeQuality{SampleCount: 5, Duration: 900 * time.Millisecond, SamplingRate: 4 / 0.9, TrackLoss: 600 * time.Millisecond, OffScreen: 2},
+			trackLossPct: 600.0 / 900 * 100,
+			offScreenPct: 40,
+		},
+		{
+			name:    "gap of exactly max gap is not lost",
+			samples: []Sample{at(0, 10, 10), at(250, 10, 10)},
+			width:   1000, height: 800,
+			want: GazeQuality{SampleCount: 2, Duration: 250 * time.Millisecond, SamplingRate: 4},
+		},
+		{
+			name:    "unknown screen size",
+			samples: []Sample{at(0, -5, -5), at(100, 5000, 5000)},
+			want:    GazeQuality{SampleCount: 2, Duration: 100 * time.Millisecond, SamplingRate: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ComputeGazeQuality(tt.samples, tt.width, tt.height, 250*time.Millisecond)
+			if got.SampleCount != tt.want.SampleCount || got.Duration != tt.want.Duration ||
+				got.TrackLoss != tt.want.TrackLoss || got.OffScreen != tt.want.OffScreen ||
+				!near(got.SamplingRate, tt.want.SamplingRate, 1e-9) {
+				t.Errorf("\n got %+v\nwant %+v", got, tt.want)
+			}
+			if pct := got.TrackLossPercent(); !near(pct, tt.trackLossPct, 1e-9) {
+				t.Errorf("track loss = %g%%, want %g%%", pct, tt.trackLossPct)
+			}
+			if pct := got.OffScreenPercent(); !near(pct, tt.offScreenPct, 1e-9) {
+				t.Errorf("off-screen = %g%%, want %g%%", pct, tt.offScreenPct)
+			}
+		})
+	}
+}
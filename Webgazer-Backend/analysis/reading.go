@@ -0,0 +1,88 @@
+package analysis
+
+import "time"
+
+// WordFixation is a fixation on a word of a passage, in temporal order
+type WordFixation struct {
+	Word     int // Index of the word in reading order (0-based)
+	Duration time.Duration
+}
+
+// WordMeasures holds the standard eye-movement reading measures for a word.
+// First-pass measures are only defined when the word was fixated during
+// first pass, i.e. before any word further along the text.
+type WordMeasures struct {
+	Word                  int
+	FixationCount         int
+	FirstPass             bool          // Fixated during first pass
+	FirstFixationDuration time.Duration // Duration of the first first-pass fixation
+	GazeDuration          time.Duration // Sum of first-pass fixations before leaving the word
+	GoPastTime            time.Duration // Time from entering the word until a later word is fixated, including regressions
+	TotalReadingTime      time.Duration // Sum of all fixations on the word
+	Skipped               bool          // Not fixated during first pass
+	RegressionIn          bool          // Fixated directly after a fixation on a later word
+	RegressionOut         bool          // First pass ended with a fixation on an earlier word
+}
+
+// ReadingMeasures computes word-level measures for a passage of wordCount
+// words from the sequence of fixations on its words. Fixations on word
+// indices outside [0, wordCount) are ignored.
+func ReadingMeasures(wordCount int, fixations []WordFixation) []WordMeasures {
+	measures := make([]WordMeasures, wordCount)
+	for w := range measures {
+		measures[w].Word = w
+	}
+
+	var seq []WordFixation
+	for _, f := range fixations {
+		if f.Word >= 0 && f.Word < wordCount {
+			seq = append(seq, f)
+		}
+	}
+
+	// Rightmost word fixated before each fixation, to decide first pass
+	furthest := -1
+	for i, f := range seq {
+		m := &measures[f.Word]
+		m.FixationCount++
+		m.TotalReadingTime += f.Duration
+
+		if i > 0 && seq[i-1].Word > f.Word {
+			m.RegressionIn = true
+		}
+
+		if m.FixationCount == 1 && f.Word > furthest {
+			m.FirstPass = true
+			firstPass(m, seq, i)
+		}
+		if f.Word > furthest {
+			furthest = f.Word
+		}
+	}
+
+	for w := range measures {
+		measures[w].Skipped = !measures[w].FirstPass
+	}
+	return measures
+}
+
+// firstPass fills in the first-pass measures for a word entered at seq[start]
+func firstPass(m *WordMeasures, seq []WordFixation, start int) {
+	word := seq[start].Word
+	m.FirstFixationDuration = seq[start].Duration
+
+	// Gaze duration: consecutive fixations on the word
+	end := start
+	for end < len(seq) && seq[end].Word == word {
+		m.GazeDuration += seq[end].Duration
+		end++
+	}
+	if end < len(seq) && seq[end].Word < word {
+		m.RegressionOut = true
+	}
+
+	// Go-past time: everything until a word further along is fixated
+	for k := start; k < len(seq) && seq[k].Word <= word; k++ {
+		m.GoPastTime += seq[k].Duration
+	}
+}
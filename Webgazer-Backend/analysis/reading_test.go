@@ -0,0 +1,81 @@
+package analysis
+
+import "testing"
+
+func TestReadingMeasures(t *testing.T) {
+	// Words 0-3 read in order with a regression from 2 back to 1, word 4
+	// skipped and read after a regression from 5, word 6 read last
+	fixations := []WordFixation{
+		{0, ms(200)},
+		{1, ms(250)},
+		{2, ms(180)},
+		{1, ms(150)},
+		{3, ms(220)},
+		{5, ms(300)},
+		{4, ms(120)},
+		{6, ms(200)},
+		{9, ms(500)}, // Not a word of the passage
+	}
+	want := []WordMeasures{
+		{Word: 0, FixationCount: 1, FirstPass: true, FirstFixationDuration: ms(200), GazeDuration: ms(200), GoPastTime: ms(200), TotalReadingTime: ms(200)},
+		{Word: 1, FixationCount: 2, FirstPass: true, FirstFixationDuration: ms(250), GazeDuration: ms(250), GoPastTime: ms(250), TotalReadingTime: ms(400), RegressionIn: true},
+		{Word: 2, FixationCount: 1, FirstPass: true, FirstFixationDuration: ms(180), GazeDuration: ms(180), GoPastTime: ms(330), TotalReadingTime: ms(180), RegressionOut: true},
+		{Word: 3, FixationCount: 1, FirstPass: true, FirstFixationDuration: ms(220), GazeDuration: ms(220), GoPastTime: ms(220), TotalReadingTime: ms(220)},
+		{Word: 4, FixationCount: 1, TotalReadingTime: ms(120), Skipped: true, RegressionIn: true},
+		{Word: 5, FixationCount: 1, FirstPass: true, FirstFixationDuration: ms(300), GazeDuration: ms(300), GoPastTime: ms(420), TotalReadingTime: ms(300), RegressionOut: true},
+		{Word: 6, FixationCount: 1, FirstPass: true, FirstFixationDuration: ms(200), GazeDuration: ms(200), GoPastTime: ms(200), TotalReadingTime: ms(200)},
+		{Word: 7, Skipped: true},
+	}
+
+	got := ReadingMeasures(8, fixations)
+	if len(got) != len(want) {
+		t.Fatalf("got %d words, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("word %d:\n got %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadingMeasuresRefixation(t *testing.T) {
+	tests := []struct {
+		name      string
+		fixations []WordFixation
+		word      int
+		want      WordMeasures
+	}{
+		{
+			name:      "gaze duration sums refixations",
+			fixations: []WordFixation{{0, ms(100)}, {0, ms(80)}, {1, ms(200)}},
+			word:      0,
+			want:      WordMeasures{Word: 0, FixationCount: 2, FirstPass: true, FirstFixationDuration: ms(100), GazeDuration: ms(180), GoPastTime: ms(180), TotalReadingTime: ms(180)},
+		},
+		{
+			name:      "go-past time includes earlier words",
+			fixations: []WordFixation{{0, ms(100)}, {2, ms(150)}, {2, ms(50)}, {0, ms(120)}, {1, ms(90)}, {3, ms(200)}},
+			word:      2,
+			want:      WordMeasures{Word: 2, FixationCount: 2, FirstPass: true, FirstFixationDuration: ms(150), GazeDuration: ms(200), GoPastTime: ms(410), TotalReadingTime: ms(200), RegressionOut: true},
+		},
+		{
+			name:      "word first read after a regression is skipped",
+			fixations: []WordFixation{{0, ms(100)}, {2, ms(150)}, {1, ms(90)}, {3, ms(200)}},
+			word:      1,
+			want:      WordMeasures{Word: 1, FixationCount: 1, TotalReadingTime: ms(90), Skipped: true, RegressionIn: true},
+		},
+		{
+			name:      "word never fixated",
+			fixations: []WordFixation{{0, ms(100)}, {2, ms(150)}},
+			word:      1,
+			want:      WordMeasures{Word: 1, Skipped: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ReadingMeasures(4, tt.fixations)[tt.word]
+			if got != tt.want {
+				t.Errorf("\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
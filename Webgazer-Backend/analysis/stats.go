@@ -0,0 +1,423 @@
+package analysis
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Mean returns the arithmetic mean of xs, or 0 if xs is empty
+func Mean(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
+
+// StdDev returns the sample standard deviation of xs (n-1 denominator), or
+// 0 with fewer than two values
+func StdDev(xs []float64) float64 {
+	if len(xs) < 2 {
+		return 0
+	}
+	m := Mean(xs)
+	ss := 0.0
+	for _, x := range xs {
+		ss += (x - m) * (x - m)
+	}
+	return math.Sqrt(ss / float64(len(xs)-1))
+}
+
+// Quantile returns the q-th quantile of xs, interpolating linearly between
+// order statistics (the default method of R and NumPy)
+func Quantile(xs []float64, q float64) float64 {
+	if len(xs) == 0 {
+		return math.NaN()
+	}
+	sorted := append([]float64(nil), xs...)
+	sort.Float64s(sorted)
+	return quantileSorted(sorted, q)
+}
+
+func quantileSorted(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(math.Floor(pos))
+	if i >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (sorted[i+1]-sorted[i])*(pos-float64(i))
+}
+
+// Median returns the median of xs
+func Median(xs []float64) float64 {
+	return Quantile(xs, 0.5)
+}
+
+// Correlation returns the Pearson correlation of x and y, which must have
+// the same length. It reports false if either has no variance. With a
+// binary x this is the point-biserial correlation.
+func Correlation(x, y []float64) (float64, bool) {
+	if len(x) != len(y) || len(x) < 2 {
+		return 0, false
+	}
+	mx, my := Mean(x), Mean(y)
+	var sxy, sxx, syy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return sxy / math.Sqrt(sxx*syy), true
+}
+
+// NormalCDF returns the standard normal cumulative distribution at z
+func NormalCDF(z float64) float64 {
+	return 0.5 * math.Erfc(-z/math.Sqrt2)
+}
+
+// regIncBeta returns the regularized incomplete beta function I_x(a, b)
+func regIncBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	// The continued fraction converges quickly only on this side
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+// betaContinuedFraction evaluates the continued fraction of the incomplete
+// beta function with the modified Lentz method
+func betaContinuedFraction(a, b, x float64) float64 {
+	const (
+		maxIterations = 300
+		epsilon       = 1e-14
+		tiny          = 1e-300
+	)
+	qab, qap, qam := a+b, a+1, a-1
+	c, d := 1.0, 1-qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m <= maxIterations; m++ {
+		fm := float64(m)
+		m2 := 2 * fm
+		aa := fm * (b - fm) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + fm) * (qab + fm) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		del := d * c
+		h *= del
+		if math.Abs(del-1) < epsilon {
+			break
+		}
+	}
+	return h
+}
+
+// StudentTCDF returns the cumulative distribution of Student's t with df
+// degrees of freedom at t
+func StudentTCDF(t, df float64) float64 {
+	tail := 0.5 * regIncBeta(df/2, 0.5, df/(df+t*t))
+	if t > 0 {
+		return 1 - tail
+	}
+	return tail
+}
+
+// StudentTQuantile returns the p-th quantile of Student's t with df degrees
+// of freedom
+func StudentTQuantile(p, df float64) float64 {
+	if p == 0.5 {
+		return 0
+	}
+	if p < 0.5 {
+		return -StudentTQuantile(1-p, df)
+	}
+	lo, hi := 0.0, 1.0
+	for StudentTCDF(hi, df) < p {
+		hi *= 2
+	}
+	for i := 0; i < 200 && hi-lo > 1e-12; i++ {
+		mid := (lo + hi) / 2
+		if StudentTCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// TTest is the result of a one-sample (or paired) t-test against zero
+type TTest struct {
+	N        int
+	Mean     float64 // Mean (difference)
+	StdDev   float64
+	T        float64
+	DF       float64
+	PValue   float64 // Two-sided
+	CILow    float64 // Confidence interval of the mean
+	CIHigh   float64
+	CohensDz float64 // Mean divided by standard deviation
+}
+
+// PairedTTest tests whether the mean of paired differences differs from
+// zero, with a confidence interval at the given level (e.g. 0.95)
+func PairedTTest(diffs []float64, level float64) (TTest, error) {
+	n := len(diffs)
+	if n < 2 {
+		return TTest{N: n}, errors.New("at least two pairs are required")
+	}
+	r := TTest{N: n, Mean: Mean(diffs), StdDev: StdDev(diffs), DF: float64(n - 1)}
+	if r.StdDev == 0 {
+		return r, errors.New("all differences are equal")
+	}
+	se := r.StdDev / math.Sqrt(float64(n))
+	r.T = r.Mean / se
+	r.PValue = 2 * StudentTCDF(-math.Abs(r.T), r.DF)
+	margin := StudentTQuantile(1-(1-level)/2, r.DF) * se
+	r.CILow, r.CIHigh = r.Mean-margin, r.Mean+margin
+	r.CohensDz = r.Mean / r.StdDev
+	return r, nil
+}
+
+// WilcoxonResult is the result of a Wilcoxon signed-rank test
+type WilcoxonResult struct {
+	N            int     // Non-zero differences
+	Zeros        int     // Zero differences, dropped
+	V            float64 // Sum of the ranks of positive differences
+	Z            float64 // Normal approximation, with tie and continuity correction
+	PValue       float64 // Two-sided
+	Exact        bool    // PValue is from the exact distribution (no ties, N ≤ 50)
+	RankBiserial float64 // Matched-pairs rank-biserial correlation, from -1 to 1
+}
+
+// WilcoxonSignedRank tests whether paired differences are symmetric about
+// zero. Zero differences are dropped and tied ranks averaged.
+func WilcoxonSignedRank(diffs []float64) (WilcoxonResult, error) {
+	type ranked struct {
+		abs  float64
+		sign float64
+	}
+	var r WilcoxonResult
+	var values []ranked
+	for _, d := range diffs {
+		if d == 0 {
+			r.Zeros++
+			continue
+		}
+		values = append(values, ranked{math.Abs(d), math.Copysign(1, d)})
+	}
+	n := len(values)
+	r.N = n
+	if n == 0 {
+		return r, errors.New("all differences are zero")
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].abs < values[j].abs })
+
+	ranks := make([]float64, n)
+	tieCorrection := 0.0
+	for i := 0; i < n; {
+		j := i
+		for j+1 < n && values[j+1].abs == values[i].abs {
+			j++
+		}
+		rank := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			ranks[k] = rank
+		}
+		t := float64(j - i + 1)
+		tieCorrection += t*t*t - t
+		i = j + 1
+	}
+
+	wPlus, wMinus := 0.0, 0.0
+	for i, v := range values {
+		if v.sign > 0 {
+			wPlus += ranks[i]
+		} else {
+			wMinus += ranks[i]
+		}
+	}
+	r.V = wPlus
+	total := float64(n) * float64(n+1) / 2
+	r.RankBiserial = (wPlus - wMinus) / total
+
+	mean := total / 2
+	variance := float64(n)*float64(n+1)*float64(2*n+1)/24 - tieCorrection/48
+	if variance > 0 {
+		diff := wPlus - mean
+		correction := 0.0
+		if diff > 0 {
+			correction = 0.5
+		} else if diff < 0 {
+			correction = -0.5
+		}
+		r.Z = (diff - correction) / math.Sqrt(variance)
+		r.PValue = math.Min(1, 2*NormalCDF(-math.Abs(r.Z)))
+	} else {
+		r.PValue = 1
+	}
+
+	if tieCorrection == 0 && n <= 50 {
+		r.Exact = true
+		r.PValue = wilcoxonExactP(n, wPlus)
+	}
+	return r, nil
+}
+
+// wilcoxonExactP returns the exact two-sided p-value of the signed-rank
+// statistic v for n untied differences
+func wilcoxonExactP(n int, v float64) float64 {
+	maxSum := n * (n + 1) / 2
+	// counts[s] is the number of subsets of ranks 1..k summing to s
+	counts := make([]float64, maxSum+1)
+	counts[0] = 1
+	for k := 1; k <= n; k++ {
+		for s := maxSum; s >= k; s-- {
+			counts[s] += counts[s-k]
+		}
+	}
+	totalSubsets := math.Pow(2, float64(n))
+	w := int(math.Round(v))
+	lower, upper := 0.0, 0.0
+	for s, c := range counts {
+		if s <= w {
+			lower += c
+		}
+		if s >= w {
+			upper += c
+		}
+	}
+	return math.Min(1, 2*math.Min(lower, upper)/totalSubsets)
+}
+
+// BootstrapCI is a percentile bootstrap confidence interval
+type BootstrapCI struct {
+	Low, High float64
+}
+
+// BootstrapPaired resamples paired differences with replacement and returns
+// percentile confidence intervals at the given level for the mean, the
+// median and Cohen's dz. The seed makes the intervals reproducible.
+func BootstrapPaired(diffs []float64, resamples int, level float64, seed int64) (mean, median, dz BootstrapCI) {
+	n := len(diffs)
+	if n == 0 || resamples <= 0 {
+		return
+	}
+	rng := rand.New(rand.NewSource(seed))
+	means := make([]float64, resamples)
+	medians := make([]float64, resamples)
+	dzs := make([]float64, 0, resamples)
+	sample := make([]float64, n)
+	for i := 0; i < resamples; i++ {
+		for j := range sample {
+			sample[j] = diffs[rng.Intn(n)]
+		}
+		means[i] = Mean(sample)
+		medians[i] = Median(sample)
+		if sd := StdDev(sample); sd > 0 {
+			dzs = append(dzs, means[i]/sd)
+		}
+	}
+
+	alpha := (1 - level) / 2
+	interval := func(xs []float64) BootstrapCI {
+		if len(xs) == 0 {
+			return BootstrapCI{math.NaN(), math.NaN()}
+		}
+		sort.Float64s(xs)
+		return BootstrapCI{quantileSorted(xs, alpha), quantileSorted(xs, 1-alpha)}
+	}
+	return interval(means), interval(medians), interval(dzs)
+}
+
+// logBinomialPMF returns the log probability of k successes in n trials
+func logBinomialPMF(k, n int, p float64) float64 {
+	ln, _ := math.Lgamma(float64(n + 1))
+	lk, _ := math.Lgamma(float64(k + 1))
+	lnk, _ := math.Lgamma(float64(n - k + 1))
+	return ln - lk - lnk + float64(k)*math.Log(p) + float64(n-k)*math.Log(1-p)
+}
+
+// BinomialTest returns the exact two-sided p-value of k successes in n
+// trials under success probability p: the probability of all outcomes no
+// more likely than k (as R's binom.test)
+func BinomialTest(k, n int, p float64) float64 {
+	if n == 0 {
+		return 1
+	}
+	if p <= 0 || p >= 1 {
+		if (p <= 0 && k == 0) || (p >= 1 && k == n) {
+			return 1
+		}
+		return 0
+	}
+	observed := logBinomialPMF(k, n, p)
+	const relErr = 1 + 1e-7
+	total := 0.0
+	for i := 0; i <= n; i++ {
+		if lp := logBinomialPMF(i, n, p); lp <= observed+math.Log(relErr) {
+			total += math.Exp(lp)
+		}
+	}
+	return math.Min(1, total)
+}
+
+// WilsonInterval returns the Wilson score confidence interval at the given
+// level for k successes in n trials
+func WilsonInterval(k, n int, level float64) (low, high float64) {
+	if n == 0 {
+		return math.NaN(), math.NaN()
+	}
+	z := normalQuantile(1 - (1-level)/2)
+	phat := float64(k) / float64(n)
+	nf := float64(n)
+	denom := 1 + z*z/nf
+	centre := (phat + z*z/(2*nf)) / denom
+	margin := z * math.Sqrt(phat*(1-phat)/nf+z*z/(4*nf*nf)) / denom
+	return math.Max(0, centre-margin), math.Min(1, centre+margin)
+}
+
+// normalQuantile returns the p-th quantile of the standard normal
+// distribution
+func normalQuantile(p float64) float64 {
+	return -math.Sqrt2 * math.Erfcinv(2*p)
+}
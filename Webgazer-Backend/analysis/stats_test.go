@@ -0,0 +1,262 @@
+package analysis
+
+import (
+	"math"
+	"testing"
+)
+
+// R's sleep data: extra hours of sleep with drug 1 minus drug 2 for the
+// same ten patients
+var sleepDiffs = []float64{-1.2, -2.4, -1.3, -1.3, 0, -1.0, -1.8, -0.8, -4.6, -1.4}
+
+func TestDescriptive(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"mean", Mean([]float64{2, 4, 4, 4, 5, 5, 7, 9}), 5},
+		{"mean of nothing", Mean(nil), 0},
+		{"sd", StdDev([]float64{2, 4, 4, 4, 5, 5, 7, 9}), math.Sqrt(32.0 / 7)},
+		{"sd of one value", StdDev([]float64{3}), 0},
+		// quantile(c(1, 2, 3, 4, 10), 0.25)
+		{"quantile 0.25", Quantile([]float64{10, 3, 1, 4, 2}, 0.25), 2},
+		// quantile(1:10, 0.9)
+		{"quantile 0.9", Quantile([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 0.9), 9.1},
+		{"quantile 1", Quantile([]float64{1, 5, 3}, 1), 5},
+		{"median even", Median([]float64{3, 1, 2, 10}), 2.5},
+		{"median odd", Median([]float64{3, 1, 2}), 2},
+	}
+	for _, tt := range tests {
+		if !near(tt.got, tt.want, 1e-12) {
+			t.Errorf("%s = %.12g, want %.12g", tt.name, tt.got, tt.want)
+		}
+	}
+	if !math.IsNaN(Quantile(nil, 0.5)) {
+		t.Error("quantile of nothing is not NaN")
+	}
+}
+
+func TestCorrelation(t *testing.T) {
+	tests := []struct {
+		name string
+		x, y []float64
+		want float64
+		ok   bool
+	}{
+		// cor(1:5, c(2, 4, 5, 4, 5))
+		{"pearson", []float64{1, 2, 3, 4, 5}, []float64{2, 4, 5, 4, 5}, math.Sqrt(0.6), true},
+		{"perfect negative", []float64{1, 2, 3}, []float64{6, 4, 2}, -1, true},
+		{"no variance", []float64{1, 1, 1}, []float64{1, 2, 3}, 0, false},
+		{"length mismatch", []float64{1, 2}, []float64{1, 2, 3}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Correlation(tt.x, tt.y)
+			if ok != tt.ok || !near(got, tt.want, 1e-12) {
+				t.Errorf("Correlation = %g, %v; want %g, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDistributions(t *testing.T) {
+	tests := []struct {
+		name      string
+		got, want float64
+		tol       float64
+	}{
+		{"pnorm(1.96)", NormalCDF(1.96), 0.9750021048517795, 1e-12},
+		{"pnorm(0)", NormalCDF(0), 0.5, 1e-15},
+		// The t distribution with one degree of freedom is Cauchy
+		{"pt(1, 1)", StudentTCDF(1, 1), 0.75, 1e-12},
+		{"pt(0, 7)", StudentTCDF(0, 7), 0.5, 1e-12},
+		{"pt(-2, 5)", StudentTCDF(-2, 5), 0.05096974, 1e-8},
+		{"pt(2.262157, 9)", StudentTCDF(2.262157, 9), 0.975, 1e-7},
+		{"pt(1.697261, 30)", StudentTCDF(1.697261, 30), 0.95, 1e-7},
+		{"qt(0.975, 9)", StudentTQuantile(0.975, 9), 2.262157, 1e-6},
+		{"qt(0.975, 1)", StudentTQuantile(0.975, 1), 12.7062, 1e-4},
+		{"qt(0.05, 30)", StudentTQuantile(0.05, 30), -1.697261, 1e-6},
+		{"qt(0.5, 4)", StudentTQuantile(0.5, 4), 0, 0},
+		{"qnorm(0.975)", normalQuantile(0.975), 1.959964, 1e-6},
+		{"pbeta(0.3, 2, 3)", regIncBeta(2, 3, 0.3), 0.3483, 1e-12},
+	}
+	for _, tt := range tests {
+		if !near(tt.got, tt.want, tt.tol) {
+			t.Errorf("%s = %.10g, want %.10g", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestPairedTTest(t *testing.T) {
+	// t.test(extra ~ group, data = sleep, paired = TRUE):
+	// t = -4.0621, df = 9, p-value = 0.002833,
+	// 95 percent confidence interval -2.4598858 -0.7001142
+	r, err := PairedTTest(sleepDiffs, 0.95)
+	if err != nil {
+		t.Fatalf("PairedTTest: %v", err)
+	}
+	tests := []struct {
+		name      string
+		got, want float64
+		tol       float64
+	}{
+		{"mean", r.Mean, -1.58, 1e-12},
+		{"t", r.T, -4.062128, 1e-6},
+		{"df", r.DF, 9, 0},
+		{"p", r.PValue, 0.002832890, 1e-8},
+		{"ci low", r.CILow, -2.4598858, 1e-6},
+		{"ci high", r.CIHigh, -0.7001142, 1e-6},
+		{"dz", r.CohensDz, -1.58 / 1.229995483, 1e-8},
+	}
+	for _, tt := range tests {
+		if !near(tt.got, tt.want, tt.tol) {
+			t.Errorf("%s = %.10g, want %.10g", tt.name, tt.got, tt.want)
+		}
+	}
+
+	for _, diffs := range [][]float64{{1}, {2, 2, 2}} {
+		if _, err := PairedTTest(diffs, 0.95); err == nil {
+			t.Errorf("PairedTTest(%v) succeeded", diffs)
+		}
+	}
+}
+
+func TestWilcoxonSignedRank(t *testing.T) {
+	// Hollander & Wolfe depression scores, first minus second visit
+	depression := []float64{0.952, -0.147, 1.022, 0.43, 0.62, 0.59, 0.49, -0.08, 0.01}
+
+	tests := []struct {
+		name  string
+		diffs []float64
+		want  WilcoxonResult
+		tol   float64
+	}{
+		{
+			// wilcox.test(x, y, paired = TRUE): V = 40, p-value = 0.03906
+			name:  "exact",
+			diffs: depression,
+			want:  WilcoxonResult{N: 9, V: 40, PValue: 0.0390625, Exact: true, RankBiserial: 35.0 / 45},
+			tol:   1e-12,
+		},
+		{
+			// wilcox.test(extra ~ group, data = sleep, paired = TRUE):
+			// V = 0, p-value = 0.009091, with ties and a zero
+			name:  "normal approximation with ties and zeros",
+			diffs: sleepDiffs,
+			want:  WilcoxonResult{N: 9, Zeros: 1, V: 0, PValue: 0.009090698, RankBiserial: -1},
+			tol:   1e-8,
+		},
+		{
+			// wilcox.test(c(1, 2, 3)): V = 6, p-value = 0.25
+			name:  "all positive",
+			diffs: []float64{1, 2, 3},
+			want:  WilcoxonResult{N: 3, V: 6, PValue: 0.25, Exact: true, RankBiserial: 1},
+			tol:   1e-12,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := WilcoxonSignedRank(tt.diffs)
+			if err != nil {
+				t.Fatalf("WilcoxonSignedRank: %v", err)
+			}
+			if got.N != tt.want.N || got.Zeros != tt.want.Zeros || got.V != tt.want.V || got.Exact != tt.want.Exact ||
+				!near(got.PValue, tt.want.PValue, tt.tol) || !near(got.RankBiserial, tt.want.RankBiserial, 1e-12) {
+				t.Errorf("\n got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := WilcoxonSignedRank([]float64{0, 0}); err == nil {
+		t.Error("all-zero differences accepted")
+	}
+}
+
+func TestWilcoxonExactP(t *testing.T) {
+	tests := []struct {
+		n    int
+		v    float64
+		want float64
+	}{
+		{3, 0, 0.25},
+		{3, 3, 1},
+		// psignrank(5, 9) = 10/512
+		{9, 5, 20.0 / 512},
+		{9, 40, 20.0 / 512},
+		{10, 27.5, 1},
+		// psignrank(8, 10) = 25/1024
+		{10, 8, 50.0 / 1024},
+	}
+	for _, tt := range tests {
+		if got := wilcoxonExactP(tt.n, tt.v); !near(got, tt.want, 1e-12) {
+			t.Errorf("wilcoxonExactP(%d, %g) = %.10g, want %.10g", tt.n, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestBinomialTest(t *testing.T) {
+	tests := []struct {
+		name string
+		k, n int
+		p    float64
+		want float64
+		tol  float64
+	}{
+		// binom.test(682, 925, p = 0.75): p-value = 0.3825
+		{"mendel", 682, 925, 0.75, 0.3824916, 1e-7},
+		// binom.test(7, 10): p-value = 0.3438
+		{"fair coin", 7, 10, 0.5, 0.34375, 1e-12},
+		{"centre", 5, 10, 0.5, 1, 1e-12},
+		{"extreme", 0, 10, 0.5, 2.0 / 1024, 1e-12},
+		{"no trials", 0, 0, 0.5, 1, 0},
+		{"impossible", 1, 10, 0, 0, 0},
+		{"certain", 10, 10, 1, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BinomialTest(tt.k, tt.n, tt.p); !near(got, tt.want, tt.tol) {
+				t.Errorf("BinomialTest(%d, %d, %g) = %.10g, want %.10g", tt.k, tt.n, tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWilsonInterval(t *testing.T) {
+	tests := []struct {
+		k, n      int
+		low, high float64
+	}{
+		{0, 10, 0, 0.2775328},
+		{10, 10, 0.7224672, 1},
+		{5, 10, 0.2365931, 0.7634069},
+	}
+	for _, tt := range tests {
+		low, high := WilsonInterval(tt.k, tt.n, 0.95)
+		if !near(low, tt.low, 1e-6) || !near(high, tt.high, 1e-6) {
+			t.Errorf("WilsonInterval(%d, %d) = [%.7f, %.7f], want [%.7f, %.7f]", tt.k, tt.n, low, high, tt.low, tt.high)
+		}
+	}
+	if low, high := WilsonInterval(0, 0, 0.95); !math.IsNaN(low) || !math.IsNaN(high) {
+		t.Error("interval of no trials is not NaN")
+	}
+}
+
+func TestBootstrapPaired(t *testing.T) {
+	mean1, median1, dz1 := BootstrapPaired(sleepDiffs, 2000, 0.95, 7)
+	mean2, median2, dz2 := BootstrapPaired(sleepDiffs, 2000, 0.95, 7)
+	if mean1 != mean2 || median1 != median2 || dz1 != dz2 {
+		t.Error("the same seed gave different intervals")
+	}
+	if !(mean1.Low < -1.58 && -1.58 < mean1.High) {
+		t.Errorf("mean interval [%g, %g] excludes the sample mean", mean1.Low, mean1.High)
+	}
+	if !(median1.Low <= -1.3 && -1.3 <= median1.High) {
+		t.Errorf("median interval [%g, %g] excludes the sample median", median1.Low, median1.High)
+	}
+
+	// Without variance every resample is the same
+	mean, median, dz := BootstrapPaired([]float64{2, 2, 2}, 100, 0.95, 1)
+	if mean != (BootstrapCI{2, 2}) || median != (BootstrapCI{2, 2}) || !math.IsNaN(dz.Low) {
+		t.Errorf("constant differences gave mean %v, median %v, dz %v", mean, median, dz)
+	}
+}
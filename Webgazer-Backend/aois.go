@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// aoiKindRank orders AOI kinds from most to least specific
+var aoiKindRank = map[string]int{
+	AOIKindWord:  0,
+	AOIKindLine:  1,
+	AOIKindPanel: 2,
+}
+
+// aoiIndex finds the AOI under a gaze position for one session
+type aoiIndex struct {
+	aois []AOI
+}
+
+func loadAOIIndex(tx *gorm.DB, sessionID uint) (*aoiIndex, error) {
+	var aois []AOI
+	if err := tx.Where("session_id = ?", sessionID).Find(&aois).Error; err != nil {
+		return nil, err
+	}
+	return &aoiIndex{aois: aois}, nil
+}
+
+// lookup returns the ID of the most specific AOI containing (x, y), or nil.
+//
+// Only AOIs on the same panel are considered (any panel if panel is empty).
+// If the sample does not say which passage was shown and the position falls
+// inside AOIs of several passages, the sample is left unmapped.
+func (idx *aoiIndex) lookup(panel string, passageID *uint, x, y float64) *uint {
+	if idx == nil {
+		return nil
+	}
+
+	var best *AOI
+	ambiguous := false
+	for i := range idx.aois {
+		aoi := &idx.aois[i]
+		if panel != "" && aoi.Panel != panel {
+			continue
+		}
+		if passageID != nil && aoi.PassageID != *passageID {
+			continue
+		}
+		if x < aoi.X || x > aoi.X+aoi.Width || y < aoi.Y || y > aoi.Y+aoi.Height {
+			continue
+		}
+
+		if best != nil && best.PassageID != aoi.PassageID {
+			ambiguous = true
+		}
+		if best == nil ||
+			aoiKindRank[aoi.Kind] < aoiKindRank[best.Kind] ||
+			(aoi.Kind == best.Kind && aoi.Width*aoi.Height < best.Width*best.Height) {
+			best = aoi
+		}
+	}
+
+	if best == nil || ambiguous {
+		return nil
+	}
+	id := best.ID
+	return &id
+}
+
+// assignGazePointAOIs sets AOIID on gaze points that are about to be inserted
+func assignGazePointAOIs(tx *gorm.DB, sessionID uint, points []GazePoint) error {
+	idx, err := loadAOIIndex(tx, sessionID)
+	if err != nil {
+		return err
+	}
+	for i := range points {
+		points[i].AOIID = idx.lookup(points[i].Panel, points[i].PassageID, points[i].X, points[i].Y)
+	}
+	return nil
+}
+
+// remapSessionAOIs recomputes the AOI of every stored gaze point and
+// fixation in a session, e.g. after a new layout has been posted
+func remapSessionAOIs(tx *gorm.DB, sessionID uint) error {
+	idx, err := loadAOIIndex(tx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	var points []GazePoint
+	if err := tx.Select("id", "panel", "passage_id", "x", "y").Where("session_id = ?", sessionID).Find(&points).Error; err != nil {
+		return err
+	}
+	pointAOIs := make(map[uint][]uint)
+	for _, p := range points {
+		if aoiID := idx.lookup(p.Panel, p.PassageID, p.X, p.Y); aoiID != nil {
+			pointAOIs[*aoiID] = append(pointAOIs[*aoiID], p.ID)
+		}
+	}
+	if err := updateAOIIDs(tx, &GazePoint{}, sessionID, pointAOIs); err != nil {
+		return err
+	}
+
+	var fixations []Fixation
+	if err := tx.Select("id", "panel", "passage_id", "x", "y").Where("session_id = ?", sessionID).Find(&fixations).Error; err != nil {
+		return err
+	}
+	fixationAOIs := make(map[uint][]uint)
+	for _, f := range fixations {
+		if aoiID := idx.lookup(f.Panel, f.PassageID, f.X, f.Y); aoiID != nil {
+			fixationAOIs[*aoiID] = append(fixationAOIs[*aoiID], f.ID)
+		}
+	}
+	return updateAOIIDs(tx, &Fixation{}, sessionID, fixationAOIs)
+}
+
+// updateAOIIDs clears aoi_id for all rows of model in the session and then
+// sets it for the given rows, grouped by AOI
+func updateAOIIDs(tx *gorm.DB, model interface{}, sessionID uint, rowsByAOI map[uint][]uint) error {
+	if err := tx.Model(model).Where("session_id = ?", sessionID).Update("aoi_id", nil).Error; err != nil {
+		return err
+	}
+	for aoiID, ids := range rowsByAOI {
+		for start := 0; start < len(ids); start += gazeInsertBatchSize {
+			end := start + gazeInsertBatchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			if err := tx.Model(model).Where("id IN ?", ids[start:end]).Update("aoi_id", aoiID).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sessionLayoutRequest is the body of POST /api/sessions/:uid/layout
+type sessionLayoutRequest struct {
+	PassageID uint   `json:"passage_id"`
+	Panel     string `json:"panel"`
+	AOIs      []AOI  `json:"aois"`
+}
+
+func validateAOI(aoi AOI) string {
+	if _, ok := aoiKindRank[aoi.Kind]; !ok {
+		return fmt.Sprintf("kind must be %q, %q or %q", AOIKindWord, AOIKindLine, AOIKindPanel)
+	}
+	for _, v := range []float64{aoi.X, aoi.Y, aoi.Width, aoi.Height} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "x, y, width and height must be finite numbers"
+		}
+	}
+	if aoi.Width <= 0 || aoi.Height <= 0 {
+		return "width and height must be positive"
+	}
+	return ""
+}
+
+// handleSessionLayout stores the rendered bounding boxes of a passage's
+// words, lines and panel, replacing any earlier layout for the same passage
+// and panel, and maps the session's gaze points and fixations onto them
+func handleSessionLayout(c *gin.Context) {
+	db := dbFrom(c)
+	var session StudySession
+	if !findSessionByUID(c, &session) {
+		return
+	}
+	if isFinalSessionStatus(session.Status) {
+		c.JSON(409, gin.H{"error": "Session is already " + session.Status})
+		return
+	}
+	if !requireConsent(c, session) {
+		return
+	}
+
+	var layout sessionLayoutRequest
+	if err := c.ShouldBindJSON(&layout); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+
+	// Validate required fields
+	if layout.PassageID == 0 || layout.Panel == "" || len(layout.AOIs) == 0 {
+		c.JSON(400, gin.H{"error": "passage_id, panel and aois are required"})
+		return
+	}
+	for i, aoi := range layout.AOIs {
+		if reason := validateAOI(aoi); reason != "" {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("aois[%d]: %s", i, reason)})
+			return
+		}
+	}
+
+	// The passage must be one the session shows
+	studyTextID, err := quizStudyTextID(db, session)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(500, gin.H{"error": "Failed to fetch study text: " + err.Error()})
+		return
+	}
+	var passage Passage
+	if err := db.Where("id = ? AND study_text_id = ?", layout.PassageID, studyTextID).First(&passage).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Passage not found in the session's study text"})
+		return
+	}
+
+	aois := make([]AOI, len(layout.AOIs))
+	for i, aoi := range layout.AOIs {
+		aoi.ID = 0
+		aoi.SessionID = session.ID
+		aoi.PassageID = passage.ID
+		aoi.Panel = layout.Panel
+		aois[i] = aoi
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ? AND passage_id = ? AND panel = ?", session.ID, passage.ID, layout.Panel).Delete(&AOI{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("Session", "Passage").CreateInBatches(&aois, gazeInsertBatchSize).Error; err != nil {
+			return err
+		}
+		return remapSessionAOIs(tx, session.ID)
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to save layout: " + err.Error()})
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"success": true,
+		"count":   len(aois),
+	})
+}
+
+// aoiSummary is an AOI with the number of gaze points and fixations on it
+type aoiSummary struct {
+	AOI
+	GazeCount     int64 `json:"gaze_count"`
+	FixationCount int64 `json:"fixation_count"`
+}
+
+func handleAdminSessionAOIs(c *gin.Context) {
+	db := dbFrom(c)
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid session id"})
+		return
+	}
+
+	var aois []AOI
+	query := db.Where("session_id = ?", sessionID)
+	if passageID := c.Query("passage_id"); passageID != "" {
+		query = query.Where("passage_id = ?", passageID)
+	}
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if err := query.Order("passage_id ASC, panel ASC, kind ASC, \"index\" ASC").Find(&aois).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch AOIs: " + err.Error()})
+		return
+	}
+
+	type aoiCount struct {
+		AOIID uint
+		Count int64
+	}
+	var gazeCounts, fixationCounts []aoiCount
+	if err := db.Model(&GazePoint{}).Select("aoi_id, COUNT(*) AS count").Where("session_id = ? AND aoi_id IS NOT NULL", sessionID).Group("aoi_id").Scan(&gazeCounts).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to count gaze points: " + err.Error()})
+		return
+	}
+	if err := db.Model(&Fixation{}).Select("aoi_id, COUNT(*) AS count").Where("session_id = ? AND aoi_id IS NOT NULL", sessionID).Group("aoi_id").Scan(&fixationCounts).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to count fixations: " + err.Error()})
+		return
+	}
+
+	gazeByAOI := make(map[uint]int64, len(gazeCounts))
+	for _, gc := range gazeCounts {
+		gazeByAOI[gc.AOIID] = gc.Count
+	}
+	fixationsByAOI := make(map[uint]int64, len(fixationCounts))
+	for _, fc := range fixationCounts {
+		fixationsByAOI[fc.AOIID] = fc.Count
+	}
+
+	summaries := make([]aoiSummary, len(aois))
+	for i, aoi := range aois {
+		summaries[i] = aoiSummary{
+			AOI:           aoi,
+			GazeCount:     gazeByAOI[aoi.ID],
+			FixationCount: fixationsByAOI[aoi.ID],
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    summaries,
+	})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Admin roles. Each role can do everything the roles before it can.
+const (
+	RoleViewer = "viewer" // Read study content and results
+	RoleEditor = "editor" // Also change study content and recompute analyses
+	RoleOwner  = "owner"  // Also manage admin tokens
+)
+
+var roleRank = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// adminTokenPrefix marks strings as readability admin tokens
+const adminTokenPrefix = "rbt_"
+
+// adminTokenContextKey is the gin context key the authenticated token is stored under
+const adminTokenContextKey = "admin_token"
+
+func validRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+func hashAdminToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func validateAdminToken(name, role string) error {
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if !validRole(role) {
+		return fmt.Errorf("invalid role %q (must be viewer, editor or owner)", role)
+	}
+	return nil
+}
+
+// createAdminToken generates a new token with the given role and stores its
+// hash. The returned token string cannot be recovered later.
+func createAdminToken(db *gorm.DB, name, role string) (AdminToken, string, error) {
+	if err := validateAdminToken(name, role); err != nil {
+		return AdminToken{}, "", err
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return AdminToken{}, "", err
+	}
+	token := adminTokenPrefix + hex.EncodeToString(buf)
+
+	record := AdminToken{
+		Name:      name,
+		Role:      role,
+		TokenHash: hashAdminToken(token),
+		Prefix:    token[:len(adminTokenPrefix)+8],
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return AdminToken{}, "", err
+	}
+	return record, token, nil
+}
+
+// revokeAdminToken marks a token as revoked so it is no longer accepted
+func revokeAdminToken(db *gorm.DB, id uint) (AdminToken, error) {
+	var token AdminToken
+	if err := db.First(&token, id).Error; err != nil {
+		return AdminToken{}, err
+	}
+	if token.RevokedAt == nil {
+		now := time.Now()
+		token.RevokedAt = &now
+		if err := db.Model(&token).Update("revoked_at", now).Error; err != nil {
+			return AdminToken{}, err
+		}
+	}
+	return token, nil
+}
+
+// adminAuth authenticates admin requests with an "Authorization: Bearer"
+// token. Reads need the viewer role and writes the editor role.
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db := dbFrom(c)
+		scheme, raw, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+		raw = strings.TrimSpace(raw)
+		if !strings.EqualFold(scheme, "Bearer") || raw == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="admin"`)
+			c.AbortWithStatusJSON(401, gin.H{"error": "Admin token required"})
+			return
+		}
+
+		var token AdminToken
+		if err := db.Where("token_hash = ? AND revoked_at IS NULL", hashAdminToken(raw)).First(&token).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.Header("WWW-Authenticate", `Bearer realm="admin", error="invalid_token"`)
+				c.AbortWithStatusJSON(401, gin.H{"error": "Invalid or revoked admin token"})
+				return
+			}
+			c.AbortWithStatusJSON(500, gin.H{"error": "Failed to check admin token: " + err.Error()})
+			return
+		}
+
+		now := time.Now()
+		db.Model(&token).UpdateColumn("last_used_at", now)
+		token.LastUsedAt = &now
+		c.Set(adminTokenContextKey, token)
+
+		required := RoleEditor
+		if c.Request.Method == "GET" || c.Request.Method == "HEAD" {
+			required = RoleViewer
+		}
+		if !hasRole(c, required) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "This action requires the " + required + " role"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireRole rejects requests whose admin token lacks the given role. It
+// must run after adminAuth.
+func requireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasRole(c, role) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "This action requires the " + role + " role"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func hasRole(c *gin.Context, role string) bool {
+	value, ok := c.Get(adminTokenContextKey)
+	if !ok {
+		return false
+	}
+	token := value.(AdminToken)
+	return roleRank[token.Role] >= roleRank[role]
+}
+
+func handleAdminListTokens(c *gin.Context) {
+	db := dbFrom(c)
+	var tokens []AdminToken
+	if err := db.Order("id ASC").Find(&tokens).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch admin tokens: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    tokens,
+	})
+}
+
+func handleAdminCreateToken(c *gin.Context) {
+	db := dbFrom(c)
+	var req struct {
+		Name string `json:"name"`
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+
+	if err := validateAdminToken(req.Name, req.Role); err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	record, token, err := createAdminToken(db, req.Name, req.Role)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create admin token: " + err.Error()})
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"success": true,
+		"id":      record.ID,
+		"data":    record,
+		"token":   token,
+		"message": "Store this token now; it cannot be shown again",
+	})
+}
+
+func handleAdminRevokeToken(c *gin.Context) {
+	db := dbFrom(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid token id"})
+		return
+	}
+
+	token, err := revokeAdminToken(db, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(404, gin.H{"error": "Admin token not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to revoke admin token: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    token,
+		"message": "Admin token revoked successfully",
+	})
+}
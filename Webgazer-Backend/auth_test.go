@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuth(t *testing.T) {
+	s := newTestServer(t)
+	viewer := s.adminToken(RoleViewer)
+	editor := s.adminToken(RoleEditor)
+	owner := s.adminToken(RoleOwner)
+
+	revokedToken, revoked, err := createAdminToken(s.db, "revoked", RoleOwner)
+	if err != nil {
+		t.Fatalf("createAdminToken: %v", err)
+	}
+	if _, err := revokeAdminToken(s.db, revokedToken.ID); err != nil {
+		t.Fatalf("revokeAdminToken: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		method, path string
+		token        string
+		body         interface{}
+		want         int
+	}{
+		{"no token", "GET", "/api/admin/sessions", "", nil, 401},
+		{"unknown token", "GET", "/api/admin/sessions", "not-a-token", nil, 401},
+		{"revoked token", "GET", "/api/admin/sessions", revoked, nil, 401},
+		{"viewer reads", "GET", "/api/admin/sessions", viewer, nil, 200},
+		{"viewer writes", "POST", "/api/admin/passage", viewer, "{", 403},
+		// Past authentication, the handler rejects the body
+		{"editor writes", "POST", "/api/admin/passage", editor, "{", 400},
+		{"editor lists tokens", "GET", "/api/admin/tokens", editor, nil, 403},
+		{"editor erases", "POST", "/api/admin/participants/1/erase", editor, nil, 403},
+		{"owner lists tokens", "GET", "/api/admin/tokens", owner, nil, 200},
+		{"owner erases", "POST", "/api/admin/participants/1/erase", owner, "{}", 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, response := s.do(tt.method, tt.path, tt.token, tt.body); status != tt.want {
+				t.Errorf("status = %d, want %d (response %v)", status, tt.want, response)
+			}
+		})
+	}
+}
+
+func TestAdminAuthBasicScheme(t *testing.T) {
+	s := newTestServer(t)
+	owner := s.adminToken(RoleOwner)
+
+	// Tokens are only accepted with the Bearer scheme
+	req := httptest.NewRequest("GET", "/api/admin/sessions", nil)
+	req.Header.Set("Authorization", "Basic "+owner)
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	if w.Code != 401 {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Error("no WWW-Authenticate header")
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Page sizes of the admin session and participant lists
+const (
+	browseDefaultLimit = 50
+	browseMaxLimit     = 500
+)
+
+// parsePagination reads the limit and offset query parameters
+func parsePagination(c *gin.Context) (int, int, error) {
+	limit, offset := browseDefaultLimit, 0
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > browseMaxLimit {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", browseMaxLimit)
+		}
+		limit = n
+	}
+	if value := c.Query("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, errors.New("offset must be a non-negative integer")
+		}
+		offset = n
+	}
+	return limit, offset, nil
+}
+
+// queryList splits a comma-separated query parameter
+func queryList(c *gin.Context, name string) []string {
+	var values []string
+	for _, v := range strings.Split(c.Query(name), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// filterSessionProgress restricts a session query by the status and
+// preferred_font_type query parameters
+func filterSessionProgress(c *gin.Context, query *gorm.DB) (*gorm.DB, error) {
+	if statuses := queryList(c, "status"); len(statuses) > 0 {
+		for _, s := range statuses {
+			if _, ok := sessionTransitions[s]; !ok {
+				return nil, fmt.Errorf("unknown status %q", s)
+			}
+		}
+		query = query.Where("study_sessions.status IN ?", statuses)
+	}
+	if font := c.Query("preferred_font_type"); font != "" {
+		if font != "serif" && font != "sans" {
+			return nil, errors.New("preferred_font_type must be serif or sans")
+		}
+		query = query.Where("study_sessions.preferred_font_type = ?", font)
+	}
+	return query, nil
+}
+
+// browseSessionQuery returns a query for the sessions matching the export
+// filters (version, from, to, source), the status and preferred_font_type
+// filters and the participant_id query parameter
+func browseSessionQuery(c *gin.Context) (*gorm.DB, error) {
+	db := dbFrom(c)
+	filter, err := parseExportFilter(c)
+	if err != nil {
+		return nil, err
+	}
+	query, err := filterSessionProgress(c, filter.sessionQuery(db))
+	if err != nil {
+		return nil, err
+	}
+	if value := c.Query("participant_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid participant_id %q", value)
+		}
+		query = query.Where("study_sessions.participant_id = ?", id)
+	}
+	return query, nil
+}
+
+// adminSessionRow is a session in the admin list, with its data quality
+// and whether its study's exclusion rules exclude it
+type adminSessionRow struct {
+	StudySession
+	Quality          sessionQuality `json:"quality"`
+	Excluded         bool           `json:"excluded"`
+	ExclusionReasons []string       `json:"exclusion_reasons"`
+}
+
+// handleAdminSessions lists sessions, newest first, with their participant,
+// quality summary and exclusion
+func handleAdminSessions(c *gin.Context) {
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+	query, err := browseSessionQuery(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to count sessions: " + err.Error()})
+		return
+	}
+	var sessions []StudySession
+	if err := query.Preload("Participant").Order("study_sessions.id DESC").Limit(limit).Offset(offset).Find(&sessions).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch sessions: " + err.Error()})
+		return
+	}
+
+	evaluator := newExclusionEvaluator(dbFrom(c))
+	rows := make([]adminSessionRow, len(sessions))
+	for i, s := range sessions {
+		quality, err := evaluator.quality.check(s)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to check quality of session %d: %v", s.ID, err)})
+			return
+		}
+		rules, err := evaluator.rulesFor(s)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate exclusion rules of session %d: %v", s.ID, err)})
+			return
+		}
+		exclusion := evaluateExclusionRules(rules, s, quality)
+		rows[i] = adminSessionRow{
+			StudySession:     s,
+			Quality:          quality,
+			Excluded:         exclusion.Excluded,
+			ExclusionReasons: exclusion.Reasons,
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    rows,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// gazeSummary counts a session's gaze points without loading them
+type gazeSummary struct {
+	Total          int64            `json:"total"`
+	ByPanel        map[string]int64 `json:"by_panel"` // "" for points outside a panel
+	ByPhase        map[string]int64 `json:"by_phase"` // "" for points without a phase
+	FirstTimestamp *time.Time       `json:"first_timestamp"`
+	LastTimestamp  *time.Time       `json:"last_timestamp"`
+}
+
+func summarizeGaze(db *gorm.DB, sessionID uint) (gazeSummary, error) {
+	summary := gazeSummary{ByPanel: map[string]int64{}, ByPhase: map[string]int64{}}
+
+	var groups []struct {
+		Panel string
+		Phase string
+		Count int64
+	}
+	err := db.Model(&GazePoint{}).Select("panel, phase, COUNT(*) AS count").
+		Where("session_id = ?", sessionID).Group("panel, phase").Scan(&groups).Error
+	if err != nil {
+		return summary, err
+	}
+	for _, g := range groups {
+		summary.Total += g.Count
+		summary.ByPanel[g.Panel] += g.Count
+		summary.ByPhase[g.Phase] += g.Count
+	}
+	if summary.Total == 0 {
+		return summary, nil
+	}
+
+	var first, last GazePoint
+	if err := db.Where("session_id = ?", sessionID).Order("timestamp ASC, id ASC").First(&first).Error; err != nil {
+		return summary, err
+	}
+	if err := db.Where("session_id = ?", sessionID).Order("timestamp DESC, id DESC").First(&last).Error; err != nil {
+		return summary, err
+	}
+	summary.FirstTimestamp = &first.Timestamp
+	summary.LastTimestamp = &last.Timestamp
+	return summary, nil
+}
+
+// handleAdminSessionDetail returns a session with its participant,
+// calibration data, accuracy measurements, quiz responses and reading
+// events, and a summary of its gaze points
+func handleAdminSessionDetail(c *gin.Context) {
+	db := dbFrom(c)
+	var session StudySession
+	if !findSession(c, &session) {
+		return
+	}
+
+	err := db.Preload("Participant").
+		Preload("CalibrationData", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("timestamp ASC, id ASC")
+		}).
+		Preload("AccuracyMeasurements", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("timestamp ASC, id ASC")
+		}).
+		Preload("AccuracyMeasurements.Targets", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("\"index\" ASC")
+		}).
+		Preload("QuizResponses", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("timestamp ASC, id ASC")
+		}).
+		Preload("ReadingEvents", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("timestamp ASC, id ASC")
+		}).
+		First(&session, session.ID).Error
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch session: " + err.Error()})
+		return
+	}
+
+	gaze, err := summarizeGaze(db, session.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to summarize gaze points: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    session,
+		"gaze":    gaze,
+	})
+}
+
+// participantListRow is a participant with counts of their sessions
+type participantListRow struct {
+	Participant
+	Sessions          int64 `json:"sessions"`
+	CompletedSessions int64 `json:"completed_sessions"`
+}
+
+// handleAdminParticipants lists participants, newest first. The from, to,
+// source and platform parameters filter the participants themselves; the
+// version, status and preferred_font_type parameters keep participants
+// with at least one matching session.
+func handleAdminParticipants(c *gin.Context) {
+	db := dbFrom(c)
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := db.Model(&Participant{})
+	if from := c.Query("from"); from != "" {
+		t, err := parseExportTime(from, false)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseExportTime(to, true)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("created_at < ?", t)
+	}
+	if sources := queryList(c, "source"); len(sources) > 0 {
+		query = query.Where("source IN ?", sources)
+	}
+	if platform := c.Query("platform"); platform != "" {
+		query = query.Where("platform = ?", platform)
+	}
+
+	if c.Query("version") != "" || c.Query("status") != "" || c.Query("preferred_font_type") != "" {
+		sessions := db.Model(&StudySession{})
+		if version := c.Query("version"); version != "" {
+			var studyText StudyText
+			if err := db.Where("version = ?", version).First(&studyText).Error; err != nil {
+				c.JSON(400, gin.H{"error": fmt.Sprintf("study text version %q not found", version)})
+				return
+			}
+			sessions = sessions.Where("study_sessions.study_text_id = ?", studyText.ID)
+		}
+		sessions, err := filterSessionProgress(c, sessions)
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("id IN (?)", sessions.Select("study_sessions.participant_id"))
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to count participants: " + err.Error()})
+		return
+	}
+	var participants []Participant
+	if err := query.Order("id DESC").Limit(limit).Offset(offset).Find(&participants).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch participants: " + err.Error()})
+		return
+	}
+
+	ids := make([]uint, len(participants))
+	for i, p := range participants {
+		ids[i] = p.ID
+	}
+	var counts []struct {
+		ParticipantID uint
+		Sessions      int64
+		Completed     int64
+	}
+	if len(ids) > 0 {
+		err := db.Model(&StudySession{}).
+			Select("participant_id, COUNT(*) AS sessions, SUM(CASE WHEN status = ? THEN 1 ELSE 0 END) AS completed", SessionStatusCompleted).
+			Where("participant_id IN ?", ids).Group("participant_id").Scan(&counts).Error
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to count sessions: " + err.Error()})
+			return
+		}
+	}
+	rows := make([]participantListRow, len(participants))
+	for i, p := range participants {
+		rows[i] = participantListRow{Participant: p}
+	}
+	rowIndex := make(map[uint]int, len(rows))
+	for i, row := range rows {
+		rowIndex[row.ID] = i
+	}
+	for _, count := range counts {
+		row := &rows[rowIndex[count.ParticipantID]]
+		row.Sessions = count.Sessions
+		row.CompletedSessions = count.Completed
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    rows,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+const commandUsage = `Usage: readability-backend [--config <file>] [command]
+
+Without a command, starts the API server. Settings are read from the YAML
+config file (--config, or CONFIG_FILE) and environment variables, which
+override the file; see config.example.yaml.
+
+Commands:
+  token create --name <name> [--role viewer|editor|owner]   Create an admin API token
+  token list                                                List admin API tokens
+  token revoke <id>                                         Revoke an admin API token
+  migrate status                                            List migrations and whether they are applied
+  migrate up [--to <version>]                               Apply pending migrations (the server does this at startup)
+  migrate down [--steps <n>] [--drop-all-data]              Revert the latest applied migrations (default 1);
+                                                            migration 1 drops all data and needs --drop-all-data
+  config print                                              Print the effective configuration
+`
+
+// runCommand runs a command-line subcommand against the configured database
+func runCommand(cfg Config, args []string) error {
+	switch args[0] {
+	case "token":
+		return runTokenCommand(cfg, args[1:])
+	case "migrate":
+		return runMigrateCommand(cfg, args[1:])
+	case "config":
+		return runConfigCommand(cfg, args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(commandUsage)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, commandUsage)
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func runTokenCommand(cfg Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, commandUsage)
+		return errors.New("token requires a subcommand")
+	}
+
+	store, err := initStore(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	db := store.DB()
+
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("token create", flag.ContinueOnError)
+		name := flags.String("name", "", "who or what the token is for")
+		role := flags.String("role", RoleOwner, "viewer, editor or owner")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		record, token, err := createAdminToken(db, *name, *role)
+		if err != nil {
+			return err
+		}
+		// Only the token goes to stdout, so it can be captured by scripts
+		fmt.Fprintf(os.Stderr, "Created %s token %d for %q. Store it now; it cannot be shown again.\n", record.Role, record.ID, record.Name)
+		fmt.Println(token)
+		return nil
+
+	case "list":
+		var tokens []AdminToken
+		if err := db.Order("id ASC").Find(&tokens).Error; err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tROLE\tPREFIX\tCREATED\tLAST USED\tREVOKED")
+		for _, t := range tokens {
+			lastUsed, revoked := "-", "-"
+			if t.LastUsedAt != nil {
+				lastUsed = t.LastUsedAt.Format("2006-01-02 15:04")
+			}
+			if t.RevokedAt != nil {
+				revoked = t.RevokedAt.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Role, t.Prefix, t.CreatedAt.Format("2006-01-02 15:04"), lastUsed, revoked)
+		}
+		return w.Flush()
+
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New("usage: token revoke <id>")
+		}
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid token id %q", args[1])
+		}
+		token, err := revokeAdminToken(db, uint(id))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("token %d not found", id)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Revoked token %d (%s)\n", token.ID, token.Name)
+		return nil
+	}
+
+	fmt.Fprint(os.Stderr, commandUsage)
+	return fmt.Errorf("unknown token subcommand %q", args[0])
+}
+
+func runMigrateCommand(cfg Config, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, commandUsage)
+		return errors.New("migrate requires a subcommand")
+	}
+
+	// Opened without initStore, which would apply the pending migrations
+	store, err := openStore(cfg.Database.Driver, cfg.Database.URL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	db := store.DB()
+
+	switch args[0] {
+	case "status":
+		states, err := migrationStatus(db)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04")
+			}
+			if s.Unknown {
+				applied += " (unknown to this version)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+
+	case "up":
+		flags := flag.NewFlagSet("migrate up", flag.ContinueOnError)
+		to := flags.Int("to", 0, "apply migrations up to and including this version (default all)")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		applied, err := migrateUp(db, *to)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+		return nil
+
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		dropAllData := flags.Bool("drop-all-data", false, "allow reverting migration 1, which drops every table and all the data in them")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return errors.New("--steps must be at least 1")
+		}
+		reverted, err := migrateDown(db, *steps, *dropAllData)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migration(s)\n", len(reverted))
+		return nil
+	}
+
+	fmt.Fprint(os.Stderr, commandUsage)
+	return fmt.Errorf("unknown migrate subcommand %q", args[0])
+}
+
+func runConfigCommand(cfg Config, args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		fmt.Fprint(os.Stderr, commandUsage)
+		return errors.New("usage: config print")
+	}
+	// The output is a valid config file; the database password is hidden
+	out, err := yaml.Marshal(cfg.redacted())
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
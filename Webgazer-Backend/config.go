@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileEnv names the config file when --config is not given
+const configFileEnv = "CONFIG_FILE"
+
+// Config is the server configuration. It is read from a YAML file, then
+// environment variables override individual settings (see applyEnv), so one
+// file can be shared between deployments that differ in a few values.
+type Config struct {
+	Server     serverSettings     `yaml:"server"`
+	Database   databaseSettings   `yaml:"database"`
+	CORS       corsSettings       `yaml:"cors"`
+	Seed       seedSettings       `yaml:"seed"`
+	Validation validationSettings `yaml:"validation"`
+	Platform   platformSettings   `yaml:"platform"`
+}
+
+type serverSettings struct {
+	Port           string   `yaml:"port"`
+	TrustedProxies []string `yaml:"trusted_proxies"` // IPs or CIDRs whose X-Forwarded-For is trusted; none by default
+}
+
+type databaseSettings struct {
+	Driver string `yaml:"driver"` // sqlite or postgres
+	URL    string `yaml:"url"`    // SQLite file or PostgreSQL connection string
+}
+
+type corsSettings struct {
+	AllowOrigins []string `yaml:"allow_origins"` // Frontend origins; also checked on gaze stream WebSockets
+	AllowMethods []string `yaml:"allow_methods"`
+	AllowHeaders []string `yaml:"allow_headers"`
+}
+
+type seedSettings struct {
+	DefaultStudyText bool `yaml:"default_study_text"` // Create the default study text when there is none
+}
+
+// defaultConfig returns the configuration used when neither a config file
+// nor environment variables set a value
+func defaultConfig() Config {
+	return Config{
+		Server: serverSettings{
+			Port: "8080",
+		},
+		Database: databaseSettings{
+			Driver: defaultDriver,
+			URL:    defaultDSN,
+		},
+		CORS: corsSettings{
+			AllowOrigins: []string{"http://localhost:5173", "http://localhost:4173", "http://localhost:3000"},
+			AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowHeaders: []string{"Content-Type", "Authorization"},
+		},
+		Seed: seedSettings{
+			DefaultStudyText: true,
+		},
+		Validation: validationSettings{
+			MaxErrorDeg:       5,
+			ViewingDistanceCM: 60,
+			PixelsPerCM:       96 / 2.54,
+		},
+		Platform: platformSettings{
+			ProlificCompletionURL: "https://app.prolific.com/submissions/complete",
+			MTurkSubmitOrigins:    []string{"https://www.mturk.com", "https://workersandbox.mturk.com"},
+		},
+	}
+}
+
+// loadConfig reads the config file at path (CONFIG_FILE if path is empty;
+// the defaults if both are empty), applies the environment overrides and
+// validates the result
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		path = os.Getenv(configFileEnv)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	if err := errors.Join(cfg.applyEnv(), cfg.validate()); err != nil {
+		return cfg, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides settings with the environment variables that are set
+func (cfg *Config) applyEnv() error {
+	envString(&cfg.Server.Port, "PORT")
+	envList(&cfg.Server.TrustedProxies, "TRUSTED_PROXIES")
+	envString(&cfg.Database.Driver, "DB_DRIVER")
+	envString(&cfg.Database.URL, "DATABASE_URL")
+	envList(&cfg.CORS.AllowOrigins, "CORS_ALLOW_ORIGINS")
+	envList(&cfg.CORS.AllowMethods, "CORS_ALLOW_METHODS")
+	envList(&cfg.CORS.AllowHeaders, "CORS_ALLOW_HEADERS")
+	envString(&cfg.Platform.ProlificCompletionURL, "PROLIFIC_COMPLETION_URL")
+	envList(&cfg.Platform.MTurkSubmitOrigins, "MTURK_SUBMIT_ORIGINS")
+	return errors.Join(
+		envBool(&cfg.Seed.DefaultStudyText, "SEED_DEFAULT_STUDY_TEXT"),
+		envFloat(&cfg.Validation.MaxErrorDeg, "VALIDATION_MAX_ERROR_DEG"),
+		envFloat(&cfg.Validation.ViewingDistanceCM, "VALIDATION_VIEWING_DISTANCE_CM"),
+		envFloat(&cfg.Validation.PixelsPerCM, "VALIDATION_PIXELS_PER_CM"),
+	)
+}
+
+// envString sets *value to the environment variable name, if it is set
+func envString(value *string, name string) {
+	if v := os.Getenv(name); v != "" {
+		*value = v
+	}
+}
+
+// envList sets *values to the comma-separated values of the environment
+// variable name, if it is set
+func envList(values *[]string, name string) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	*values = nil
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*values = append(*values, item)
+		}
+	}
+}
+
+// envBool sets *value to the boolean in the environment variable name, if
+// it is set
+func envBool(value *bool, name string) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("%s must be true or false, not %q", name, v)
+	}
+	*value = b
+	return nil
+}
+
+// envFloat sets *value to the number in the environment variable name, if
+// it is set
+func envFloat(value *float64, name string) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("%s must be a number, not %q", name, v)
+	}
+	*value = f
+	return nil
+}
+
+// validate reports every invalid setting
+func (cfg Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(cfg.Server.Port)
+	check(err == nil && port >= 1 && port <= 65535, "server.port must be a port number, not %q", cfg.Server.Port)
+	for _, proxy := range cfg.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(net.ParseIP(proxy) != nil || cidrErr == nil, "server.trusted_proxies: %q is not an IP address or CIDR", proxy)
+	}
+
+	check(cfg.Database.Driver == DriverSQLite || cfg.Database.Driver == DriverPostgres,
+		"database.driver must be %s or %s, not %q", DriverSQLite, DriverPostgres, cfg.Database.Driver)
+	check(cfg.Database.URL != "", "database.url is required")
+
+	check(len(cfg.CORS.AllowOrigins) > 0, "cors.allow_origins must list at least one origin")
+	for _, origin := range cfg.CORS.AllowOrigins {
+		check(validOrigin(origin), "cors.allow_origins: %q is not an origin like https://study.example.org", origin)
+	}
+	check(len(cfg.CORS.AllowMethods) > 0, "cors.allow_methods must list at least one method")
+	for _, method := range cfg.CORS.AllowMethods {
+		check(method != "" && method == strings.ToUpper(method) && !strings.ContainsAny(method, " ,"),
+			"cors.allow_methods: %q is not an HTTP method", method)
+	}
+	for _, header := range cfg.CORS.AllowHeaders {
+		check(header != "" && !strings.ContainsAny(header, " ,:"), "cors.allow_headers: %q is not a header name", header)
+	}
+
+	for _, setting := range []struct {
+		name  string
+		value float64
+	}{
+		{"validation.max_error_deg", cfg.Validation.MaxErrorDeg},
+		{"validation.viewing_distance_cm", cfg.Validation.ViewingDistanceCM},
+		{"validation.pixels_per_cm", cfg.Validation.PixelsPerCM},
+	} {
+		check(setting.value > 0 && !math.IsInf(setting.value, 0), "%s must be a positive number", setting.name)
+	}
+
+	completion, err := url.Parse(cfg.Platform.ProlificCompletionURL)
+	check(err == nil && (completion.Scheme == "http" || completion.Scheme == "https") && completion.Host != "",
+		"platform.prolific_completion_url must be an http(s) URL, not %q", cfg.Platform.ProlificCompletionURL)
+	for _, origin := range cfg.Platform.MTurkSubmitOrigins {
+		check(validOrigin(origin), "platform.mturk_submit_origins: %q is not an origin like https://www.mturk.com", origin)
+	}
+	return errors.Join(errs...)
+}
+
+// validOrigin reports whether origin is a scheme and host without a path,
+// as browsers send in the Origin header
+func validOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+}
+
+// applyConfig makes cfg the configuration of the settings read by the
+// handlers
+func applyConfig(cfg Config) {
+	corsAllowOrigins = cfg.CORS.AllowOrigins
+	validationConfig = cfg.Validation
+	platformConfig = cfg.Platform
+}
+
+// dsnPassword matches the password of a key=value PostgreSQL connection string
+var dsnPassword = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// redacted returns cfg with the database password hidden, for printing
+func (cfg Config) redacted() Config {
+	if u, err := url.Parse(cfg.Database.URL); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			cfg.Database.URL = u.Redacted()
+		}
+	}
+	cfg.Database.URL = dsnPassword.ReplaceAllString(cfg.Database.URL, "${1}xxxxx")
+	return cfg
+}
@@ -0,0 +1,480 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errConsentFormExists = errors.New("consent form version already exists")
+
+// consentItem is a statement on a consent form the participant agrees to
+// or not, e.g. "I agree to my anonymized data being shared". Participants
+// must agree to required items to take part.
+type consentItem struct {
+	ID       string `json:"id"`
+	Text     string `json:"text"`
+	Required bool   `json:"required"`
+}
+
+// consentFormView is a consent form with its items decoded
+type consentFormView struct {
+	ConsentForm
+	Items []consentItem `json:"items"`
+}
+
+func (f ConsentForm) items() []consentItem {
+	items := []consentItem{}
+	json.Unmarshal([]byte(f.Items), &items)
+	return items
+}
+
+func (f ConsentForm) view() consentFormView {
+	return consentFormView{ConsentForm: f, Items: f.items()}
+}
+
+// consentRecordView is a consent record with its choices decoded
+type consentRecordView struct {
+	ConsentRecord
+	Choices     map[string]bool `json:"choices"`
+	Participant *Participant    `json:"participant,omitempty"`
+}
+
+func (r ConsentRecord) view() consentRecordView {
+	choices := map[string]bool{}
+	json.Unmarshal([]byte(r.Choices), &choices)
+	return consentRecordView{ConsentRecord: r, Choices: choices}
+}
+
+// validateConsentItems returns an error message if items do not have
+// unique, non-empty IDs and texts
+func validateConsentItems(items []consentItem) string {
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		if item.ID == "" || item.Text == "" {
+			return fmt.Sprintf("items[%d]: id and text are required", i)
+		}
+		if seen[item.ID] {
+			return fmt.Sprintf("items[%d]: duplicate id %q", i, item.ID)
+		}
+		seen[item.ID] = true
+	}
+	return ""
+}
+
+// hasValidConsent reports whether a participant may take part in a study
+// text: the study text has no consent form, or the participant's latest
+// answer to one of its forms gave consent
+func hasValidConsent(tx *gorm.DB, participantID, studyTextID uint) (bool, error) {
+	var forms int64
+	if err := tx.Model(&ConsentForm{}).Where("study_text_id = ?", studyTextID).Count(&forms).Error; err != nil {
+		return false, err
+	}
+	if forms == 0 {
+		return true, nil
+	}
+
+	var record ConsentRecord
+	err := tx.Where("participant_id = ? AND study_text_id = ?", participantID, studyTextID).
+		Order("created_at DESC, id DESC").First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return record.Consented, nil
+}
+
+// requireConsent checks that the participant of a session has consented
+// to the session's study text, writing an error response and returning
+// false if they have not. Sessions without a study text belong to the
+// active one.
+func requireConsent(c *gin.Context, session StudySession) bool {
+	db := dbFrom(c)
+	studyTextID, err := quizStudyTextID(db, session)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return true
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check consent: " + err.Error()})
+		return false
+	}
+
+	consented, err := hasValidConsent(db, session.ParticipantID, studyTextID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check consent: " + err.Error()})
+		return false
+	}
+	if !consented {
+		c.JSON(403, gin.H{"error": "Participant has not consented to this study"})
+		return false
+	}
+	return true
+}
+
+// requireSessionConsent loads a session by ID and checks its participant's
+// consent, writing an error response and returning false if either fails
+func requireSessionConsent(c *gin.Context, sessionID uint) bool {
+	db := dbFrom(c)
+	var session StudySession
+	if err := db.First(&session, sessionID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return false
+	}
+	return requireConsent(c, session)
+}
+
+// handleConsentForm returns the active consent form of the requested study
+// text (study_text_id or version), or of the active study text
+func handleConsentForm(c *gin.Context) {
+	db := dbFrom(c)
+	var studyText StudyText
+	query := db.Where("active = ?", true)
+	if id := c.Query("study_text_id"); id != "" {
+		query = db.Where("id = ?", id)
+	} else if version := c.Query("version"); version != "" {
+		query = db.Where("version = ?", version)
+	}
+	if err := query.Select("id").First(&studyText).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Study text not found"})
+		return
+	}
+
+	var form ConsentForm
+	if err := db.Where("study_text_id = ? AND active = ?", studyText.ID, true).Order("id DESC").First(&form).Error; err != nil {
+		c.JSON(404, gin.H{"error": "No consent form for this study"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    form.view(),
+	})
+}
+
+// consentRequest is the body of POST /api/consent
+type consentRequest struct {
+	ParticipantID uint            `json:"participant_id"`
+	ConsentFormID uint            `json:"consent_form_id"`
+	Agree         bool            `json:"agree"`   // Agreement to the consent text
+	Choices       map[string]bool `json:"choices"` // Answer to each item of the form
+	UserAgent     string          `json:"user_agent"`
+}
+
+// handleConsent records a participant's answer to a consent form. Declined
+// consent is recorded too, so the audit trail shows every answer.
+func handleConsent(c *gin.Context) {
+	db := dbFrom(c)
+	var req consentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if req.ParticipantID == 0 || req.ConsentFormID == 0 {
+		c.JSON(400, gin.H{"error": "participant_id and consent_form_id are required"})
+		return
+	}
+
+	var participant Participant
+	if err := db.Select("id").First(&participant, req.ParticipantID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Participant not found"})
+		return
+	}
+	var form ConsentForm
+	if err := db.First(&form, req.ConsentFormID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Consent form not found"})
+		return
+	}
+	// Only the version currently shown to participants can be answered
+	if !form.Active {
+		c.JSON(409, gin.H{"error": "Consent form is not the active version for this study; fetch the current form and answer it"})
+		return
+	}
+
+	// Every item is answered; unanswered items count as not agreed to
+	items := form.items()
+	choices := make(map[string]bool, len(items))
+	known := make(map[string]bool, len(items))
+	consented := req.Agree
+	for _, item := range items {
+		known[item.ID] = true
+		choices[item.ID] = req.Choices[item.ID]
+		if item.Required && !choices[item.ID] {
+			consented = false
+		}
+	}
+	for id := range req.Choices {
+		if !known[id] {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Unknown consent item %q", id)})
+			return
+		}
+	}
+	choicesJSON, err := json.Marshal(choices)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to save consent: " + err.Error()})
+		return
+	}
+
+	record := ConsentRecord{
+		ParticipantID: participant.ID,
+		ConsentFormID: form.ID,
+		StudyTextID:   form.StudyTextID,
+		FormVersion:   form.Version,
+		Consented:     consented,
+		Choices:       string(choicesJSON),
+		UserAgent:     req.UserAgent,
+	}
+	if err := db.Omit("Participant").Create(&record).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to save consent: " + err.Error()})
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"success":   true,
+		"id":        record.ID,
+		"consented": record.Consented,
+	})
+}
+
+// handleAdminConsentForm manages the consent form versions of study texts.
+// Forms cannot be edited, only activated or deactivated; forms that have
+// been answered cannot be deleted.
+func handleAdminConsentForm(c *gin.Context) {
+	db := dbFrom(c)
+	switch c.Request.Method {
+	case "GET":
+		// List the forms of a study text (or all), or get one form by ID
+		if id := c.Query("id"); id != "" {
+			var form ConsentForm
+			if err := db.First(&form, id).Error; err != nil {
+				c.JSON(404, gin.H{"error": "Consent form not found"})
+				return
+			}
+			c.JSON(200, gin.H{"success": true, "data": form.view()})
+			return
+		}
+
+		query := db.Order("study_text_id ASC, id ASC")
+		if studyTextID := c.Query("study_text_id"); studyTextID != "" {
+			query = query.Where("study_text_id = ?", studyTextID)
+		}
+		var forms []ConsentForm
+		if err := query.Find(&forms).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to fetch consent forms: " + err.Error()})
+			return
+		}
+		views := make([]consentFormView, len(forms))
+		for i, f := range forms {
+			views[i] = f.view()
+		}
+		c.JSON(200, gin.H{
+			"success": true,
+			"data":    views,
+		})
+
+	case "POST":
+		var formData struct {
+			StudyTextID uint          `json:"study_text_id"`
+			Version     string        `json:"version"`
+			Content     string        `json:"content"`
+			Items       []consentItem `json:"items"`
+			Active      *bool         `json:"active"`
+		}
+		if err := c.ShouldBindJSON(&formData); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+			return
+		}
+		if formData.StudyTextID == 0 || formData.Version == "" || formData.Content == "" {
+			c.JSON(400, gin.H{"error": "study_text_id, version, and content are required"})
+			return
+		}
+		if msg := validateConsentItems(formData.Items); msg != "" {
+			c.JSON(400, gin.H{"error": msg})
+			return
+		}
+		var studyText StudyText
+		if err := db.Select("id").First(&studyText, formData.StudyTextID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Study text not found"})
+			return
+		}
+
+		if formData.Items == nil {
+			formData.Items = []consentItem{}
+		}
+		itemsJSON, err := json.Marshal(formData.Items)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "Invalid items format: " + err.Error()})
+			return
+		}
+		form := ConsentForm{
+			StudyTextID: formData.StudyTextID,
+			Version:     formData.Version,
+			Content:     formData.Content,
+			Items:       string(itemsJSON),
+			Active:      formData.Active == nil || *formData.Active,
+		}
+
+		// New participants see only one version of a study text's form
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var existing int64
+			if err := tx.Model(&ConsentForm{}).Where("study_text_id = ? AND version = ?", form.StudyTextID, form.Version).Count(&existing).Error; err != nil {
+				return err
+			}
+			if existing > 0 {
+				return errConsentFormExists
+			}
+			if form.Active {
+				if err := tx.Model(&ConsentForm{}).Where("study_text_id = ?", form.StudyTextID).Update("active", false).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&form).Error
+		})
+		if errors.Is(err, errConsentFormExists) {
+			c.JSON(409, gin.H{"error": fmt.Sprintf("Consent form version '%s' already exists for this study text", form.Version)})
+			return
+		}
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to create consent form: " + err.Error()})
+			return
+		}
+
+		c.JSON(201, gin.H{
+			"success": true,
+			"id":      form.ID,
+			"message": "Consent form created successfully",
+		})
+
+	case "PUT":
+		var updateData struct {
+			ID     uint  `json:"id"`
+			Active *bool `json:"active"`
+		}
+		if err := c.ShouldBindJSON(&updateData); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+			return
+		}
+		if updateData.ID == 0 || updateData.Active == nil {
+			c.JSON(400, gin.H{"error": "id and active are required; create a new version to change a form"})
+			return
+		}
+
+		var form ConsentForm
+		if err := db.First(&form, updateData.ID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Consent form not found"})
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if *updateData.Active {
+				if err := tx.Model(&ConsentForm{}).Where("study_text_id = ? AND id != ?", form.StudyTextID, form.ID).Update("active", false).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(&form).Update("active", *updateData.Active).Error
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to update consent form: " + err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"success": true,
+			"id":      form.ID,
+			"message": "Consent form updated successfully",
+		})
+
+	case "DELETE":
+		id := c.Query("id")
+		if id == "" {
+			c.JSON(400, gin.H{"error": "ID parameter is required"})
+			return
+		}
+
+		var form ConsentForm
+		if err := db.First(&form, id).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Consent form not found"})
+			return
+		}
+		var records int64
+		if err := db.Model(&ConsentRecord{}).Where("consent_form_id = ?", form.ID).Count(&records).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to delete consent form: " + err.Error()})
+			return
+		}
+		if records > 0 {
+			c.JSON(409, gin.H{"error": "Consent form has been answered and must be kept for the audit trail; deactivate it instead"})
+			return
+		}
+		if err := db.Delete(&form).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to delete consent form: " + err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"success": true,
+			"message": "Consent form deleted successfully",
+		})
+
+	default:
+		c.JSON(405, gin.H{"error": "Method not allowed"})
+	}
+}
+
+var consentRecordCSVHeader = []string{
+	"id", "participant_id", "consent_form_id", "study_text_id", "form_version",
+	"consented", "choices", "user_agent", "created_at",
+}
+
+func (r ConsentRecord) csvRecord() []string {
+	return []string{
+		formatUint(r.ID),
+		formatUint(r.ParticipantID),
+		formatUint(r.ConsentFormID),
+		formatUint(r.StudyTextID),
+		r.FormVersion,
+		strconv.FormatBool(r.Consented),
+		r.Choices,
+		r.UserAgent,
+		formatTime(r.CreatedAt),
+	}
+}
+
+// handleAdminConsentRecords lists the consent audit trail, optionally of
+// one participant or study text, as JSON or as CSV if format=csv
+func handleAdminConsentRecords(c *gin.Context) {
+	db := dbFrom(c)
+	query := db.Order("id ASC")
+	if participantID := c.Query("participant_id"); participantID != "" {
+		query = query.Where("participant_id = ?", participantID)
+	}
+	if studyTextID := c.Query("study_text_id"); studyTextID != "" {
+		query = query.Where("study_text_id = ?", studyTextID)
+	}
+	var records []ConsentRecord
+	if err := query.Find(&records).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch consent records: " + err.Error()})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		rows := make([][]string, len(records))
+		for i, r := range records {
+			rows[i] = r.csvRecord()
+		}
+		writeCSV(c, "consent-records.csv", consentRecordCSVHeader, rows)
+		return
+	}
+
+	views := make([]consentRecordView, len(records))
+	for i, r := range records {
+		views[i] = r.view()
+	}
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    views,
+	})
+}
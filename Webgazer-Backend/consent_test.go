@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestConsent(t *testing.T) {
+	s := newTestServer(t)
+	studyText := s.studyText("consent")
+	items := `[{"id":"data","text":"My gaze data may be stored","required":true},{"id":"contact","text":"I may be contacted"}]`
+	oldForm := ConsentForm{StudyTextID: studyText.ID, Version: "1", Content: "Old consent text", Items: items}
+	form := ConsentForm{StudyTextID: studyText.ID, Version: "2", Content: "Consent text", Items: items, Active: true}
+	for _, f := range []*ConsentForm{&oldForm, &form} {
+		if err := s.db.Create(f).Error; err != nil {
+			t.Fatalf("creating consent form: %v", err)
+		}
+	}
+
+	participantID, _ := s.participant("")
+	start := gin.H{"participant_id": participantID, "study_text_id": studyText.ID}
+	consent := func(formID uint, agree bool, choices gin.H) gin.H {
+		return gin.H{"participant_id": participantID, "consent_form_id": formID, "agree": agree, "choices": choices}
+	}
+
+	// No sessions before consent
+	s.expect(403, "POST", "/api/session/start", "", start)
+
+	// Only the active form can be answered
+	s.expect(409, "POST", "/api/consent", "", consent(oldForm.ID, true, gin.H{"data": true}))
+	s.expect(400, "POST", "/api/consent", "", consent(form.ID, true, gin.H{"other": true}))
+
+	// Agreeing without a required item is not consent
+	response := s.expect(201, "POST", "/api/consent", "", consent(form.ID, true, gin.H{"contact": true}))
+	if response["consented"] != false {
+		t.Errorf("consented without required item = %v, want false", response["consented"])
+	}
+	s.expect(403, "POST", "/api/session/start", "", start)
+
+	response = s.expect(201, "POST", "/api/consent", "", consent(form.ID, true, gin.H{"data": true}))
+	if response["consented"] != true {
+		t.Errorf("consented = %v, want true", response["consented"])
+	}
+	sessionID := s.startSession(participantID, studyText.ID)
+	s.expect(200, "PATCH", "/api/session/"+sessionID, "", gin.H{"status": SessionStatusCalibrating})
+
+	// The latest answer counts: after withdrawing consent the session can
+	// only be abandoned
+	s.expect(201, "POST", "/api/consent", "", consent(form.ID, false, nil))
+	s.expect(403, "PATCH", "/api/session/"+sessionID, "", gin.H{"status": SessionStatusValidating})
+	s.expect(200, "PATCH", "/api/session/"+sessionID, "", gin.H{"status": SessionStatusAbandoned})
+
+	if n := s.count(&ConsentRecord{}, "participant_id = ?", participantID); n != 3 {
+		t.Errorf("consent records = %d, want 3", n)
+	}
+}
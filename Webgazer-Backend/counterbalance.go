@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// passageAssignment is the position and fonts a session shows a passage with
+type passageAssignment struct {
+	PassageID uint   `json:"passage_id"`
+	Order     int    `json:"order"`
+	FontLeft  string `json:"font_left"`
+	FontRight string `json:"font_right"`
+}
+
+// balancedLatinSquare returns a Williams design for n conditions: every
+// condition appears once in every position and follows every other
+// condition equally often. Odd n needs the mirrored rows as well, giving 2n
+// rows instead of n.
+func balancedLatinSquare(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+
+	// First row: 0, 1, n-1, 2, n-2, ...
+	first := make([]int, n)
+	for j, lo, hi := 1, 1, n-1; j < n; j++ {
+		if j%2 == 1 {
+			first[j] = lo
+			lo++
+		} else {
+			first[j] = hi
+			hi--
+		}
+	}
+
+	var rows [][]int
+	for r := 0; r < n; r++ {
+		row := make([]int, n)
+		for j := range first {
+			row[j] = (first[j] + r) % n
+		}
+		rows = append(rows, row)
+	}
+	if n%2 == 1 {
+		for r := 0; r < n; r++ {
+			mirrored := make([]int, n)
+			for j := range rows[r] {
+				mirrored[n-1-j] = rows[r][j]
+			}
+			rows = append(rows, mirrored)
+		}
+	}
+	return rows
+}
+
+func otherFont(font string) string {
+	if font == "serif" {
+		return "sans"
+	}
+	return "serif"
+}
+
+// counterbalanceDesign identifies the passage set cells are built from, so
+// adding or removing passages starts a fresh set of cells
+func counterbalanceDesign(passages []Passage) string {
+	ids := make([]int, len(passages))
+	for i, p := range passages {
+		ids[i] = int(p.ID)
+	}
+	sort.Ints(ids)
+
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// buildConditionCells crosses the passage orders of a balanced Latin square
+// with the two font-side patterns (serif or sans on the left first, then
+// alternating), so every passage is read in every position and with each
+// font on each side equally often
+func buildConditionCells(studyTextID uint, passages []Passage) []ConditionCell {
+	design := counterbalanceDesign(passages)
+
+	var cells []ConditionCell
+	for _, row := range balancedLatinSquare(len(passages)) {
+		order := make([]string, len(row))
+		for j, k := range row {
+			order[j] = formatUint(passages[k].ID)
+		}
+		for _, firstLeft := range []string{"serif", "sans"} {
+			cells = append(cells, ConditionCell{
+				StudyTextID:  studyTextID,
+				Design:       design,
+				Cell:         len(cells),
+				PassageOrder: strings.Join(order, ","),
+				FirstLeft:    firstLeft,
+			})
+		}
+	}
+	return cells
+}
+
+// assignments expands a cell into the per-passage order and fonts
+func (cell ConditionCell) assignments() ([]passageAssignment, error) {
+	if cell.PassageOrder == "" {
+		return []passageAssignment{}, nil
+	}
+
+	ids := strings.Split(cell.PassageOrder, ",")
+	assignments := make([]passageAssignment, len(ids))
+	left := cell.FirstLeft
+	for i, id := range ids {
+		passageID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid passage order %q: %w", cell.PassageOrder, err)
+		}
+		assignments[i] = passageAssignment{
+			PassageID: uint(passageID),
+			Order:     i,
+			FontLeft:  left,
+			FontRight: otherFont(left),
+		}
+		left = otherFont(left)
+	}
+	return assignments, nil
+}
+
+// assignCondition assigns a new session to the least-used cell of the study
+// text (lowest cell number on ties) and counts it. Concurrent assignments
+// wait for each other, so two sessions are never both given the same
+// least-used cell: SQLite transactions take the write lock up front (see
+// sqliteDSN), and PostgreSQL locks the cells with SELECT ... FOR UPDATE.
+func assignCondition(tx *gorm.DB, studyTextID uint) (ConditionCell, []passageAssignment, error) {
+	var passages []Passage
+	if err := tx.Where("study_text_id = ?", studyTextID).Order("\"order\" ASC, id ASC").Find(&passages).Error; err != nil {
+		return ConditionCell{}, nil, err
+	}
+	design := counterbalanceDesign(passages)
+
+	// The first session of a design creates its cells. Another session may
+	// be creating them at the same time, so cells that already exist are
+	// left alone rather than failing on the unique index.
+	var existing int64
+	if err := tx.Model(&ConditionCell{}).Where("study_text_id = ? AND design = ?", studyTextID, design).Count(&existing).Error; err != nil {
+		return ConditionCell{}, nil, err
+	}
+	if existing == 0 {
+		cells := buildConditionCells(studyTextID, passages)
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&cells).Error; err != nil {
+			return ConditionCell{}, nil, err
+		}
+	}
+
+	query := tx.Where("study_text_id = ? AND design = ?", studyTextID, design).Order("cell ASC")
+	if tx.Dialector.Name() == DriverPostgres {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	var cells []ConditionCell
+	if err := query.Find(&cells).Error; err != nil {
+		return ConditionCell{}, nil, err
+	}
+	if len(cells) == 0 {
+		return ConditionCell{}, nil, fmt.Errorf("no condition cells for study text %d", studyTextID)
+	}
+
+	chosen := cells[0]
+	for _, cell := range cells[1:] {
+		if cell.Count < chosen.Count {
+			chosen = cell
+		}
+	}
+
+	if err := tx.Model(&ConditionCell{}).Where("id = ?", chosen.ID).Update("count", gorm.Expr("count + 1")).Error; err != nil {
+		return ConditionCell{}, nil, err
+	}
+	chosen.Count++
+
+	assignments, err := chosen.assignments()
+	return chosen, assignments, err
+}
+
+// passageAssignments returns the counterbalanced passage order and fonts
+// recorded on the session, if any
+func (s StudySession) passageAssignments() []passageAssignment {
+	var assignments []passageAssignment
+	if s.Assignment != "" {
+		json.Unmarshal([]byte(s.Assignment), &assignments)
+	}
+	return assignments
+}
+
+// handleAdminConditionCells lists the counterbalancing cells of a study
+// text and how many sessions were assigned to each
+func handleAdminConditionCells(c *gin.Context) {
+	db := dbFrom(c)
+	query := db.Order("study_text_id ASC, design ASC, cell ASC")
+	if studyTextID := c.Query("study_text_id"); studyTextID != "" {
+		query = query.Where("study_text_id = ?", studyTextID)
+	}
+
+	var cells []ConditionCell
+	if err := query.Find(&cells).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch condition cells: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    cells,
+	})
+}
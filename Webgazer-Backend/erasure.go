@@ -0,0 +1,329 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Erasure modes. Deleting removes the participant and all their data;
+// anonymizing keeps the study data for analysis but removes what could
+// identify the participant (platform IDs, user agents, session and
+// completion codes) and their withdrawal token.
+const (
+	ErasureModeDelete    = "delete"
+	ErasureModeAnonymize = "anonymize"
+)
+
+// RequestedBy of erasures requested with the participant's withdrawal token
+const erasureByParticipant = "participant"
+
+var errInvalidErasureMode = errors.New("mode must be delete or anonymize")
+
+// generateWithdrawalToken returns a new withdrawal token and its hash, which
+// is all that is stored
+func generateWithdrawalToken() (string, string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := hex.EncodeToString(buf)
+	return token, hashWithdrawalToken(token), nil
+}
+
+func hashWithdrawalToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// validWithdrawalToken reports whether token is the participant's
+// withdrawal token, comparing in constant time
+func validWithdrawalToken(participant Participant, token string) bool {
+	if participant.WithdrawalTokenHash == "" || token == "" {
+		return false
+	}
+	hash := hashWithdrawalToken(token)
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(participant.WithdrawalTokenHash)) == 1
+}
+
+// erasureRows counts the rows deleted or anonymized per table
+type erasureRows map[string]int64
+
+// eraseParticipant deletes or anonymizes a participant and everything
+// recorded about them, returning the rows affected per table and the IDs
+// of the participant's sessions. It must run in a transaction.
+func eraseParticipant(tx *gorm.DB, participant Participant, mode string) (erasureRows, []uint, error) {
+	var sessionIDs []uint
+	if err := tx.Model(&StudySession{}).Where("participant_id = ?", participant.ID).Pluck("id", &sessionIDs).Error; err != nil {
+		return nil, nil, err
+	}
+
+	switch mode {
+	case ErasureModeDelete:
+		rows, err := deleteParticipantData(tx, participant, sessionIDs)
+		return rows, sessionIDs, err
+	case ErasureModeAnonymize:
+		rows, err := anonymizeParticipantData(tx, participant, sessionIDs)
+		return rows, sessionIDs, err
+	}
+	return nil, nil, errInvalidErasureMode
+}
+
+func deleteParticipantData(tx *gorm.DB, participant Participant, sessionIDs []uint) (erasureRows, error) {
+	rows := erasureRows{}
+
+	var measurementIDs []uint
+	if err := tx.Model(&AccuracyMeasurement{}).Where("session_id IN ?", sessionIDs).Pluck("id", &measurementIDs).Error; err != nil {
+		return nil, err
+	}
+	result := tx.Where("measurement_id IN ?", measurementIDs).Delete(&ValidationSample{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	rows["validation_samples"] = result.RowsAffected
+
+	// Per-session data, children before the sessions they belong to
+	sessionTables := []struct {
+		name  string
+		model interface{}
+	}{
+		{"gaze_points", &GazePoint{}},
+		{"calibration_data", &CalibrationData{}},
+		{"quiz_responses", &QuizResponse{}},
+		{"reading_events", &ReadingEvent{}},
+		{"accuracy_targets", &AccuracyTarget{}},
+		{"accuracy_measurements", &AccuracyMeasurement{}},
+		{"fixations", &Fixation{}},
+		{"saccades", &Saccade{}},
+		{"fixation_detections", &FixationDetection{}},
+		{"aois", &AOI{}},
+	}
+	for _, table := range sessionTables {
+		result := tx.Where("session_id IN ?", sessionIDs).Delete(table.model)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		rows[table.name] = result.RowsAffected
+	}
+
+	result = tx.Where("participant_id = ?", participant.ID).Delete(&StudySession{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	rows["study_sessions"] = result.RowsAffected
+
+	result = tx.Where("participant_id = ?", participant.ID).Delete(&ConsentRecord{})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	rows["consent_records"] = result.RowsAffected
+
+	result = tx.Delete(&Participant{}, participant.ID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	rows["participants"] = result.RowsAffected
+	return rows, nil
+}
+
+func anonymizeParticipantData(tx *gorm.DB, participant Participant, sessionIDs []uint) (erasureRows, error) {
+	rows := erasureRows{}
+
+	result := tx.Model(&Participant{}).Where("id = ?", participant.ID).Updates(map[string]interface{}{
+		"platform_participant_id": nil,
+		"platform_study_id":       "",
+		"platform_session_id":     "",
+		"platform_submit_url":     "",
+		"withdrawal_token_hash":   "",
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	rows["participants"] = result.RowsAffected
+
+	// Session codes may have been shown to or stored by the participant, so
+	// each session gets a new one
+	for _, id := range sessionIDs {
+		result := tx.Model(&StudySession{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"session_id":          generateSessionID(),
+			"user_agent":          "",
+			"platform_study_id":   "",
+			"platform_session_id": "",
+			"completion_code":     "",
+		})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		rows["study_sessions"] += result.RowsAffected
+	}
+
+	result = tx.Model(&ConsentRecord{}).Where("participant_id = ?", participant.ID).Update("user_agent", "")
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	rows["consent_records"] = result.RowsAffected
+	return rows, nil
+}
+
+// erasureTombstoneView is a tombstone with its row counts decoded
+type erasureTombstoneView struct {
+	ErasureTombstone
+	Rows erasureRows `json:"rows"`
+}
+
+func (t ErasureTombstone) view() erasureTombstoneView {
+	rows := erasureRows{}
+	json.Unmarshal([]byte(t.Rows), &rows)
+	return erasureTombstoneView{ErasureTombstone: t, Rows: rows}
+}
+
+// erase deletes or anonymizes a participant's data and writes a tombstone
+// in one transaction. Gaze streams of deleted sessions are closed.
+func erase(db *gorm.DB, participant Participant, mode, requestedBy, reason string) (ErasureTombstone, error) {
+	tombstone := ErasureTombstone{
+		ParticipantID: participant.ID,
+		Mode:          mode,
+		RequestedBy:   requestedBy,
+		Reason:        reason,
+	}
+	var sessionIDs []uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		rows, ids, err := eraseParticipant(tx, participant, mode)
+		if err != nil {
+			return err
+		}
+		sessionIDs = ids
+
+		rowsJSON, err := json.Marshal(rows)
+		if err != nil {
+			return err
+		}
+		tombstone.Rows = string(rowsJSON)
+		return tx.Create(&tombstone).Error
+	})
+	if err != nil {
+		return tombstone, err
+	}
+
+	if mode == ErasureModeDelete {
+		for _, id := range sessionIDs {
+			closeGazeStream(id)
+		}
+	}
+	return tombstone, nil
+}
+
+// handleParticipantWithdraw lets a participant withdraw from the study with
+// the withdrawal token they were given when they started. All their data
+// is deleted.
+func handleParticipantWithdraw(c *gin.Context) {
+	db := dbFrom(c)
+	var req struct {
+		ParticipantID   uint   `json:"participant_id"`
+		WithdrawalToken string `json:"withdrawal_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if req.ParticipantID == 0 || req.WithdrawalToken == "" {
+		c.JSON(400, gin.H{"error": "participant_id and withdrawal_token are required"})
+		return
+	}
+
+	// Unknown participants and wrong tokens get the same answer
+	var participant Participant
+	if err := db.First(&participant, req.ParticipantID).Error; err != nil || !validWithdrawalToken(participant, req.WithdrawalToken) {
+		c.JSON(403, gin.H{"error": "Invalid participant ID or withdrawal token"})
+		return
+	}
+
+	if _, err := erase(db, participant, ErasureModeDelete, erasureByParticipant, "Withdrawn by participant"); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to delete participant data: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"message": "Your participation has been withdrawn and your data deleted",
+	})
+}
+
+// handleAdminEraseParticipant deletes or anonymizes a participant's data
+// on request, e.g. to honour a right-to-erasure request
+func handleAdminEraseParticipant(c *gin.Context) {
+	db := dbFrom(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid participant id"})
+		return
+	}
+
+	var req struct {
+		Mode   string `json:"mode"`
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = ErasureModeDelete
+	}
+	if req.Mode != ErasureModeDelete && req.Mode != ErasureModeAnonymize {
+		c.JSON(400, gin.H{"error": errInvalidErasureMode.Error()})
+		return
+	}
+
+	var participant Participant
+	if err := db.First(&participant, id).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Participant not found"})
+		return
+	}
+
+	requestedBy := "admin"
+	if value, ok := c.Get(adminTokenContextKey); ok {
+		requestedBy = "admin:" + value.(AdminToken).Name
+	}
+	tombstone, err := erase(db, participant, req.Mode, requestedBy, req.Reason)
+	if err != nil {
+		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to %s participant data: %v", req.Mode, err)})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    tombstone.view(),
+	})
+}
+
+// handleAdminErasures lists the erasure tombstones, optionally of one participant
+func handleAdminErasures(c *gin.Context) {
+	db := dbFrom(c)
+	query := db.Order("id ASC")
+	if participantID := c.Query("participant_id"); participantID != "" {
+		query = query.Where("participant_id = ?", participantID)
+	}
+	var tombstones []ErasureTombstone
+	if err := query.Find(&tombstones).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch erasures: " + err.Error()})
+		return
+	}
+
+	views := make([]erasureTombstoneView, len(tombstones))
+	for i, t := range tombstones {
+		views[i] = t.view()
+	}
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    views,
+	})
+}
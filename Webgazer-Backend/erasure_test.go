@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParticipantWithdraw(t *testing.T) {
+	s := newTestServer(t)
+	studyText := s.studyText("withdraw")
+	participantID, withdrawalToken := s.participant("https://study.example/?PROLIFIC_PID=withdrawing&STUDY_ID=study")
+	otherID, otherToken := s.participant("")
+	s.startSession(participantID, studyText.ID)
+	s.startSession(otherID, studyText.ID)
+
+	// Wrong tokens, and other participants' tokens, are refused alike
+	s.expect(400, "POST", "/api/participant/withdraw", "", gin.H{"participant_id": participantID})
+	s.expect(403, "POST", "/api/participant/withdraw", "", gin.H{"participant_id": participantID, "withdrawal_token": "wrong"})
+	s.expect(403, "POST", "/api/participant/withdraw", "", gin.H{"participant_id": participantID, "withdrawal_token": otherToken})
+	s.expect(403, "POST", "/api/participant/withdraw", "", gin.H{"participant_id": 999, "withdrawal_token": withdrawalToken})
+
+	s.expect(200, "POST", "/api/participant/withdraw", "", gin.H{"participant_id": participantID, "withdrawal_token": withdrawalToken})
+	if n := s.count(&Participant{}, "id = ?", participantID); n != 0 {
+		t.Errorf("participants left = %d, want 0", n)
+	}
+	if n := s.count(&StudySession{}, "participant_id = ?", participantID); n != 0 {
+		t.Errorf("sessions left = %d, want 0", n)
+	}
+	if n := s.count(&StudySession{}, "participant_id = ?", otherID); n != 1 {
+		t.Errorf("sessions of the other participant = %d, want 1", n)
+	}
+	if n := s.count(&ErasureTombstone{}, "participant_id = ? AND mode = ? AND requested_by = ?", participantID, ErasureModeDelete, erasureByParticipant); n != 1 {
+		t.Errorf("tombstones = %d, want 1", n)
+	}
+
+	// The token is gone with the participant
+	s.expect(403, "POST", "/api/participant/withdraw", "", gin.H{"participant_id": participantID, "withdrawal_token": withdrawalToken})
+}
+
+func TestAdminEraseParticipant(t *testing.T) {
+	s := newTestServer(t)
+	owner := s.adminToken(RoleOwner)
+	studyText := s.studyText("erase")
+	participantID, withdrawalToken := s.participant("https://study.example/?PROLIFIC_PID=erased&STUDY_ID=study")
+	sessionID := s.startSession(participantID, studyText.ID)
+	path := fmt.Sprintf("/api/admin/participants/%d/erase", participantID)
+
+	s.expect(400, "POST", path, owner, gin.H{"mode": "shred"})
+	s.expect(404, "POST", "/api/admin/participants/999/erase", owner, gin.H{})
+
+	// Anonymizing keeps the data but not what identifies the participant
+	response := s.expect(200, "POST", path, owner, gin.H{"mode": ErasureModeAnonymize, "reason": "Erasure request"})
+	data := response["data"].(map[string]interface{})
+	if data["mode"] != ErasureModeAnonymize || data["requested_by"] != "admin:test owner" {
+		t.Errorf("tombstone mode %v, requested by %v; want anonymize by admin:test owner", data["mode"], data["requested_by"])
+	}
+
+	var participant Participant
+	if err := s.db.First(&participant, participantID).Error; err != nil {
+		t.Fatalf("anonymized participant: %v", err)
+	}
+	if participant.PlatformParticipantID != nil || participant.WithdrawalTokenHash != "" {
+		t.Error("anonymized participant keeps their platform ID or withdrawal token")
+	}
+	if n := s.count(&StudySession{}, "participant_id = ?", participantID); n != 1 {
+		t.Errorf("sessions = %d, want 1", n)
+	}
+	s.expect(404, "GET", "/api/session/"+sessionID, "", nil)
+	s.expect(403, "POST", "/api/participant/withdraw", "", gin.H{"participant_id": participantID, "withdrawal_token": withdrawalToken})
+
+	// Deleting removes everything
+	s.expect(200, "POST", path, owner, gin.H{"mode": ErasureModeDelete})
+	if n := s.count(&StudySession{}, "participant_id = ?", participantID); n != 0 {
+		t.Errorf("sessions left = %d, want 0", n)
+	}
+	response = s.expect(200, "GET", fmt.Sprintf("/api/admin/erasures?participant_id=%d", participantID), owner, nil)
+	if n := len(response["data"].([]interface{})); n != 2 {
+		t.Errorf("erasures = %d, want 2", n)
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// exclusionMetric returns a session metric an exclusion rule can test, or
+// nil if the session lacks the data for it
+type exclusionMetric func(s StudySession, q sessionQuality) *float64
+
+func boolMetric(v *bool) *float64 {
+	if v == nil {
+		return nil
+	}
+	f := 0.0
+	if *v {
+		f = 1
+	}
+	return &f
+}
+
+func intMetric(v int) *float64 {
+	f := float64(v)
+	return &f
+}
+
+// readingSpeedMetric returns the faster (max) or slower reading speed of
+// the two boxes
+func readingSpeedMetric(q sessionQuality, max bool) *float64 {
+	if q.ReadingSpeedAWPM == nil || q.ReadingSpeedBWPM == nil {
+		if q.ReadingSpeedAWPM != nil {
+			return q.ReadingSpeedAWPM
+		}
+		return q.ReadingSpeedBWPM
+	}
+	a, b := *q.ReadingSpeedAWPM, *q.ReadingSpeedBWPM
+	v := math.Min(a, b)
+	if max {
+		v = math.Max(a, b)
+	}
+	return &v
+}
+
+// exclusionMetrics are the fields exclusion rules can test
+var exclusionMetrics = map[string]exclusionMetric{
+	"quiz_score":    func(s StudySession, q sessionQuality) *float64 { return s.QuizScore },
+	"quiz_correct":  func(s StudySession, q sessionQuality) *float64 { return intMetric(s.QuizCorrect) },
+	"quiz_answered": func(s StudySession, q sessionQuality) *float64 { return intMetric(s.QuizAnswered) },
+
+	"gaze_point_count":   func(s StudySession, q sessionQuality) *float64 { return intMetric(q.GazePointCount) },
+	"sampling_rate_hz":   func(s StudySession, q sessionQuality) *float64 { return q.SamplingRateHz },
+	"track_loss_percent": func(s StudySession, q sessionQuality) *float64 { return q.TrackLossPercent },
+	"off_screen_percent": func(s StudySession, q sessionQuality) *float64 { return q.OffScreenPercent },
+
+	"accuracy_percent":   func(s StudySession, q sessionQuality) *float64 { return q.AccuracyPercent },
+	"accuracy_error_deg": func(s StudySession, q sessionQuality) *float64 { return q.AccuracyErrorDeg },
+	"accuracy_passed":    func(s StudySession, q sessionQuality) *float64 { return boolMetric(q.AccuracyPassed) },
+
+	"reading_speed_a_wpm":    func(s StudySession, q sessionQuality) *float64 { return q.ReadingSpeedAWPM },
+	"reading_speed_b_wpm":    func(s StudySession, q sessionQuality) *float64 { return q.ReadingSpeedBWPM },
+	"reading_speed_max_wpm":  func(s StudySession, q sessionQuality) *float64 { return readingSpeedMetric(q, true) },
+	"reading_speed_min_wpm":  func(s StudySession, q sessionQuality) *float64 { return readingSpeedMetric(q, false) },
+	"reading_time_plausible": func(s StudySession, q sessionQuality) *float64 { return boolMetric(q.ReadingTimePlausible) },
+}
+
+// exclusionOperators are the comparisons exclusion rules can use
+var exclusionOperators = map[string]func(value, threshold float64) bool{
+	"<":  func(v, t float64) bool { return v < t },
+	"<=": func(v, t float64) bool { return v <= t },
+	">":  func(v, t float64) bool { return v > t },
+	">=": func(v, t float64) bool { return v >= t },
+	"==": func(v, t float64) bool { return v == t },
+	"!=": func(v, t float64) bool { return v != t },
+}
+
+// exclusionFieldNames returns the fields rules can test, sorted
+func exclusionFieldNames() []string {
+	names := make([]string, 0, len(exclusionMetrics))
+	for name := range exclusionMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateExclusionRule(rule ExclusionRule) string {
+	if rule.StudyTextID == 0 {
+		return "study_text_id is required"
+	}
+	return validateExclusionCondition(rule)
+}
+
+// validateExclusionCondition checks a rule's field, operator and threshold
+func validateExclusionCondition(rule ExclusionRule) string {
+	if _, ok := exclusionMetrics[rule.Field]; !ok {
+		return "field must be one of " + strings.Join(exclusionFieldNames(), ", ")
+	}
+	if _, ok := exclusionOperators[rule.Operator]; !ok {
+		return "operator must be one of <, <=, >, >=, ==, !="
+	}
+	if math.IsNaN(rule.Threshold) || math.IsInf(rule.Threshold, 0) {
+		return "threshold must be a finite number"
+	}
+	return ""
+}
+
+// reason describes why the rule excludes a session with the given value
+func (r ExclusionRule) reason(value float64) string {
+	if r.Description != "" {
+		return r.Description
+	}
+	return fmt.Sprintf("%s %s %s (%s)", r.Field, r.Operator, formatFloat(r.Threshold), formatFloat(value))
+}
+
+// sessionExclusion is the result of applying a study's exclusion rules to
+// a session. Rules whose metric is missing for the session do not apply.
+type sessionExclusion struct {
+	SessionID uint     `json:"session_id"`
+	Excluded  bool     `json:"excluded"`
+	Reasons   []string `json:"reasons"`
+}
+
+// evaluateExclusionRules applies rules to a session and its quality metrics
+func evaluateExclusionRules(rules []ExclusionRule, session StudySession, quality sessionQuality) sessionExclusion {
+	result := sessionExclusion{SessionID: session.ID, Reasons: []string{}}
+	for _, rule := range rules {
+		metric, ok := exclusionMetrics[rule.Field]
+		compare, ok2 := exclusionOperators[rule.Operator]
+		if !ok || !ok2 {
+			continue
+		}
+		value := metric(session, quality)
+		if value != nil && compare(*value, rule.Threshold) {
+			result.Excluded = true
+			result.Reasons = append(result.Reasons, rule.reason(*value))
+		}
+	}
+	return result
+}
+
+// exclusionEvaluator applies each study text's exclusion rules to
+// sessions, loading the rules of a study text once
+type exclusionEvaluator struct {
+	db      *gorm.DB
+	quality *qualityChecker
+	rules   map[uint][]ExclusionRule // By study text ID
+}
+
+func newExclusionEvaluator(db *gorm.DB) *exclusionEvaluator {
+	return &exclusionEvaluator{
+		db:      db,
+		quality: newQualityChecker(db),
+		rules:   make(map[uint][]ExclusionRule),
+	}
+}
+
+// rulesFor returns the exclusion rules of the session's study text
+func (e *exclusionEvaluator) rulesFor(session StudySession) ([]ExclusionRule, error) {
+	studyTextID, err := quizStudyTextID(e.db, session)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rules, ok := e.rules[studyTextID]
+	if !ok {
+		if err := e.db.Where("study_text_id = ?", studyTextID).Order("id ASC").Find(&rules).Error; err != nil {
+			return nil, err
+		}
+		e.rules[studyTextID] = rules
+	}
+	return rules, nil
+}
+
+// evaluate decides whether a session is excluded. Quality metrics are only
+// computed if the session's study text has rules.
+func (e *exclusionEvaluator) evaluate(session StudySession) (sessionExclusion, error) {
+	rules, err := e.rulesFor(session)
+	if err != nil || len(rules) == 0 {
+		return sessionExclusion{SessionID: session.ID, Reasons: []string{}}, err
+	}
+	quality, err := e.quality.check(session)
+	if err != nil {
+		return sessionExclusion{}, err
+	}
+	return evaluateExclusionRules(rules, session, quality), nil
+}
+
+// includeExcluded reports whether the request asks for excluded sessions
+// to be included (include_excluded=true)
+func includeExcluded(c *gin.Context) bool {
+	include, _ := strconv.ParseBool(c.Query("include_excluded"))
+	return include
+}
+
+// excludeSessions drops the sessions excluded by their study's rules,
+// unless include is set. It returns the remaining sessions and how many
+// were dropped.
+func excludeSessions(db *gorm.DB, sessions []StudySession, include bool) ([]StudySession, int, error) {
+	if include {
+		return sessions, 0, nil
+	}
+	evaluator := newExclusionEvaluator(db)
+	kept := sessions[:0:0]
+	for _, s := range sessions {
+		result, err := evaluator.evaluate(s)
+		if err != nil {
+			return nil, 0, fmt.Errorf("session %d: %w", s.ID, err)
+		}
+		if !result.Excluded {
+			kept = append(kept, s)
+		}
+	}
+	return kept, len(sessions) - len(kept), nil
+}
+
+// handleAdminExclusionRule manages the exclusion rules of a study text
+func handleAdminExclusionRule(c *gin.Context) {
+	db := dbFrom(c)
+	switch c.Request.Method {
+	case "GET":
+		// List the rules of a study text, or get one rule by ID
+		if id := c.Query("id"); id != "" {
+			var rule ExclusionRule
+			if err := db.First(&rule, id).Error; err != nil {
+				c.JSON(404, gin.H{"error": "Exclusion rule not found"})
+				return
+			}
+			c.JSON(200, gin.H{"success": true, "data": rule})
+			return
+		}
+
+		studyTextID := c.Query("study_text_id")
+		if studyTextID == "" {
+			c.JSON(400, gin.H{"error": "id or study_text_id parameter is required"})
+			return
+		}
+		var rules []ExclusionRule
+		if err := db.Where("study_text_id = ?", studyTextID).Order("id ASC").Find(&rules).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to fetch exclusion rules: " + err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{
+			"success": true,
+			"data":    rules,
+			"fields":  exclusionFieldNames(),
+		})
+
+	case "POST":
+		var rule ExclusionRule
+		if err := c.ShouldBindJSON(&rule); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+			return
+		}
+		rule.ID = 0
+		if msg := validateExclusionRule(rule); msg != "" {
+			c.JSON(400, gin.H{"error": msg})
+			return
+		}
+		var studyText StudyText
+		if err := db.Select("id").First(&studyText, rule.StudyTextID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Study text not found"})
+			return
+		}
+
+		if err := db.Create(&rule).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to create exclusion rule: " + err.Error()})
+			return
+		}
+
+		c.JSON(201, gin.H{
+			"success": true,
+			"id":      rule.ID,
+			"message": "Exclusion rule created successfully",
+		})
+
+	case "PUT":
+		var updateData struct {
+			ID          uint     `json:"id"`
+			Field       string   `json:"field,omitempty"`
+			Operator    string   `json:"operator,omitempty"`
+			Threshold   *float64 `json:"threshold,omitempty"`
+			Description *string  `json:"description,omitempty"`
+		}
+		if err := c.ShouldBindJSON(&updateData); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+			return
+		}
+		if updateData.ID == 0 {
+			c.JSON(400, gin.H{"error": "ID is required"})
+			return
+		}
+
+		var rule ExclusionRule
+		if err := db.First(&rule, updateData.ID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Exclusion rule not found"})
+			return
+		}
+		if updateData.Field != "" {
+			rule.Field = updateData.Field
+		}
+		if updateData.Operator != "" {
+			rule.Operator = updateData.Operator
+		}
+		if updateData.Threshold != nil {
+			rule.Threshold = *updateData.Threshold
+		}
+		if updateData.Description != nil {
+			rule.Description = *updateData.Description
+		}
+		if msg := validateExclusionRule(rule); msg != "" {
+			c.JSON(400, gin.H{"error": msg})
+			return
+		}
+
+		if err := db.Save(&rule).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to update exclusion rule: " + err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"success": true,
+			"id":      rule.ID,
+			"message": "Exclusion rule updated successfully",
+		})
+
+	case "DELETE":
+		id := c.Query("id")
+		if id == "" {
+			c.JSON(400, gin.H{"error": "ID parameter is required"})
+			return
+		}
+
+		var rule ExclusionRule
+		if err := db.First(&rule, id).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Exclusion rule not found"})
+			return
+		}
+		if err := db.Delete(&rule).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to delete exclusion rule: " + err.Error()})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"success": true,
+			"message": "Exclusion rule deleted successfully",
+		})
+
+	default:
+		c.JSON(405, gin.H{"error": "Method not allowed"})
+	}
+}
+
+// handleAdminSessionExclusion reports whether a session is excluded by its
+// study's rules, and why
+func handleAdminSessionExclusion(c *gin.Context) {
+	db := dbFrom(c)
+	var session StudySession
+	if !findSession(c, &session) {
+		return
+	}
+
+	result, err := newExclusionEvaluator(db).evaluate(session)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to evaluate exclusion rules: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    result,
+	})
+}
+
+// handleAdminExclusions applies the exclusion rules to every session,
+// optionally only those of one study text version
+func handleAdminExclusions(c *gin.Context) {
+	db := dbFrom(c)
+	query := db.Order("id ASC")
+	if version := c.Query("version"); version != "" {
+		var studyText StudyText
+		if err := db.Where("version = ?", version).First(&studyText).Error; err != nil {
+			c.JSON(404, gin.H{"error": fmt.Sprintf("Study text version %q not found", version)})
+			return
+		}
+		query = query.Where("study_text_id = ?", studyText.ID)
+	}
+
+	var sessions []StudySession
+	if err := query.Find(&sessions).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch sessions: " + err.Error()})
+		return
+	}
+
+	evaluator := newExclusionEvaluator(db)
+	results := make([]sessionExclusion, 0, len(sessions))
+	excluded := 0
+	for _, s := range sessions {
+		result, err := evaluator.evaluate(s)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate exclusion rules for session %d: %v", s.ID, err)})
+			return
+		}
+		if result.Excluded {
+			excluded++
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(200, gin.H{
+		"success":  true,
+		"data":     results,
+		"sessions": len(results),
+		"excluded": excluded,
+	})
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is how many rows are loaded at a time when exporting the
+// large per-sample tables
+const exportBatchSize = 5000
+
+// exportFilter selects the sessions (and so the data) included in an export
+type exportFilter struct {
+	StudyTextID *uint      // Sessions of this study text version
+	From        *time.Time // Sessions created at or after this time
+	To          *time.Time // Sessions created before this time
+	Sources     []string   // Sessions of participants with one of these sources
+
+	IncludeExcluded bool   // Include sessions excluded by their study's exclusion rules
+	ExcludedIDs     []uint // Sessions found to be excluded, left out of the export
+}
+
+// parseExportTime parses a date (2006-01-02) or an RFC 3339 timestamp. A
+// date used as the end of a range includes the whole day.
+func parseExportTime(value string, endOfRange bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD or RFC 3339)", value)
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// parseExportFilter reads the version, from, to, source and
+// include_excluded query parameters
+func parseExportFilter(c *gin.Context) (exportFilter, error) {
+	db := dbFrom(c)
+	f := exportFilter{IncludeExcluded: includeExcluded(c)}
+
+	if version := c.Query("version"); version != "" {
+		var studyText StudyText
+		if err := db.Where("version = ?", version).First(&studyText).Error; err != nil {
+			return f, fmt.Errorf("study text version %q not found", version)
+		}
+		f.StudyTextID = &studyText.ID
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := parseExportTime(from, false)
+		if err != nil {
+			return f, err
+		}
+		f.From = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseExportTime(to, true)
+		if err != nil {
+			return f, err
+		}
+		f.To = &t
+	}
+	if source := c.Query("source"); source != "" {
+		for _, s := range strings.Split(source, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				f.Sources = append(f.Sources, s)
+			}
+		}
+	}
+	return f, nil
+}
+
+// sessionQuery returns a query for the sessions matching the filter
+func (f exportFilter) sessionQuery(db *gorm.DB) *gorm.DB {
+	query := db.Model(&StudySession{})
+	if f.StudyTextID != nil {
+		query = query.Where("study_sessions.study_text_id = ?", *f.StudyTextID)
+	}
+	if f.From != nil {
+		query = query.Where("study_sessions.created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("study_sessions.created_at < ?", *f.To)
+	}
+	if len(f.Sources) > 0 {
+		query = query.Where("study_sessions.participant_id IN (?)", db.Model(&Participant{}).Select("id").Where("source IN ?", f.Sources))
+	}
+	if len(f.ExcludedIDs) > 0 {
+		query = query.Where("study_sessions.id NOT IN ?", f.ExcludedIDs)
+	}
+	return query
+}
+
+// sessionScoped reports whether the filter restricts sessions by more than
+// participant source, in which case only participants with a matching
+// session are exported
+func (f exportFilter) sessionScoped() bool {
+	return f.StudyTextID != nil || f.From != nil || f.To != nil || len(f.ExcludedIDs) > 0
+}
+
+// exportData holds what is needed to write the rows of each export file
+type exportData struct {
+	sessions      []StudySession
+	participantOf map[uint]uint   // Session ID to participant ID
+	versions      map[uint]string // Study text ID to version
+}
+
+// participantID returns the participant of an exported session as a CSV cell
+func (d exportData) participantID(sessionID uint) string {
+	if id, ok := d.participantOf[sessionID]; ok {
+		return formatUint(id)
+	}
+	return ""
+}
+
+// exportCSV writes one CSV file of the export, loading rows in batches in
+// primary key order
+func exportCSV[T any](zw *zip.Writer, name string, header []string, query *gorm.DB, record func(T) []string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	var rows []T
+	result := query.FindInBatches(&rows, exportBatchSize, func(tx *gorm.DB, batch int) error {
+		for _, row := range rows {
+			if err := w.Write(record(row)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	w.Flush()
+	return w.Error()
+}
+
+var (
+	participantExportHeader = []string{"participant_id", "source", "created_at"}
+	sessionExportHeader     = []string{
+		"session_id", "session_uid", "participant_id", "participant_source", "status",
+		"study_text_id", "study_text_version", "condition_cell", "font_left", "font_right",
+		"calibration_points", "time_left_ms", "time_right_ms", "time_a_ms", "time_b_ms",
+		"font_preference", "preferred_font_type",
+		"quiz_correct", "quiz_answered", "quiz_total", "quiz_score",
+		"user_agent", "screen_width", "screen_height",
+		"created_at", "updated_at", "completed_at",
+	}
+	calibrationExportHeader  = []string{"id", "session_id", "participant_id", "point_index", "click_number", "x", "y", "timestamp"}
+	accuracyExportHeader     = []string{"id", "session_id", "participant_id", "method", "accuracy", "duration_ms", "passed", "timestamp", "sample_count", "mean_error_px", "mean_error_deg", "precision_rms_px", "precision_rms_deg", "threshold_deg"}
+	quizResponseExportHeader = []string{"id", "session_id", "participant_id", "question_id", "answer_index", "is_correct", "response_time_ms", "timestamp", "backfilled"}
+	gazePointExportHeader    = []string{"id", "session_id", "participant_id", "timestamp", "x", "y", "panel", "phase", "passage_id", "aoi_id"}
+	readingEventExportHeader = []string{"id", "session_id", "participant_id", "event_type", "panel", "duration_ms", "timestamp"}
+)
+
+// writeExport writes all export files for the filter to zw
+func writeExport(db *gorm.DB, zw *zip.Writer, f exportFilter) error {
+	data := exportData{
+		participantOf: make(map[uint]uint),
+		versions:      make(map[uint]string),
+	}
+	if err := f.sessionQuery(db).Order("study_sessions.id ASC").Find(&data.sessions).Error; err != nil {
+		return err
+	}
+
+	// Apply the exclusion rules, keeping the quality metrics they were
+	// evaluated on for sessions.csv
+	evaluator := newExclusionEvaluator(db)
+	qualities := make(map[uint]sessionQuality, len(data.sessions))
+	exclusions := make(map[uint]sessionExclusion, len(data.sessions))
+	kept := data.sessions[:0]
+	for _, s := range data.sessions {
+		rules, err := evaluator.rulesFor(s)
+		if err != nil {
+			return err
+		}
+		quality, err := evaluator.quality.check(s)
+		if err != nil {
+			return err
+		}
+		exclusion := evaluateExclusionRules(rules, s, quality)
+		if exclusion.Excluded && !f.IncludeExcluded {
+			f.ExcludedIDs = append(f.ExcludedIDs, s.ID)
+			continue
+		}
+		qualities[s.ID] = quality
+		exclusions[s.ID] = exclusion
+		kept = append(kept, s)
+	}
+	data.sessions = kept
+
+	for _, s := range data.sessions {
+		data.participantOf[s.ID] = s.ParticipantID
+	}
+
+	var studyTexts []StudyText
+	if err := db.Select("id", "version").Find(&studyTexts).Error; err != nil {
+		return err
+	}
+	for _, t := range studyTexts {
+		data.versions[t.ID] = t.Version
+	}
+
+	participantQuery := db.Model(&Participant{}).Order("id ASC")
+	if len(f.Sources) > 0 {
+		participantQuery = participantQuery.Where("source IN ?", f.Sources)
+	}
+	if f.sessionScoped() {
+		participantQuery = participantQuery.Where("id IN (?)", f.sessionQuery(db).Select("study_sessions.participant_id"))
+	}
+	var participants []Participant
+	if err := participantQuery.Find(&participants).Error; err != nil {
+		return err
+	}
+	sources := make(map[uint]string, len(participants))
+	for _, p := range participants {
+		sources[p.ID] = p.Source
+	}
+
+	// Participants and sessions are small enough to write from memory
+	pw, err := zw.Create("participants.csv")
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(pw)
+	w.Write(participantExportHeader)
+	for _, p := range participants {
+		w.Write([]string{formatUint(p.ID), p.Source, formatTime(p.CreatedAt)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	// The consent audit trail of the exported participants
+	participantIDs := make([]uint, len(participants))
+	for i, p := range participants {
+		participantIDs[i] = p.ID
+	}
+	err = exportCSV(zw, "consent.csv", consentRecordCSVHeader, db.Model(&ConsentRecord{}).Where("participant_id IN ?", participantIDs), ConsentRecord.csvRecord)
+	if err != nil {
+		return err
+	}
+
+	sw, err := zw.Create("sessions.csv")
+	if err != nil {
+		return err
+	}
+	w = csv.NewWriter(sw)
+	w.Write(append(append(sessionExportHeader, sessionQualityCSVHeader...), "excluded", "exclusion_reasons"))
+	for _, s := range data.sessions {
+		studyTextID, version := "", ""
+		if s.StudyTextID != 0 {
+			studyTextID = formatUint(s.StudyTextID)
+			version = data.versions[s.StudyTextID]
+		}
+		w.Write(append([]string{
+			formatUint(s.ID),
+			s.SessionID,
+			formatUint(s.ParticipantID),
+			sources[s.ParticipantID],
+			s.Status,
+			studyTextID,
+			version,
+			formatOptionalInt(s.ConditionCell),
+			s.FontLeft,
+			s.FontRight,
+			strconv.Itoa(s.CalibrationPoints),
+			strconv.Itoa(s.TimeLeftMS),
+			strconv.Itoa(s.TimeRightMS),
+			strconv.Itoa(s.TimeAMS),
+			strconv.Itoa(s.TimeBMS),
+			s.FontPreference,
+			s.PreferredFontType,
+			strconv.Itoa(s.QuizCorrect),
+			strconv.Itoa(s.QuizAnswered),
+			strconv.Itoa(s.QuizTotal),
+			formatOptionalFloat(s.QuizScore),
+			s.UserAgent,
+			strconv.Itoa(s.ScreenWidth),
+			strconv.Itoa(s.ScreenHeight),
+			formatTime(s.CreatedAt),
+			formatTime(s.UpdatedAt),
+			formatOptionalTime(s.CompletedAt),
+		}, append(qualities[s.ID].csvRecord(),
+			strconv.FormatBool(exclusions[s.ID].Excluded),
+			strings.Join(exclusions[s.ID].Reasons, "; "),
+		)...))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	inSessions := func(model interface{}) *gorm.DB {
+		return db.Model(model).Where("session_id IN (?)", f.sessionQuery(db).Select("study_sessions.id"))
+	}
+
+	err = exportCSV(zw, "calibration.csv", calibrationExportHeader, inSessions(&CalibrationData{}), func(r CalibrationData) []string {
+		return []string{
+			formatUint(r.ID), formatUint(r.SessionID), data.participantID(r.SessionID),
+			strconv.Itoa(r.PointIndex), strconv.Itoa(r.ClickNumber),
+			formatFloat(r.X), formatFloat(r.Y), formatTime(r.Timestamp),
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = exportCSV(zw, "accuracy.csv", accuracyExportHeader, inSessions(&AccuracyMeasurement{}), func(r AccuracyMeasurement) []string {
+		return []string{
+			formatUint(r.ID), formatUint(r.SessionID), data.participantID(r.SessionID), r.Method,
+			formatFloat(r.Accuracy), strconv.Itoa(r.Duration), strconv.FormatBool(r.Passed),
+			formatTime(r.Timestamp), strconv.Itoa(r.SampleCount),
+			formatOptionalFloat(r.MeanErrorPX), formatOptionalFloat(r.MeanErrorDeg),
+			formatOptionalFloat(r.PrecisionRMSPX), formatOptionalFloat(r.PrecisionRMSDeg),
+			formatOptionalFloat(r.ThresholdDeg),
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = exportCSV(zw, "quiz_responses.csv", quizResponseExportHeader, inSessions(&QuizResponse{}), func(r QuizResponse) []string {
+		return []string{
+			formatUint(r.ID), formatUint(r.SessionID), data.participantID(r.SessionID),
+			r.QuestionID, strconv.Itoa(r.AnswerIndex), formatOptionalBool(r.IsCorrect),
+			strconv.Itoa(r.ResponseTime), formatTime(r.Timestamp), strconv.FormatBool(r.Backfilled),
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	err = exportCSV(zw, "gaze_points.csv", gazePointExportHeader, inSessions(&GazePoint{}), func(r GazePoint) []string {
+		return []string{
+			formatUint(r.ID), formatUint(r.SessionID), data.participantID(r.SessionID),
+			formatTime(r.Timestamp), formatFloat(r.X), formatFloat(r.Y), r.Panel, r.Phase,
+			formatOptionalUint(r.PassageID), formatOptionalUint(r.AOIID),
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return exportCSV(zw, "reading_events.csv", readingEventExportHeader, inSessions(&ReadingEvent{}), func(r ReadingEvent) []string {
+		return []string{
+			formatUint(r.ID), formatUint(r.SessionID), data.participantID(r.SessionID),
+			r.EventType, r.Panel, strconv.Itoa(r.Duration), formatTime(r.Timestamp),
+		}
+	})
+}
+
+// handleAdminExport sends a ZIP of CSV files with the study data, filtered
+// by study text version, session date range and participant source. The
+// archive is built in a temporary file so a failure part way through is
+// reported as an error rather than a truncated download.
+func handleAdminExport(c *gin.Context) {
+	db := dbFrom(c)
+	filter, err := parseExportFilter(c)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "readability-export-*.zip")
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create export: " + err.Error()})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zw := zip.NewWriter(tmp)
+	if err := writeExport(db, zw, filter); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create export: " + err.Error()})
+		return
+	}
+	if err := zw.Close(); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create export: " + err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("readability-export-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	c.FileAttachment(tmp.Name(), filename)
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"readability-backend/analysis"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// fixationParamsRequest holds optional detection thresholds supplied as
+// query parameters (GET) or a JSON body (POST)
+type fixationParamsRequest struct {
+	Algorithm           string   `form:"algorithm" json:"algorithm"`
+	VelocityThreshold   *float64 `form:"velocity_threshold" json:"velocity_threshold"`
+	DispersionThreshold *float64 `form:"dispersion_threshold" json:"dispersion_threshold"`
+	MinDurationMS       *int     `form:"min_duration_ms" json:"min_duration_ms"`
+	MaxGapMS            *int     `form:"max_gap_ms" json:"max_gap_ms"`
+}
+
+// apply overrides the thresholds in p with those present in the request
+func (r fixationParamsRequest) apply(p analysis.Params) (analysis.Params, error) {
+	if r.Algorithm != "" {
+		p.Algorithm = r.Algorithm
+	}
+	if r.VelocityThreshold != nil {
+		p.VelocityThreshold = *r.VelocityThreshold
+	}
+	if r.DispersionThreshold != nil {
+		p.DispersionThreshold = *r.DispersionThreshold
+	}
+	if r.MinDurationMS != nil {
+		p.MinDuration = time.Duration(*r.MinDurationMS) * time.Millisecond
+	}
+	if r.MaxGapMS != nil {
+		p.MaxGap = time.Duration(*r.MaxGapMS) * time.Millisecond
+	}
+	return p, p.Validate()
+}
+
+// params returns the detection thresholds stored on the record
+func (d FixationDetection) params() analysis.Params {
+	return analysis.Params{
+		Algorithm:           d.Algorithm,
+		VelocityThreshold:   d.VelocityThreshold,
+		DispersionThreshold: d.DispersionThreshold,
+		MinDuration:         time.Duration(d.MinDurationMS) * time.Millisecond,
+		MaxGap:              time.Duration(d.MaxGapMS) * time.Millisecond,
+	}
+}
+
+// sessionGazePoints loads a session's gaze points in time order
+func sessionGazePoints(db *gorm.DB, sessionID uint) ([]GazePoint, error) {
+	var points []GazePoint
+	err := db.Where("session_id = ?", sessionID).Order("timestamp ASC, id ASC").Find(&points).Error
+	return points, err
+}
+
+// gazeSamples converts gaze points to analysis samples. Samples on different
+// panels or passages are never merged into one fixation.
+func gazeSamples(points []GazePoint) []analysis.Sample {
+	samples := make([]analysis.Sample, len(points))
+	for i, p := range points {
+		segment := p.Panel
+		if p.PassageID != nil {
+			segment = fmt.Sprintf("%s/%d", p.Panel, *p.PassageID)
+		}
+		samples[i] = analysis.Sample{
+			X:       p.X,
+			Y:       p.Y,
+			Time:    p.Timestamp,
+			Panel:   p.Panel,
+			Phase:   p.Phase,
+			Segment: segment,
+		}
+	}
+	return samples
+}
+
+// computeFixations runs fixation detection over a session's gaze points
+// without storing the result
+func computeFixations(db *gorm.DB, sessionID uint, params analysis.Params) (FixationDetection, []Fixation, []Saccade, error) {
+	points, err := sessionGazePoints(db, sessionID)
+	if err != nil {
+		return FixationDetection{}, nil, nil, err
+	}
+
+	detected, detectedSaccades, err := analysis.Detect(gazeSamples(points), params)
+	if err != nil {
+		return FixationDetection{}, nil, nil, err
+	}
+
+	aois, err := loadAOIIndex(db, sessionID)
+	if err != nil {
+		return FixationDetection{}, nil, nil, err
+	}
+
+	fixations := make([]Fixation, len(detected))
+	for i, f := range detected {
+		fixations[i] = Fixation{
+			SessionID:   sessionID,
+			Index:       f.Index,
+			StartTime:   f.Start,
+			EndTime:     f.End,
+			DurationMS:  int(f.Duration.Milliseconds()),
+			X:           f.X,
+			Y:           f.Y,
+			Dispersion:  f.Dispersion,
+			SampleCount: f.SampleCount,
+			Panel:       f.Panel,
+			Phase:       f.Phase,
+			PassageID:   points[f.FirstSample].PassageID,
+		}
+		fixations[i].AOIID = aois.lookup(f.Panel, fixations[i].PassageID, f.X, f.Y)
+	}
+
+	saccades := make([]Saccade, len(detectedSaccades))
+	for i, s := range detectedSaccades {
+		saccades[i] = Saccade{
+			SessionID:         sessionID,
+			Index:             s.Index,
+			FromFixationIndex: s.FromFixation,
+			ToFixationIndex:   s.ToFixation,
+			StartTime:         s.Start,
+			EndTime:           s.End,
+			DurationMS:        int(s.Duration.Milliseconds()),
+			StartX:            s.StartX,
+			StartY:            s.StartY,
+			EndX:              s.EndX,
+			EndY:              s.EndY,
+			Amplitude:         s.Amplitude,
+			PeakVelocity:      s.PeakVelocity,
+			Panel:             s.Panel,
+		}
+	}
+
+	detection := FixationDetection{
+		SessionID:           sessionID,
+		Algorithm:           params.Algorithm,
+		VelocityThreshold:   params.VelocityThreshold,
+		DispersionThreshold: params.DispersionThreshold,
+		MinDurationMS:       int(params.MinDuration.Milliseconds()),
+		MaxGapMS:            int(params.MaxGap.Milliseconds()),
+		FixationCount:       len(fixations),
+		SaccadeCount:        len(saccades),
+		ComputedAt:          time.Now(),
+	}
+	return detection, fixations, saccades, nil
+}
+
+// detectFixations runs fixation detection over a session's gaze points and
+// replaces any previously stored fixations and saccades
+func detectFixations(db *gorm.DB, sessionID uint, params analysis.Params) (FixationDetection, error) {
+	detection, fixations, saccades, err := computeFixations(db, sessionID, params)
+	if err != nil {
+		return FixationDetection{}, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", sessionID).Delete(&Fixation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("session_id = ?", sessionID).Delete(&Saccade{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("session_id = ?", sessionID).Delete(&FixationDetection{}).Error; err != nil {
+			return err
+		}
+		if len(fixations) > 0 {
+			if err := tx.Omit("Session").CreateInBatches(&fixations, gazeInsertBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		if len(saccades) > 0 {
+			if err := tx.Omit("Session").CreateInBatches(&saccades, gazeInsertBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Omit("Session").Create(&detection).Error
+	})
+	return detection, err
+}
+
+// ensureFixations detects fixations for a session with the default
+// thresholds if none have been computed yet
+func ensureFixations(db *gorm.DB, sessionID uint) error {
+	var detection FixationDetection
+	err := db.Where("session_id = ?", sessionID).First(&detection).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		_, err = detectFixations(db, sessionID, analysis.DefaultParams())
+	}
+	return err
+}
+
+// handleAdminFixations returns the fixations and saccades for a session.
+//
+// GET returns the stored result, computing and storing it with the default
+// thresholds on first access. Other thresholds are computed without
+// replacing the stored result, as viewers may GET. POST always recomputes
+// and stores.
+func handleAdminFixations(c *gin.Context) {
+	db := dbFrom(c)
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid session id"})
+		return
+	}
+
+	var session StudySession
+	if err := db.First(&session, sessionID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+
+	// Start from the stored thresholds so a plain GET returns the cached result
+	params := analysis.DefaultParams()
+	var detection FixationDetection
+	err = db.Where("session_id = ?", sessionID).First(&detection).Error
+	stored := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(500, gin.H{"error": "Failed to fetch fixation detection: " + err.Error()})
+		return
+	}
+	if stored {
+		params = detection.params()
+	}
+
+	// Thresholds come from the query string, or from the body of a POST
+	// that has one
+	var req fixationParamsRequest
+	bind := c.ShouldBindQuery
+	if c.Request.ContentLength > 0 {
+		bind = c.ShouldBind
+	}
+	if err := bind(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid parameters: " + err.Error()})
+		return
+	}
+	params, err = req.apply(params)
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var fixations []Fixation
+	var saccades []Saccade
+	switch {
+	case c.Request.Method == "POST" || (!stored && params == analysis.DefaultParams()):
+		detection, err = detectFixations(db, session.ID, params)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to detect fixations: " + err.Error()})
+			return
+		}
+		stored = true
+	case !stored || params != detection.params():
+		detection, fixations, saccades, err = computeFixations(db, session.ID, params)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to detect fixations: " + err.Error()})
+			return
+		}
+		stored = false
+	}
+
+	if stored {
+		if err := db.Where("session_id = ?", sessionID).Order("\"index\" ASC").Find(&fixations).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to fetch fixations: " + err.Error()})
+			return
+		}
+		if err := db.Where("session_id = ?", sessionID).Order("\"index\" ASC").Find(&saccades).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to fetch saccades: " + err.Error()})
+			return
+		}
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data": gin.H{
+			"detection": detection,
+			"fixations": fixations,
+			"saccades":  saccades,
+			"stored":    stored,
+		},
+	})
+}
+
+// handleAdminRecomputeFixations reruns fixation detection for every session
+// with the supplied thresholds (or the defaults)
+func handleAdminRecomputeFixations(c *gin.Context) {
+	db := dbFrom(c)
+	var req fixationParamsRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+			return
+		}
+	}
+	params, err := req.apply(analysis.DefaultParams())
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	var sessionIDs []uint
+	if err := db.Model(&StudySession{}).Order("id ASC").Pluck("id", &sessionIDs).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch sessions: " + err.Error()})
+		return
+	}
+
+	fixationCount := 0
+	for _, id := range sessionIDs {
+		detection, err := detectFixations(db, id, params)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to detect fixations for session %d: %v", id, err)})
+			return
+		}
+		fixationCount += detection.FixationCount
+	}
+
+	c.JSON(200, gin.H{
+		"success":   true,
+		"sessions":  len(sessionIDs),
+		"fixations": fixationCount,
+		"message":   "Fixations recomputed successfully",
+	})
+}
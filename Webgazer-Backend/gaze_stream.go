@@ -0,0 +1,327 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+const (
+	gazeStreamFlushSize     = 500              // Flush once this many points are buffered
+	gazeStreamFlushInterval = time.Second      // Flush at least this often while points are buffered
+	gazeStreamPingInterval  = 30 * time.Second // Keep-alive ping interval
+	gazeStreamReadTimeout   = 60 * time.Second // Connection is dropped if nothing (incl. pong) arrives in this window
+	gazeStreamWriteTimeout  = 10 * time.Second
+	gazeStreamMaxMessage    = 4 << 20 // Maximum size of a single client message in bytes
+)
+
+// gazeStreamUpgrader upgrades HTTP connections to WebSockets, accepting the
+// same origins as the CORS configuration
+var gazeStreamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range corsAllowOrigins {
+			if origin == allowed {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// activeGazeStreams tracks sessions that currently have an open stream so
+// two connections cannot interleave sequence numbers for the same session.
+// Closing a session's channel asks its stream to flush and close.
+var activeGazeStreams = struct {
+	sync.Mutex
+	sessions map[uint]chan struct{}
+}{sessions: make(map[uint]chan struct{})}
+
+// closeGazeStream asks the open stream for a session, if any, to flush and
+// close because the session has ended
+func closeGazeStream(sessionID uint) {
+	activeGazeStreams.Lock()
+	defer activeGazeStreams.Unlock()
+	if closing, ok := activeGazeStreams.sessions[sessionID]; ok {
+		close(closing)
+		delete(activeGazeStreams.sessions, sessionID)
+	}
+}
+
+// gazeStreamClientMessage is a message sent by the client over the stream.
+//
+// Type "points" carries a batch of samples tagged with a sequence number that
+// increases with every message. Type "complete" asks the server to flush and
+// close the stream.
+type gazeStreamClientMessage struct {
+	Type   string      `json:"type"`
+	Seq    int64       `json:"seq"`
+	Points []GazePoint `json:"points"`
+}
+
+// gazeStreamServerMessage is a message sent by the server over the stream
+type gazeStreamServerMessage struct {
+	Type      string `json:"type"` // "hello", "ack", "complete" or "error"
+	SessionID uint   `json:"session_id,omitempty"`
+	Seq       int64  `json:"seq"` // Highest sequence number persisted so far
+	Accepted  int    `json:"accepted,omitempty"`
+	Rejected  int    `json:"rejected,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// gazeStream buffers points received on one connection and flushes them to
+// the gaze_points table
+type gazeStream struct {
+	db        *gorm.DB
+	conn      *websocket.Conn
+	sessionID uint
+	closing   <-chan struct{} // Closed when the session ends
+	ackedSeq  int64           // Highest sequence number written to the database
+	bufferSeq int64           // Highest sequence number held in the buffer
+	buffer    []GazePoint
+	rejected  int // Points rejected since the last ack
+}
+
+func handleGazeStream(c *gin.Context) {
+	db := dbFrom(c)
+	var session StudySession
+	if !findSessionByUID(c, &session) {
+		return
+	}
+	sessionID := session.ID
+
+	if isFinalSessionStatus(session.Status) {
+		c.JSON(409, gin.H{"error": "Session is already " + session.Status})
+		return
+	}
+	if !requireConsent(c, session) {
+		return
+	}
+
+	activeGazeStreams.Lock()
+	if _, ok := activeGazeStreams.sessions[sessionID]; ok {
+		activeGazeStreams.Unlock()
+		c.JSON(409, gin.H{"error": "A gaze stream is already open for this session"})
+		return
+	}
+	closing := make(chan struct{})
+	activeGazeStreams.sessions[sessionID] = closing
+	activeGazeStreams.Unlock()
+	defer func() {
+		activeGazeStreams.Lock()
+		if activeGazeStreams.sessions[sessionID] == closing {
+			delete(activeGazeStreams.sessions, sessionID)
+		}
+		activeGazeStreams.Unlock()
+	}()
+
+	conn, err := gazeStreamUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade has already written an HTTP error response
+		log.Printf("Gaze stream upgrade failed for session %d: %v", sessionID, err)
+		return
+	}
+	defer conn.Close()
+
+	stream := &gazeStream{
+		db:        db,
+		conn:      conn,
+		sessionID: sessionID,
+		closing:   closing,
+		ackedSeq:  session.GazeStreamSeq,
+		bufferSeq: session.GazeStreamSeq,
+	}
+	stream.run()
+}
+
+// run drives the connection until the client completes or disconnects
+func (s *gazeStream) run() {
+	s.conn.SetReadLimit(gazeStreamMaxMessage)
+	s.conn.SetReadDeadline(time.Now().Add(gazeStreamReadTimeout))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(gazeStreamReadTimeout))
+	})
+
+	// Tell the client where to resume from after a reconnect
+	if err := s.send(gazeStreamServerMessage{Type: "hello", SessionID: s.sessionID, Seq: s.ackedSeq}); err != nil {
+		return
+	}
+
+	// Only one goroutine may read from the connection; it hands messages to
+	// the loop below, which owns the buffer and all writes
+	messages := make(chan gazeStreamClientMessage)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			var msg gazeStreamClientMessage
+			if err := s.conn.ReadJSON(&msg); err != nil {
+				readErr <- err
+				return
+			}
+			s.conn.SetReadDeadline(time.Now().Add(gazeStreamReadTimeout))
+			select {
+			case messages <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	flushTicker := time.NewTicker(gazeStreamFlushInterval)
+	defer flushTicker.Stop()
+	pingTicker := time.NewTicker(gazeStreamPingInterval)
+	defer pingTicker.Stop()
+
+	for {
+		select {
+		case msg := <-messages:
+			switch msg.Type {
+			case "points":
+				s.receive(msg)
+				if len(s.buffer) >= gazeStreamFlushSize {
+					if err := s.flushAndAck(); err != nil {
+						return
+					}
+				}
+			case "complete":
+				s.complete()
+				return
+			default:
+				s.send(gazeStreamServerMessage{Type: "error", Seq: s.ackedSeq, Error: fmt.Sprintf("unknown message type %q", msg.Type)})
+			}
+
+		case <-s.closing:
+			s.complete()
+			return
+
+		case <-flushTicker.C:
+			if s.bufferSeq > s.ackedSeq {
+				if err := s.flushAndAck(); err != nil {
+					return
+				}
+			}
+
+		case <-pingTicker.C:
+			deadline := time.Now().Add(gazeStreamWriteTimeout)
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				s.flush()
+				return
+			}
+
+		case err := <-readErr:
+			// Keep whatever was received before the connection dropped; the
+			// client learns the persisted sequence number on reconnect
+			if err := s.flush(); err != nil {
+				log.Printf("Gaze stream for session %d lost buffered points: %v", s.sessionID, err)
+			}
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Gaze stream for session %d closed: %v", s.sessionID, err)
+			}
+			return
+		}
+	}
+}
+
+// receive validates the points in a message and adds them to the buffer.
+// Messages at or below the highest sequence number seen are resends and are
+// only acknowledged.
+func (s *gazeStream) receive(msg gazeStreamClientMessage) {
+	if msg.Seq <= s.bufferSeq {
+		if msg.Seq <= s.ackedSeq {
+			s.send(gazeStreamServerMessage{Type: "ack", Seq: s.ackedSeq})
+		}
+		return
+	}
+
+	for i := range msg.Points {
+		point := msg.Points[i]
+		if reason := validateGazePoint(&point, s.sessionID); reason != "" {
+			s.rejected++
+			continue
+		}
+		s.buffer = append(s.buffer, point)
+	}
+	s.bufferSeq = msg.Seq
+}
+
+// flush writes buffered points and the new sequence number in one transaction
+func (s *gazeStream) flush() error {
+	if s.bufferSeq <= s.ackedSeq {
+		return nil
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// The session may have been deleted since the stream opened (see erasure.go)
+		result := tx.Model(&StudySession{}).Where("id = ?", s.sessionID).Update("gaze_stream_seq", s.bufferSeq)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("session no longer exists")
+		}
+		if len(s.buffer) > 0 {
+			if err := assignGazePointAOIs(tx, s.sessionID, s.buffer); err != nil {
+				return err
+			}
+			if err := tx.Omit("Session").CreateInBatches(&s.buffer, gazeInsertBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.ackedSeq = s.bufferSeq
+	s.buffer = s.buffer[:0]
+	return nil
+}
+
+// flushAndAck flushes the buffer and acknowledges the persisted sequence number
+func (s *gazeStream) flushAndAck() error {
+	accepted := len(s.buffer)
+	if err := s.flush(); err != nil {
+		log.Printf("Failed to save streamed gaze points for session %d: %v", s.sessionID, err)
+		s.send(gazeStreamServerMessage{Type: "error", Seq: s.ackedSeq, Error: "Failed to save gaze points"})
+		s.close(websocket.CloseInternalServerErr, "failed to save gaze points")
+		return err
+	}
+
+	rejected := s.rejected
+	s.rejected = 0
+	return s.send(gazeStreamServerMessage{Type: "ack", Seq: s.ackedSeq, Accepted: accepted, Rejected: rejected})
+}
+
+// complete flushes the buffer and closes the stream normally
+func (s *gazeStream) complete() {
+	if err := s.flushAndAck(); err != nil {
+		return
+	}
+	s.send(gazeStreamServerMessage{Type: "complete", Seq: s.ackedSeq})
+	s.close(websocket.CloseNormalClosure, "session complete")
+}
+
+func (s *gazeStream) send(msg gazeStreamServerMessage) error {
+	s.conn.SetWriteDeadline(time.Now().Add(gazeStreamWriteTimeout))
+	return s.conn.WriteJSON(msg)
+}
+
+func (s *gazeStream) close(code int, reason string) {
+	deadline := time.Now().Add(gazeStreamWriteTimeout)
+	s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+
+	"readability-backend/analysis"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Heatmaps and scanpaths of sessions without a recorded screen size use this size
+const (
+	defaultHeatmapWidth  = 1920
+	defaultHeatmapHeight = 1080
+	maxHeatmapSize       = 8192
+	defaultHeatmapSigma  = 40.0
+)
+
+// heatmapRequest holds the query parameters shared by the heatmap endpoints
+type heatmapRequest struct {
+	Sigma       *float64 `form:"sigma"` // Kernel standard deviation in pixels
+	Width       int      `form:"width"`
+	Height      int      `form:"height"`
+	PassageID   *uint    `form:"passage_id"`
+	Panel       string   `form:"panel"`
+	Phase       string   `form:"phase"`
+	Font        string   `form:"font"`        // Only gaze on panels showing this font
+	Transparent bool     `form:"transparent"` // Leave low-density areas transparent instead of white
+}
+
+func (r heatmapRequest) sigma() float64 {
+	if r.Sigma != nil {
+		return *r.Sigma
+	}
+	return defaultHeatmapSigma
+}
+
+func (r heatmapRequest) validate() string {
+	if r.Sigma != nil && (*r.Sigma <= 0 || *r.Sigma > 500) {
+		return "sigma must be between 0 and 500 pixels"
+	}
+	if r.Width < 0 || r.Height < 0 || r.Width > maxHeatmapSize || r.Height > maxHeatmapSize {
+		return "width and height must be at most " + strconv.Itoa(maxHeatmapSize) + " pixels"
+	}
+	if r.Font != "" && r.Font != "serif" && r.Font != "sans" {
+		return "font must be serif or sans"
+	}
+	return ""
+}
+
+// screenSize returns the size to draw the sessions' gaze data at: the
+// requested size, else the most common screen size of the sessions, else
+// the default
+func screenSize(reqWidth, reqHeight int, sessions []StudySession) (int, int) {
+	counts := make(map[[2]int]int)
+	var best [2]int
+	for _, s := range sessions {
+		if s.ScreenWidth <= 0 || s.ScreenHeight <= 0 {
+			continue
+		}
+		size := [2]int{s.ScreenWidth, s.ScreenHeight}
+		counts[size]++
+		if counts[size] > counts[best] {
+			best = size
+		}
+	}
+	width, height := best[0], best[1]
+	if width == 0 {
+		width, height = defaultHeatmapWidth, defaultHeatmapHeight
+	}
+	if reqWidth > 0 {
+		width = reqWidth
+	}
+	if reqHeight > 0 {
+		height = reqHeight
+	}
+	if width > maxHeatmapSize {
+		width = maxHeatmapSize
+	}
+	if height > maxHeatmapSize {
+		height = maxHeatmapSize
+	}
+	return width, height
+}
+
+// heatmapPoints loads the gaze points of the sessions that match the
+// request, scaling each session's points from its own screen size to
+// width×height so sessions on different screens can be combined. Fonts
+// alternate between panels from passage to passage, so a font filter keeps
+// each point whose panel showed that font on the point's passage.
+func heatmapPoints(db *gorm.DB, req heatmapRequest, sessions []StudySession, width, height int) ([]analysis.Point, error) {
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	ids := make([]uint, len(sessions))
+	byID := make(map[uint]StudySession, len(sessions))
+	scale := make(map[uint][2]float64, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.ID
+		byID[s.ID] = s
+		sx, sy := 1.0, 1.0
+		if s.ScreenWidth > 0 && s.ScreenHeight > 0 {
+			sx = float64(width) / float64(s.ScreenWidth)
+			sy = float64(height) / float64(s.ScreenHeight)
+		}
+		scale[s.ID] = [2]float64{sx, sy}
+	}
+
+	passages := make(map[uint]Passage)
+	if req.Font != "" {
+		var list []Passage
+		if err := db.Where("id IN (?)", db.Model(&GazePoint{}).Distinct("passage_id").Where("session_id IN ?", ids)).Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, p := range list {
+			passages[p.ID] = p
+		}
+	}
+
+	query := db.Model(&GazePoint{}).Select("id", "session_id", "x", "y", "panel", "passage_id").Where("session_id IN ?", ids)
+	if req.PassageID != nil {
+		query = query.Where("passage_id = ?", *req.PassageID)
+	}
+	if req.Panel != "" {
+		query = query.Where("panel = ?", req.Panel)
+	}
+	if req.Phase != "" {
+		query = query.Where("phase = ?", req.Phase)
+	}
+
+	var points []analysis.Point
+	var batch []GazePoint
+	err := query.FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, n int) error {
+		for _, p := range batch {
+			if req.Font != "" {
+				var passage Passage
+				if p.PassageID != nil {
+					passage = passages[*p.PassageID]
+					passage.ID = *p.PassageID
+				}
+				if panelFont(byID[p.SessionID], passage, p.Panel) != req.Font {
+					continue
+				}
+			}
+			s := scale[p.SessionID]
+			points = append(points, analysis.Point{X: p.X * s[0], Y: p.Y * s[1]})
+		}
+		return nil
+	}).Error
+	return points, err
+}
+
+// heatmapColors maps normalized density to colour, from blue through green
+// and yellow to red
+var heatmapColors = []color.NRGBA{
+	{0, 0, 255, 0},
+	{0, 128, 255, 160},
+	{0, 220, 0, 190},
+	{255, 230, 0, 215},
+	{255, 0, 0, 235},
+}
+
+// heatmapMinDensity is the fraction of the peak density below which pixels
+// are left uncoloured
+const heatmapMinDensity = 0.03
+
+func heatmapColor(v float64) color.NRGBA {
+	if v <= 0 {
+		return heatmapColors[0]
+	}
+	if v >= 1 {
+		return heatmapColors[len(heatmapColors)-1]
+	}
+	pos := v * float64(len(heatmapColors)-1)
+	i := int(pos)
+	t := pos - float64(i)
+	a, b := heatmapColors[i], heatmapColors[i+1]
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*t)
+	}
+	return color.NRGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
+
+// renderHeatmap draws a density grid as an image, on white unless
+// transparent is set
+func renderHeatmap(grid analysis.DensityGrid, transparent bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, grid.Width, grid.Height))
+	for y := 0; y < grid.Height; y++ {
+		for x := 0; x < grid.Width; x++ {
+			v := 0.0
+			if grid.Max > 0 {
+				v = grid.At(float64(x)+0.5, float64(y)+0.5) / grid.Max
+			}
+			c := color.NRGBA{}
+			if v >= heatmapMinDensity {
+				c = heatmapColor(v)
+			}
+			if !transparent {
+				c = overWhite(c)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// overWhite composites c onto an opaque white background
+func overWhite(c color.NRGBA) color.NRGBA {
+	a := float64(c.A) / 255
+	blend := func(v uint8) uint8 {
+		return uint8(float64(v)*a + 255*(1-a))
+	}
+	return color.NRGBA{blend(c.R), blend(c.G), blend(c.B), 255}
+}
+
+// writeHeatmap renders the heatmap of the sessions' gaze points as a PNG
+func writeHeatmap(c *gin.Context, req heatmapRequest, sessions []StudySession) {
+	db := dbFrom(c)
+	width, height := screenSize(req.Width, req.Height, sessions)
+	points, err := heatmapPoints(db, req, sessions, width, height)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch gaze points: " + err.Error()})
+		return
+	}
+
+	grid := analysis.Density(points, width, height, req.sigma())
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, renderHeatmap(grid, req.Transparent)); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to render heatmap: " + err.Error()})
+		return
+	}
+
+	c.Header("X-Gaze-Points", strconv.Itoa(len(points)))
+	c.Header("X-Sessions", strconv.Itoa(len(sessions)))
+	c.Data(200, "image/png", buf.Bytes())
+}
+
+func bindHeatmapRequest(c *gin.Context) (heatmapRequest, bool) {
+	var req heatmapRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid parameters: " + err.Error()})
+		return req, false
+	}
+	if msg := req.validate(); msg != "" {
+		c.JSON(400, gin.H{"error": msg})
+		return req, false
+	}
+	return req, true
+}
+
+// handleAdminSessionHeatmap renders a heatmap of one session's gaze points,
+// sized to the session's screen
+func handleAdminSessionHeatmap(c *gin.Context) {
+	var session StudySession
+	if !findSession(c, &session) {
+		return
+	}
+	req, ok := bindHeatmapRequest(c)
+	if !ok {
+		return
+	}
+
+	writeHeatmap(c, req, []StudySession{session})
+}
+
+// handleAdminHeatmap renders a heatmap aggregated over sessions, optionally
+// only of the gaze points on one passage or on panels showing one font.
+// Excluded sessions are left out unless include_excluded is set.
+func handleAdminHeatmap(c *gin.Context) {
+	db := dbFrom(c)
+	req, ok := bindHeatmapRequest(c)
+	if !ok {
+		return
+	}
+
+	query := db.Order("id ASC")
+	if req.PassageID != nil {
+		query = query.Where("id IN (?)", db.Model(&GazePoint{}).Select("session_id").Where("passage_id = ?", *req.PassageID))
+	}
+
+	var sessions []StudySession
+	if err := query.Find(&sessions).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch sessions: " + err.Error()})
+		return
+	}
+	sessions, excluded, err := excludeSessions(db, sessions, includeExcluded(c))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to evaluate exclusion rules: " + err.Error()})
+		return
+	}
+
+	c.Header("X-Excluded-Sessions", strconv.Itoa(excluded))
+	writeHeatmap(c, req, sessions)
+}
@@ -2,82 +2,128 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-var db *gorm.DB
+// corsAllowOrigins lists the frontend origins allowed to call the API. It
+// is set from the configuration at startup (see config.go).
+var corsAllowOrigins = defaultConfig().CORS.AllowOrigins
 
 func main() {
-	// Initialize database
-	var err error
-	db, err = gorm.Open(sqlite.Open("readability.db"), &gorm.Config{})
+	// Flags come before any subcommand, e.g. --config staging.yaml token list
+	flag.Usage = func() { fmt.Fprint(os.Stderr, commandUsage) }
+	configPath := flag.String("config", "", "YAML config file (default $"+configFileEnv+")")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
-	}
-
-	// Auto-migrate the schema
-	err = db.AutoMigrate(
-		&Participant{},
-		&StudySession{},
-		&CalibrationData{},
-		&AccuracyMeasurement{},
-		&QuizResponse{},
-		&GazePoint{},
-		&ReadingEvent{},
-		&StudyText{},
-		&Passage{},
-		&QuizQuestion{},
-	)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	applyConfig(cfg)
+
+	// Subcommands such as "token create" run instead of the server
+	if flag.NArg() > 0 {
+		if err := runCommand(cfg, flag.Args()); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	store, err := initStore(cfg.Database)
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		log.Fatal(err)
 	}
+	defer store.Close()
 
 	fmt.Println("Database initialized successfully")
 
+	router, err := newRouter(cfg, store)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Seed initial data if database is empty
+	if cfg.Seed.DefaultStudyText {
+		seedInitialData(store.DB())
+	}
+
+	// The admin API is unusable until a token exists
+	var tokenCount int64
+	store.DB().Model(&AdminToken{}).Where("revoked_at IS NULL").Count(&tokenCount)
+	if tokenCount == 0 {
+		fmt.Println("No admin tokens found. Create one with: go run . token create --name <name> --role owner")
+	}
+
+	port := cfg.Server.Port
+	fmt.Printf("Server starting on port %s\n", port)
+	log.Fatal(router.Run(":" + port))
+}
+
+// newRouter sets up the API routes and middleware, serving requests from
+// the given store
+func newRouter(cfg Config, store Store) (*gin.Engine, error) {
 	// Setup Gin router
 	router := gin.Default()
 
 	// Configure trusted proxies (security best practice)
-	// For local development, we don't trust any proxies
-	// In production, configure this based on your infrastructure
-	router.SetTrustedProxies(nil)
+	// By default no proxies are trusted; behind a reverse proxy, list it in
+	// server.trusted_proxies
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return nil, err
+	}
 
 	// Configure CORS middleware
 	config := cors.DefaultConfig()
-	config.AllowOrigins = []string{"http://localhost:5173", "http://localhost:4173", "http://localhost:3000"}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Content-Type"}
+	config.AllowOrigins = corsAllowOrigins
+	config.AllowMethods = cfg.CORS.AllowMethods
+	config.AllowHeaders = cfg.CORS.AllowHeaders
 	router.Use(cors.New(config))
+	router.Use(useStore(store))
 
 	// API routes
 	api := router.Group("/api")
 	{
 		api.POST("/participant", handleParticipant)
+		api.POST("/participant/withdraw", handleParticipantWithdraw)
+		api.GET("/consent-form", handleConsentForm)
+		api.POST("/consent", handleConsent)
 		api.POST("/session", handleSession)
+		api.POST("/session/start", handleSessionStart)
+		api.GET("/session/:uid", handleGetSession)
+		api.PATCH("/session/:uid", handleSessionUpdate)
 		api.POST("/quiz-response", handleQuizResponse)
 		api.POST("/calibration", handleCalibration)
 		api.POST("/gaze-point", handleGazePoint)
+		api.POST("/gaze-points/batch", handleGazePointBatch)
+		api.GET("/sessions/:uid/gaze-stream", handleGazeStream)
+		api.POST("/sessions/:uid/layout", handleSessionLayout)
 		api.POST("/reading-event", handleReadingEvent)
 		api.POST("/accuracy", handleAccuracy)
+		api.POST("/sessions/:uid/validation", handleSessionValidation)
 		api.GET("/study-text", handleStudyText)
 		api.GET("/quiz-questions", handleQuizQuestions)
 		api.GET("/health", handleHealth)
 
-		// Admin routes
-		admin := api.Group("/admin")
+		// Admin routes, authenticated with API tokens (see auth.go)
+		admin := api.Group("/admin", adminAuth())
 		{
 			admin.POST("/study-text", handleAdminStudyText)
 			admin.PUT("/study-text", handleAdminStudyText)
 			admin.GET("/study-text", handleAdminStudyText)
+			admin.POST("/study-text/import", handleAdminImportStudyBundle)
+			admin.GET("/study-text/:id/export", handleAdminExportStudyBundle)
 			admin.POST("/passage", handleAdminPassage)
 			admin.PUT("/passage", handleAdminPassage)
 			admin.DELETE("/passage", handleAdminPassage)
@@ -86,19 +132,49 @@ func main() {
 			admin.PUT("/quiz-question", handleAdminQuizQuestion)
 			admin.DELETE("/quiz-question", handleAdminQuizQuestion)
 			admin.GET("/quiz-question", handleAdminQuizQuestion)
+			admin.GET("/sessions", handleAdminSessions)
+			admin.GET("/sessions/:id", handleAdminSessionDetail)
+			admin.GET("/participants", handleAdminParticipants)
+			admin.GET("/sessions/:id/fixations", handleAdminFixations)
+			admin.POST("/sessions/:id/fixations", handleAdminFixations)
+			admin.POST("/fixations/recompute", handleAdminRecomputeFixations)
+			admin.GET("/sessions/:id/aois", handleAdminSessionAOIs)
+			admin.GET("/sessions/:id/reading-measures", handleAdminSessionReadingMeasures)
+			admin.GET("/reading-measures", handleAdminReadingMeasures)
+			admin.GET("/condition-cells", handleAdminConditionCells)
+			admin.GET("/export", handleAdminExport)
+			admin.GET("/sessions/:id/heatmap.png", handleAdminSessionHeatmap)
+			admin.GET("/sessions/:id/scanpath.svg", handleAdminScanpath)
+			admin.GET("/heatmap.png", handleAdminHeatmap)
+			admin.GET("/sessions/:id/accuracy", handleAdminSessionAccuracy)
+			admin.GET("/sessions/:id/quality", handleAdminSessionQuality)
+			admin.GET("/sessions/:id/exclusion", handleAdminSessionExclusion)
+			admin.GET("/exclusions", handleAdminExclusions)
+			admin.GET("/stats/font-comparison", handleAdminFontComparison)
+			admin.GET("/stats/quiz-items", handleAdminQuizItems)
+			admin.POST("/exclusion-rule", handleAdminExclusionRule)
+			admin.PUT("/exclusion-rule", handleAdminExclusionRule)
+			admin.DELETE("/exclusion-rule", handleAdminExclusionRule)
+			admin.GET("/exclusion-rule", handleAdminExclusionRule)
+			admin.POST("/accuracy/recompute", handleAdminRecomputeAccuracy)
+			admin.GET("/platform-report", handleAdminPlatformReport)
+			admin.POST("/consent-form", handleAdminConsentForm)
+			admin.PUT("/consent-form", handleAdminConsentForm)
+			admin.DELETE("/consent-form", handleAdminConsentForm)
+			admin.GET("/consent-form", handleAdminConsentForm)
+			admin.GET("/consent-records", handleAdminConsentRecords)
+			admin.POST("/participants/:id/erase", requireRole(RoleOwner), handleAdminEraseParticipant)
+			admin.GET("/erasures", handleAdminErasures)
+
+			tokens := admin.Group("/tokens", requireRole(RoleOwner))
+			{
+				tokens.GET("", handleAdminListTokens)
+				tokens.POST("", handleAdminCreateToken)
+				tokens.DELETE("/:id", handleAdminRevokeToken)
+			}
 		}
 	}
-
-	// Seed initial data if database is empty
-	seedInitialData()
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	fmt.Printf("Server starting on port %s\n", port)
-	log.Fatal(router.Run(":" + port))
+	return router, nil
 }
 
 func handleHealth(c *gin.Context) {
@@ -106,17 +182,72 @@ func handleHealth(c *gin.Context) {
 }
 
 func handleParticipant(c *gin.Context) {
-	var participant Participant
-	if err := c.ShouldBindJSON(&participant); err != nil {
+	db := dbFrom(c)
+	var req struct {
+		Source   string `json:"source"`
+		EntryURL string `json:"entry_url"` // URL the participant arrived on, with any recruitment platform IDs
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
 		return
 	}
 
+	// Participants recruited on Prolific or MTurk are deduplicated by platform ID (see platform.go)
+	var entry *platformEntry
+	if req.EntryURL != "" {
+		var err error
+		if entry, err = parsePlatformEntry(req.EntryURL); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// Set default source if not provided
+	participant := Participant{Source: req.Source}
 	if participant.Source == "" {
 		participant.Source = "web"
+		if entry != nil {
+			participant.Source = entry.Platform
+		}
+	}
+
+	// Participants get a token to withdraw from the study with (see erasure.go);
+	// returning platform participants get a new one
+	withdrawalToken, withdrawalTokenHash, err := generateWithdrawalToken()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create withdrawal token: " + err.Error()})
+		return
 	}
 
+	if entry != nil {
+		participant, created, err := registerPlatformParticipant(db, *entry, participant.Source, withdrawalTokenHash)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to save participant: " + err.Error()})
+			return
+		}
+		if !created {
+			c.JSON(200, gin.H{
+				"success":          true,
+				"id":               participant.ID,
+				"source":           participant.Source,
+				"platform":         participant.Platform,
+				"returning":        true,
+				"withdrawal_token": withdrawalToken,
+			})
+			return
+		}
+		c.JSON(201, gin.H{
+			"success":          true,
+			"id":               participant.ID,
+			"source":           participant.Source,
+			"platform":         participant.Platform,
+			"returning":        false,
+			"withdrawal_token": withdrawalToken,
+		})
+		return
+	}
+	participant.WithdrawalTokenHash = withdrawalTokenHash
+
 	// Create participant in database
 	if err := db.Create(&participant).Error; err != nil {
 		c.JSON(500, gin.H{"error": "Failed to save participant: " + err.Error()})
@@ -124,21 +255,86 @@ func handleParticipant(c *gin.Context) {
 	}
 
 	c.JSON(201, gin.H{
-		"success": true,
-		"id":      participant.ID,
-		"source":  participant.Source,
+		"success":          true,
+		"id":               participant.ID,
+		"source":           participant.Source,
+		"withdrawal_token": withdrawalToken,
 	})
 }
 
 func handleSession(c *gin.Context) {
+	db := dbFrom(c)
 	var session StudySession
 	if err := c.ShouldBindJSON(&session); err != nil {
 		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
 		return
 	}
 
-	// Create session in database
-	if err := db.Create(&session).Error; err != nil {
+	// Scores, counterbalancing and gaze stream state are set by the server
+	session.ID = 0
+	session.QuizCorrect, session.QuizAnswered, session.QuizTotal, session.QuizScore = 0, 0, 0, nil
+	session.ConditionCell, session.Assignment = nil, ""
+	session.GazeStreamSeq = 0
+	session.CompletedAt = nil
+	for i := range session.QuizResponses {
+		response := &session.QuizResponses[i]
+		response.ID, response.IsCorrect, response.Backfilled = 0, nil, false
+		response.Session = StudySession{}
+		if response.Timestamp.IsZero() {
+			response.Timestamp = time.Now()
+		}
+	}
+
+	// Sessions start at the beginning of the study and move on, up to
+	// completion, through PATCH /api/session/:uid
+	if session.Status == "" {
+		session.Status = SessionStatusCreated
+	}
+	if session.Status != SessionStatusCreated {
+		c.JSON(400, gin.H{"error": "Sessions are created with status created; update them with PATCH /api/session/:uid"})
+		return
+	}
+
+	// Gaze and session data may only be stored with the participant's consent
+	if !requireConsent(c, session) {
+		return
+	}
+
+	// Platform IDs are set by the server, and platform participants may
+	// complete each study only once
+	session.PlatformStudyID, session.PlatformSessionID, session.CompletionCode = "", "", ""
+	var participant Participant
+	if err := db.First(&participant, session.ParticipantID).Error; err == nil {
+		participant.applyPlatformIDs(&session)
+
+		studyTextID, err := quizStudyTextID(db, session)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(500, gin.H{"error": "Failed to check previous sessions: " + err.Error()})
+			return
+		}
+		repeat, err := completedPlatformStudy(db, participant, studyTextID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check previous sessions: " + err.Error()})
+			return
+		}
+		if repeat {
+			c.JSON(409, gin.H{"error": "Participant has already completed this study"})
+			return
+		}
+	}
+
+	// Create session in database. Of its related data, only quiz responses
+	// may be sent with it, and those are scored by the server.
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Participant", "CalibrationData", "AccuracyMeasurements", "GazePoints", "ReadingEvents", "Fixations", "Saccades").Create(&session).Error; err != nil {
+			return err
+		}
+		if len(session.QuizResponses) == 0 {
+			return nil
+		}
+		return scoreSessionQuiz(tx, session)
+	})
+	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to save session: " + err.Error()})
 		return
 	}
@@ -150,20 +346,181 @@ func handleSession(c *gin.Context) {
 	})
 }
 
+// handleSessionStart creates a session at the start of the study and assigns
+// it a counterbalanced passage order and font layout
+func handleSessionStart(c *gin.Context) {
+	db := dbFrom(c)
+	var req struct {
+		ParticipantID uint   `json:"participant_id"`
+		StudyTextID   uint   `json:"study_text_id"`
+		Version       string `json:"version"`
+		SessionID     string `json:"session_id"`
+		UserAgent     string `json:"user_agent"`
+		ScreenWidth   int    `json:"screen_width"`
+		ScreenHeight  int    `json:"screen_height"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+
+	if req.ParticipantID == 0 {
+		c.JSON(400, gin.H{"error": "participant_id is required"})
+		return
+	}
+
+	// Verify participant exists
+	var participant Participant
+	if err := db.First(&participant, req.ParticipantID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Participant not found"})
+		return
+	}
+
+	// Use the requested study text, or the active one
+	var studyText StudyText
+	query := db.Where("active = ?", true)
+	if req.StudyTextID != 0 {
+		query = db.Where("id = ?", req.StudyTextID)
+	} else if req.Version != "" {
+		query = db.Where("version = ?", req.Version)
+	}
+	if err := query.First(&studyText).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Study text not found"})
+		return
+	}
+
+	if !requireConsent(c, StudySession{ParticipantID: participant.ID, StudyTextID: studyText.ID}) {
+		return
+	}
+
+	// Platform participants may complete each study only once
+	repeat, err := completedPlatformStudy(db, participant, studyText.ID)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check previous sessions: " + err.Error()})
+		return
+	}
+	if repeat {
+		c.JSON(409, gin.H{"error": "Participant has already completed this study"})
+		return
+	}
+
+	session := StudySession{
+		SessionID:     req.SessionID,
+		ParticipantID: participant.ID,
+		Status:        SessionStatusCreated,
+		StudyTextID:   studyText.ID,
+		FontLeft:      studyText.FontLeft,
+		FontRight:     studyText.FontRight,
+		UserAgent:     req.UserAgent,
+		ScreenWidth:   req.ScreenWidth,
+		ScreenHeight:  req.ScreenHeight,
+	}
+	participant.applyPlatformIDs(&session)
+
+	var assignments []passageAssignment
+	err = db.Transaction(func(tx *gorm.DB) error {
+		cell, cellAssignments, err := assignCondition(tx, studyText.ID)
+		if err != nil {
+			return err
+		}
+		assignments = cellAssignments
+
+		assignmentJSON, err := json.Marshal(assignments)
+		if err != nil {
+			return err
+		}
+		session.ConditionCell = &cell.Cell
+		session.Assignment = string(assignmentJSON)
+		if len(assignments) > 0 {
+			session.FontLeft = assignments[0].FontLeft
+			session.FontRight = assignments[0].FontRight
+		} else {
+			// Legacy single-content study text: only the sides are counterbalanced
+			session.FontLeft = cell.FirstLeft
+			session.FontRight = otherFont(cell.FirstLeft)
+		}
+
+		return tx.Create(&session).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to start session: " + err.Error()})
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"success":    true,
+		"session_id": session.SessionID,
+		"id":         session.ID,
+		"assignment": gin.H{
+			"study_text_id":  studyText.ID,
+			"condition_cell": *session.ConditionCell,
+			"font_left":      session.FontLeft,
+			"font_right":     session.FontRight,
+			"passages":       assignments,
+		},
+	})
+}
+
+// quizResponseRequest is the body of POST /api/quiz-response. The session
+// is identified by its random session_id rather than its numeric ID.
+type quizResponseRequest struct {
+	SessionID    string    `json:"session_id"`
+	QuestionID   string    `json:"question_id"`
+	AnswerIndex  int       `json:"answer_index"`
+	ResponseTime int       `json:"response_time"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
 func handleQuizResponse(c *gin.Context) {
-	var quizResponse QuizResponse
-	if err := c.ShouldBindJSON(&quizResponse); err != nil {
+	db := dbFrom(c)
+	var req quizResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
 		return
 	}
+	if req.SessionID == "" || req.QuestionID == "" {
+		c.JSON(400, gin.H{"error": "session_id and question_id are required"})
+		return
+	}
+
+	var session StudySession
+	if err := db.Where("session_id = ?", req.SessionID).First(&session).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	if isFinalSessionStatus(session.Status) {
+		c.JSON(409, gin.H{"error": "Session is already " + session.Status})
+		return
+	}
+	if !requireConsent(c, session) {
+		return
+	}
+
+	// Correctness is decided by the server against the answer key
+	quizResponse := QuizResponse{
+		SessionID:    session.ID,
+		QuestionID:   req.QuestionID,
+		AnswerIndex:  req.AnswerIndex,
+		ResponseTime: req.ResponseTime,
+		Timestamp:    req.Timestamp,
+	}
 
 	// Set timestamp if not provided
 	if quizResponse.Timestamp.IsZero() {
 		quizResponse.Timestamp = time.Now()
 	}
 
-	// Create quiz response in database
-	if err := db.Create(&quizResponse).Error; err != nil {
+	// Create quiz response in database and rescore the session
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Session").Create(&quizResponse).Error; err != nil {
+			return err
+		}
+		if err := scoreSessionQuiz(tx, session); err != nil {
+			return err
+		}
+		return tx.First(&quizResponse, quizResponse.ID).Error
+	})
+	if err != nil {
 		c.JSON(500, gin.H{"error": "Failed to save quiz response: " + err.Error()})
 		return
 	}
@@ -175,6 +532,7 @@ func handleQuizResponse(c *gin.Context) {
 }
 
 func handleCalibration(c *gin.Context) {
+	db := dbFrom(c)
 	var calibration CalibrationData
 	if err := c.ShouldBindJSON(&calibration); err != nil {
 		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
@@ -186,6 +544,10 @@ func handleCalibration(c *gin.Context) {
 		calibration.Timestamp = time.Now()
 	}
 
+	if !requireSessionConsent(c, calibration.SessionID) {
+		return
+	}
+
 	// Create calibration data in database
 	if err := db.Create(&calibration).Error; err != nil {
 		c.JSON(500, gin.H{"error": "Failed to save calibration data: " + err.Error()})
@@ -199,6 +561,7 @@ func handleCalibration(c *gin.Context) {
 }
 
 func handleGazePoint(c *gin.Context) {
+	db := dbFrom(c)
 	var gazePoint GazePoint
 	if err := c.ShouldBindJSON(&gazePoint); err != nil {
 		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
@@ -210,6 +573,18 @@ func handleGazePoint(c *gin.Context) {
 		gazePoint.Timestamp = time.Now()
 	}
 
+	if !requireSessionConsent(c, gazePoint.SessionID) {
+		return
+	}
+
+	// Map the point onto the session's AOIs, if a layout has been posted
+	points := []GazePoint{gazePoint}
+	if err := assignGazePointAOIs(db, gazePoint.SessionID, points); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to map gaze point: " + err.Error()})
+		return
+	}
+	gazePoint.AOIID = points[0].AOIID
+
 	// Create gaze point in database
 	if err := db.Create(&gazePoint).Error; err != nil {
 		c.JSON(500, gin.H{"error": "Failed to save gaze point: " + err.Error()})
@@ -222,7 +597,118 @@ func handleGazePoint(c *gin.Context) {
 	})
 }
 
+const (
+	maxGazeBatchSize    = 10000 // Maximum number of points accepted in one batch request
+	gazeInsertBatchSize = 500   // Rows per INSERT statement when writing a batch
+)
+
+// gazePointBatchRequest is the body of POST /api/gaze-points/batch. The
+// session is identified by its random session_id rather than its numeric ID.
+type gazePointBatchRequest struct {
+	SessionID string      `json:"session_id"`
+	Points    []GazePoint `json:"points"`
+}
+
+// gazeBatchRejection describes a single point that failed validation
+type gazeBatchRejection struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// validateGazePoint checks a gaze point belonging to the given session and
+// fills in defaults. It returns a non-empty reason if the point is invalid.
+func validateGazePoint(point *GazePoint, sessionID uint) string {
+	if point.SessionID != 0 && point.SessionID != sessionID {
+		return fmt.Sprintf("session_id %d does not match the session's id %d", point.SessionID, sessionID)
+	}
+	if math.IsNaN(point.X) || math.IsInf(point.X, 0) || math.IsNaN(point.Y) || math.IsInf(point.Y, 0) {
+		return "x and y must be finite numbers"
+	}
+
+	point.ID = 0
+	point.SessionID = sessionID
+	point.AOIID = nil
+	if point.Timestamp.IsZero() {
+		point.Timestamp = time.Now()
+	}
+	return ""
+}
+
+func handleGazePointBatch(c *gin.Context) {
+	db := dbFrom(c)
+	var batch gazePointBatchRequest
+	if err := c.ShouldBindJSON(&batch); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+
+	if batch.SessionID == "" {
+		c.JSON(400, gin.H{"error": "session_id is required"})
+		return
+	}
+	if len(batch.Points) == 0 {
+		c.JSON(400, gin.H{"error": "points must contain at least one gaze point"})
+		return
+	}
+	if len(batch.Points) > maxGazeBatchSize {
+		c.JSON(413, gin.H{"error": fmt.Sprintf("Batch too large: %d points (maximum %d)", len(batch.Points), maxGazeBatchSize)})
+		return
+	}
+
+	// Verify session exists
+	var session StudySession
+	if err := db.Where("session_id = ?", batch.SessionID).First(&session).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+	if !requireConsent(c, session) {
+		return
+	}
+
+	// Validate each point, keeping the valid ones for insertion
+	accepted := make([]GazePoint, 0, len(batch.Points))
+	rejected := []gazeBatchRejection{}
+	for i := range batch.Points {
+		point := batch.Points[i]
+		if reason := validateGazePoint(&point, session.ID); reason != "" {
+			rejected = append(rejected, gazeBatchRejection{Index: i, Error: reason})
+			continue
+		}
+		accepted = append(accepted, point)
+	}
+
+	if len(accepted) == 0 {
+		c.JSON(400, gin.H{
+			"error":    "No valid gaze points in batch",
+			"accepted": 0,
+			"rejected": len(rejected),
+			"errors":   rejected,
+		})
+		return
+	}
+
+	// Insert all valid points in a single transaction
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := assignGazePointAOIs(tx, session.ID, accepted); err != nil {
+			return err
+		}
+		return tx.Omit("Session").CreateInBatches(&accepted, gazeInsertBatchSize).Error
+	})
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to save gaze points: " + err.Error()})
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"success":  true,
+		"accepted": len(accepted),
+		"rejected": len(rejected),
+		"errors":   rejected,
+	})
+}
+
 func handleReadingEvent(c *gin.Context) {
+	db := dbFrom(c)
 	var readingEvent ReadingEvent
 	if err := c.ShouldBindJSON(&readingEvent); err != nil {
 		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
@@ -247,6 +733,7 @@ func handleReadingEvent(c *gin.Context) {
 }
 
 func handleAccuracy(c *gin.Context) {
+	db := dbFrom(c)
 	var accuracy AccuracyMeasurement
 	if err := c.ShouldBindJSON(&accuracy); err != nil {
 		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
@@ -258,8 +745,19 @@ func handleAccuracy(c *gin.Context) {
 		accuracy.Timestamp = time.Now()
 	}
 
+	// Only the percentage is reported by the browser; error, precision and
+	// per-target results come from server-side validation
+	accuracy.ID = 0
+	accuracy.Method = "client"
+	accuracy.SampleCount = 0
+	accuracy.MeanErrorPX, accuracy.MeanErrorDeg = nil, nil
+	accuracy.PrecisionRMSPX, accuracy.PrecisionRMSDeg = nil, nil
+	accuracy.ThresholdDeg = nil
+	accuracy.PixelsPerCM, accuracy.ViewingDistanceCM = 0, 0
+	accuracy.Passed = accuracy.Accuracy >= clientAccuracyPassPercent
+
 	// Create accuracy measurement in database
-	if err := db.Create(&accuracy).Error; err != nil {
+	if err := db.Omit("Targets", "Session").Create(&accuracy).Error; err != nil {
 		c.JSON(500, gin.H{"error": "Failed to save accuracy measurement: " + err.Error()})
 		return
 	}
@@ -271,6 +769,7 @@ func handleAccuracy(c *gin.Context) {
 }
 
 func handleStudyText(c *gin.Context) {
+	db := dbFrom(c)
 	// Get version from query parameter, default to "default"
 	version := c.DefaultQuery("version", "default")
 
@@ -302,11 +801,12 @@ func handleStudyText(c *gin.Context) {
 }
 
 func handleQuizQuestions(c *gin.Context) {
+	db := dbFrom(c)
 	// Get study_text_id from query parameter
 	studyTextID := c.Query("study_text_id")
 
 	var questions []QuizQuestion
-	query := db.Order("`order` ASC")
+	query := db.Order("\"order\" ASC")
 
 	if studyTextID != "" {
 		query = query.Where("study_text_id = ?", studyTextID)
@@ -330,7 +830,6 @@ func handleQuizQuestions(c *gin.Context) {
 		ID      string   `json:"id"`
 		Prompt  string   `json:"prompt"`
 		Choices []string `json:"choices"`
-		Answer  int      `json:"answer"`
 	}
 
 	response := make([]QuizQResponse, len(questions))
@@ -345,7 +844,6 @@ func handleQuizQuestions(c *gin.Context) {
 			ID:      q.QuestionID,
 			Prompt:  q.Prompt,
 			Choices: choices,
-			Answer:  q.Answer,
 		}
 	}
 
@@ -355,6 +853,7 @@ func handleQuizQuestions(c *gin.Context) {
 // Admin endpoints for managing study text, passages, and quiz questions
 
 func handleAdminPassage(c *gin.Context) {
+	db := dbFrom(c)
 	switch c.Request.Method {
 	case "POST":
 		// Create new passage
@@ -380,7 +879,7 @@ func handleAdminPassage(c *gin.Context) {
 		// If order not specified, set it to the next available order
 		if passage.Order == 0 {
 			var maxOrder int
-			db.Model(&Passage{}).Where("study_text_id = ?", passage.StudyTextID).Select("COALESCE(MAX(`order`), -1)").Scan(&maxOrder)
+			db.Model(&Passage{}).Where("study_text_id = ?", passage.StudyTextID).Select("COALESCE(MAX(\"order\"), -1)").Scan(&maxOrder)
 			passage.Order = maxOrder + 1
 		}
 
@@ -488,7 +987,7 @@ func handleAdminPassage(c *gin.Context) {
 		} else if studyTextID != "" {
 			// Get all passages for a study text
 			var passages []Passage
-			if err := db.Where("study_text_id = ?", studyTextID).Order("`order` ASC").Find(&passages).Error; err != nil {
+			if err := db.Where("study_text_id = ?", studyTextID).Order("\"order\" ASC").Find(&passages).Error; err != nil {
 				c.JSON(500, gin.H{"error": "Failed to fetch passages: " + err.Error()})
 				return
 			}
@@ -507,6 +1006,7 @@ func handleAdminPassage(c *gin.Context) {
 }
 
 func handleAdminStudyText(c *gin.Context) {
+	db := dbFrom(c)
 	switch c.Request.Method {
 	case "POST":
 		// Create new study text
@@ -546,7 +1046,7 @@ func handleAdminStudyText(c *gin.Context) {
 
 		if err := db.Create(&studyText).Error; err != nil {
 			// Check for unique constraint violation (fallback check)
-			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
 				c.JSON(409, gin.H{
 					"error": fmt.Sprintf("Study text with version '%s' already exists", studyText.Version),
 				})
@@ -571,6 +1071,7 @@ func handleAdminStudyText(c *gin.Context) {
 			FontLeft  string `json:"font_left,omitempty"`
 			FontRight string `json:"font_right,omitempty"`
 			Active    *bool  `json:"active,omitempty"`
+			CompletionCode *string `json:"completion_code,omitempty"`
 		}
 
 		if err := c.ShouldBindJSON(&updateData); err != nil {
@@ -609,6 +1110,9 @@ func handleAdminStudyText(c *gin.Context) {
 			}
 			studyText.Active = *updateData.Active
 		}
+		if updateData.CompletionCode != nil {
+			studyText.CompletionCode = *updateData.CompletionCode
+		}
 
 		if err := db.Save(&studyText).Error; err != nil {
 			c.JSON(500, gin.H{"error": "Failed to update study text: " + err.Error()})
@@ -640,6 +1144,7 @@ func handleAdminStudyText(c *gin.Context) {
 }
 
 func handleAdminQuizQuestion(c *gin.Context) {
+	db := dbFrom(c)
 	switch c.Request.Method {
 	case "POST":
 		// Create new quiz question
@@ -683,6 +1188,9 @@ func handleAdminQuizQuestion(c *gin.Context) {
 			c.JSON(500, gin.H{"error": "Failed to create quiz question: " + err.Error()})
 			return
 		}
+		if err := rescoreStudyTextQuizzes(db, question.StudyTextID); err != nil {
+			log.Printf("Error rescoring quizzes for study text %d: %v", question.StudyTextID, err)
+		}
 
 		c.JSON(201, gin.H{
 			"success": true,
@@ -743,6 +1251,9 @@ func handleAdminQuizQuestion(c *gin.Context) {
 			c.JSON(500, gin.H{"error": "Failed to update quiz question: " + err.Error()})
 			return
 		}
+		if err := rescoreStudyTextQuizzes(db, question.StudyTextID); err != nil {
+			log.Printf("Error rescoring quizzes for study text %d: %v", question.StudyTextID, err)
+		}
 
 		c.JSON(200, gin.H{
 			"success": true,
@@ -758,10 +1269,19 @@ func handleAdminQuizQuestion(c *gin.Context) {
 			return
 		}
 
-		if err := db.Delete(&QuizQuestion{}, id).Error; err != nil {
+		var question QuizQuestion
+		if err := db.First(&question, id).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Quiz question not found"})
+			return
+		}
+
+		if err := db.Delete(&question).Error; err != nil {
 			c.JSON(500, gin.H{"error": "Failed to delete quiz question: " + err.Error()})
 			return
 		}
+		if err := rescoreStudyTextQuizzes(db, question.StudyTextID); err != nil {
+			log.Printf("Error rescoring quizzes for study text %d: %v", question.StudyTextID, err)
+		}
 
 		c.JSON(200, gin.H{
 			"success": true,
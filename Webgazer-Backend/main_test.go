@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultWriter = io.Discard
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// testServer is the API on a fresh in-memory SQLite database
+type testServer struct {
+	t      *testing.T
+	router *gin.Engine
+	db     *gorm.DB
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	store, err := openStore(DriverSQLite, "file::memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if _, err := migrateUp(store.DB(), 0); err != nil {
+		t.Fatalf("migrateUp: %v", err)
+	}
+	router, err := newRouter(defaultConfig(), store)
+	if err != nil {
+		t.Fatalf("newRouter: %v", err)
+	}
+	return &testServer{t: t, router: router, db: store.DB()}
+}
+
+// do sends a request with the given admin token ("" for none) and body
+// (nil for none; strings are sent as they are, anything else as JSON) and
+// returns the status and the decoded JSON response
+func (s *testServer) do(method, path, token string, body interface{}) (int, map[string]interface{}) {
+	s.t.Helper()
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			s.t.Fatalf("encoding request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	var response map[string]interface{}
+	if w.Body.Len() > 0 {
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			s.t.Fatalf("%s %s: decoding response %q: %v", method, path, w.Body.String(), err)
+		}
+	}
+	return w.Code, response
+}
+
+// expect sends a request like do and fails the test unless it gets the
+// wanted status
+func (s *testServer) expect(want int, method, path, token string, body interface{}) map[string]interface{} {
+	s.t.Helper()
+	status, response := s.do(method, path, token, body)
+	if status != want {
+		s.t.Fatalf("%s %s: status %d, want %d (response %v)", method, path, status, want, response)
+	}
+	return response
+}
+
+// adminToken creates an admin token with the given role
+func (s *testServer) adminToken(role string) string {
+	s.t.Helper()
+	_, token, err := createAdminToken(s.db, "test "+role, role)
+	if err != nil {
+		s.t.Fatalf("createAdminToken: %v", err)
+	}
+	return token
+}
+
+// studyText creates an active study text
+func (s *testServer) studyText(version string) StudyText {
+	s.t.Helper()
+	studyText := StudyText{Version: version, Content: "A passage to read.", Active: true}
+	if err := s.db.Create(&studyText).Error; err != nil {
+		s.t.Fatalf("creating study text: %v", err)
+	}
+	return studyText
+}
+
+// participant registers a participant, recruited on a platform if entryURL
+// is set, and returns their ID and withdrawal token
+func (s *testServer) participant(entryURL string) (uint, string) {
+	s.t.Helper()
+	response := s.expect(201, "POST", "/api/participant", "", gin.H{"entry_url": entryURL})
+	return uint(response["id"].(float64)), response["withdrawal_token"].(string)
+}
+
+// startSession starts a session of a study text and returns its session_id
+func (s *testServer) startSession(participantID, studyTextID uint) string {
+	s.t.Helper()
+	response := s.expect(201, "POST", "/api/session/start", "", gin.H{
+		"participant_id": participantID,
+		"study_text_id":  studyTextID,
+	})
+	return response["session_id"].(string)
+}
+
+// count returns the number of rows of a model matching a condition
+func (s *testServer) count(model interface{}, query string, args ...interface{}) int64 {
+	s.t.Helper()
+	var n int64
+	if err := s.db.Model(model).Where(query, args...).Count(&n).Error; err != nil {
+		s.t.Fatalf("counting rows: %v", err)
+	}
+	return n
+}
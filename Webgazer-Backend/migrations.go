@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migration is one versioned change to the schema or data. Migrations are
+// applied in version order, each in a transaction together with its
+// schema_migrations record, and reverted in reverse order.
+//
+// The first migration creates the tables from a frozen snapshot of the
+// models (see migrations_v1.go). A change to a model needs a new migration;
+// migrations that change the schema check the current schema (e.g.
+// HasColumn) first, as databases created before migrations were introduced
+// may have it already.
+type migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // nil if the migration cannot be reverted
+}
+
+// migrations lists every migration in version order. Never change or
+// remove an applied migration; add a new one.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create tables",
+		Up:      createTables,
+		Down:    dropTables, // Only with dropAllData, see migrateDown
+	},
+	{
+		Version: 2,
+		Name:    "backfill quiz responses from quiz_responses_json",
+		Up:      backfillLegacyQuizResponses,
+		Down:    removeBackfilledQuizResponses,
+	},
+}
+
+// legacyQuizAnswer is one entry of a session's quiz_responses_json. The
+// frontend sends the answer as "answer"; older clients as "answer_index".
+type legacyQuizAnswer struct {
+	QuestionID   string `json:"question_id"`
+	Answer       *int   `json:"answer"`
+	AnswerIndex  *int   `json:"answer_index"`
+	ResponseTime int    `json:"response_time"`
+}
+
+// backfillLegacyQuizResponses creates quiz responses from the
+// quiz_responses_json of sessions for the questions without a response
+// (the frontend submits both, but individual submissions can fail) and
+// rescores those sessions
+func backfillLegacyQuizResponses(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&QuizResponse{}, "Backfilled") {
+		if err := tx.Migrator().AddColumn(&QuizResponse{}, "Backfilled"); err != nil {
+			return err
+		}
+		if err := tx.Model(&QuizResponse{}).Where("backfilled IS NULL").Update("backfilled", false).Error; err != nil {
+			return err
+		}
+	}
+
+	var sessions []StudySession
+	err := tx.Where("quiz_responses_json <> '' AND quiz_responses_json <> '[]' AND quiz_responses_json <> 'null'").
+		Order("id ASC").Find(&sessions).Error
+	if err != nil {
+		return err
+	}
+
+	backfilled := 0
+	for _, session := range sessions {
+		var answers []legacyQuizAnswer
+		if err := json.Unmarshal([]byte(session.QuizResponsesJSON), &answers); err != nil {
+			log.Printf("Skipping session %d: invalid quiz_responses_json: %v", session.ID, err)
+			continue
+		}
+
+		var answered []string
+		if err := tx.Model(&QuizResponse{}).Where("session_id = ?", session.ID).Pluck("question_id", &answered).Error; err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(answered))
+		for _, id := range answered {
+			seen[id] = true
+		}
+
+		timestamp := session.UpdatedAt
+		if session.CompletedAt != nil {
+			timestamp = *session.CompletedAt
+		}
+		var responses []QuizResponse
+		for _, a := range answers {
+			answer := a.AnswerIndex
+			if answer == nil {
+				answer = a.Answer
+			}
+			if a.QuestionID == "" || answer == nil || seen[a.QuestionID] {
+				continue
+			}
+			seen[a.QuestionID] = true
+			responses = append(responses, QuizResponse{
+				SessionID:    session.ID,
+				QuestionID:   a.QuestionID,
+				AnswerIndex:  *answer,
+				ResponseTime: a.ResponseTime,
+				Timestamp:    timestamp,
+				Backfilled:   true,
+			})
+		}
+		if len(responses) == 0 {
+			continue
+		}
+
+		if err := tx.Omit("Session").Create(&responses).Error; err != nil {
+			return err
+		}
+		if err := scoreSessionQuiz(tx, session); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		backfilled += len(responses)
+	}
+	log.Printf("Backfilled %d quiz responses", backfilled)
+	return nil
+}
+
+// removeBackfilledQuizResponses deletes the backfilled quiz responses and
+// rescores their sessions. The sessions' quiz_responses_json is unchanged.
+func removeBackfilledQuizResponses(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&QuizResponse{}, "Backfilled") {
+		return nil
+	}
+
+	var sessionIDs []uint
+	if err := tx.Model(&QuizResponse{}).Where("backfilled = ?", true).Distinct().Pluck("session_id", &sessionIDs).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("backfilled = ?", true).Delete(&QuizResponse{}).Error; err != nil {
+		return err
+	}
+	var sessions []StudySession
+	if err := tx.Where("id IN ?", sessionIDs).Find(&sessions).Error; err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := scoreSessionQuiz(tx, session); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return tx.Migrator().DropColumn(&QuizResponse{}, "Backfilled")
+}
+
+// migrationState is a migration and when it was applied, if it was
+type migrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	Unknown   bool // Applied, but not known to this version of the server
+}
+
+// appliedMigrations returns the applied migrations by version, creating
+// the schema_migrations table if needed
+func appliedMigrations(db *gorm.DB) (map[int]SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	if err := db.Order("version ASC").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]SchemaMigration, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// migrationStatus lists every known migration and any applied migration
+// this version does not know, in version order
+func migrationStatus(db *gorm.DB) ([]migrationState, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	var states []migrationState
+	for _, m := range migrations {
+		state := migrationState{Version: m.Version, Name: m.Name}
+		if r, ok := applied[m.Version]; ok {
+			state.AppliedAt = &r.AppliedAt
+			delete(applied, m.Version)
+		}
+		states = append(states, state)
+	}
+	for _, r := range applied {
+		appliedAt := r.AppliedAt
+		states = append(states, migrationState{Version: r.Version, Name: r.Name, AppliedAt: &appliedAt, Unknown: true})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Version < states[j].Version })
+	return states, nil
+}
+
+// migrateUp applies the pending migrations up to and including version
+// target (all of them if target is 0) and returns the ones applied
+func migrateUp(db *gorm.DB, target int) ([]migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	for version := range applied {
+		if !known[version] {
+			return nil, fmt.Errorf("database has migration %d, which this version of the server does not know; upgrade the server", version)
+		}
+	}
+
+	var done []migration
+	for _, m := range migrations {
+		if target > 0 && m.Version > target {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		log.Printf("Applying migration %d: %s", m.Version, m.Name)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// migrateDown reverts the latest steps applied migrations and returns the
+// ones reverted. Migration 1 is only reverted if dropAllData is set, as that
+// drops every table and all the data in them.
+func migrateDown(db *gorm.DB, steps int, dropAllData bool) ([]migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return done, fmt.Errorf("migration %d (%s) cannot be reverted", m.Version, m.Name)
+		}
+		if m.Version == 1 && !dropAllData {
+			return done, fmt.Errorf("reverting migration %d (%s) drops every table and all the data in them; pass --drop-all-data to do so", m.Version, m.Name)
+		}
+		log.Printf("Reverting migration %d: %s", m.Version, m.Name)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("reverting migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	store, err := openStore(DriverSQLite, "file::memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	defer store.Close()
+	db := store.DB()
+
+	applied, err := migrateUp(db, 1)
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("migrateUp to 1 = %d migrations, %v; want 1", len(applied), err)
+	}
+	applied, err = migrateUp(db, 0)
+	if err != nil || len(applied) != len(migrations)-1 {
+		t.Fatalf("migrateUp = %d migrations, %v; want %d", len(applied), err, len(migrations)-1)
+	}
+	if applied, err = migrateUp(db, 0); err != nil || len(applied) != 0 {
+		t.Fatalf("migrateUp again = %d migrations, %v; want none", len(applied), err)
+	}
+
+	// Session IDs are random strings, whatever the column was created as
+	if err := db.Create(&StudySession{SessionID: "session-1", Status: SessionStatusCreated}).Error; err != nil {
+		t.Fatalf("creating session: %v", err)
+	}
+	var session StudySession
+	if err := db.Where("session_id = ?", "session-1").First(&session).Error; err != nil {
+		t.Errorf("finding session by session_id: %v", err)
+	}
+
+	// Reverting stops at migration 1 unless all data may be dropped
+	reverted, err := migrateDown(db, len(migrations), false)
+	if err == nil || !strings.Contains(err.Error(), "--drop-all-data") {
+		t.Errorf("migrateDown without dropAllData: error %v, want one mentioning --drop-all-data", err)
+	}
+	if len(reverted) != len(migrations)-1 {
+		t.Errorf("migrateDown without dropAllData reverted %d migrations, want %d", len(reverted), len(migrations)-1)
+	}
+	if !db.Migrator().HasTable(&StudySession{}) {
+		t.Fatal("study_sessions dropped without dropAllData")
+	}
+
+	reverted, err = migrateDown(db, 1, true)
+	if err != nil || len(reverted) != 1 {
+		t.Fatalf("migrateDown with dropAllData = %d migrations, %v; want 1", len(reverted), err)
+	}
+	if db.Migrator().HasTable(&StudySession{}) {
+		t.Error("study_sessions not dropped")
+	}
+	states, err := migrationStatus(db)
+	if err != nil {
+		t.Fatalf("migrationStatus: %v", err)
+	}
+	for _, state := range states {
+		if state.AppliedAt != nil {
+			t.Errorf("migration %d still applied", state.Version)
+		}
+	}
+
+	if applied, err = migrateUp(db, 0); err != nil || len(applied) != len(migrations) {
+		t.Fatalf("migrateUp after reverting = %d migrations, %v; want %d", len(applied), err, len(migrations))
+	}
+}
+
+func TestMigrateUpUnknownVersion(t *testing.T) {
+	store, err := openStore(DriverSQLite, "file::memory:")
+	if err != nil {
+		t.Fatalf("openStore: %v", err)
+	}
+	defer store.Close()
+	db := store.DB()
+
+	if _, err := migrateUp(db, 0); err != nil {
+		t.Fatalf("migrateUp: %v", err)
+	}
+	latest := migrations[len(migrations)-1].Version
+	if err := db.Create(&SchemaMigration{Version: latest + 1, Name: "from a newer server"}).Error; err != nil {
+		t.Fatalf("recording migration: %v", err)
+	}
+	if _, err := migrateUp(db, 0); err == nil {
+		t.Error("migrateUp with a migration from a newer server succeeded")
+	}
+}
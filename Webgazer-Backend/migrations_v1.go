@@ -0,0 +1,425 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The schema created by migration 1, frozen as it was when migrations were
+// introduced. These structs must never change: a change to a model needs a
+// new migration, so that databases created by migration 1 get it as well.
+// Relationship fields are left out, as foreign key constraints are not
+// created (see store.go).
+
+type v1Participant struct {
+	ID                    uint   `gorm:"primaryKey"`
+	Source                string `gorm:"index"`
+	CreatedAt             time.Time
+	Platform              string  `gorm:"uniqueIndex:idx_participant_platform"`
+	PlatformParticipantID *string `gorm:"uniqueIndex:idx_participant_platform"`
+	PlatformStudyID       string
+	PlatformSessionID     string
+	PlatformSubmitURL     string
+	WithdrawalTokenHash   string
+}
+
+func (v1Participant) TableName() string { return "participants" }
+
+type v1StudySession struct {
+	ID                uint   `gorm:"primaryKey"`
+	SessionID         string `gorm:"uniqueIndex;not null"`
+	ParticipantID     uint   `gorm:"index"`
+	Status            string `gorm:"index;default:created"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	CompletedAt       *time.Time
+	CalibrationPoints int
+	FontLeft          string
+	FontRight         string
+	TimeLeftMS        int
+	TimeRightMS       int
+	TimeAMS           int
+	TimeBMS           int
+	FontPreference    string
+	PreferredFontType string
+	QuizResponsesJSON string
+	QuizCorrect       int
+	QuizAnswered      int
+	QuizTotal         int
+	QuizScore         *float64
+	UserAgent         string
+	ScreenWidth       int
+	ScreenHeight      int
+	StudyTextID       uint `gorm:"index"`
+	ConditionCell     *int
+	Assignment        string `gorm:"type:text"`
+	GazeStreamSeq     int64
+	PlatformStudyID   string
+	PlatformSessionID string
+	CompletionCode    string
+}
+
+func (v1StudySession) TableName() string { return "study_sessions" }
+
+type v1CalibrationData struct {
+	ID          uint      `gorm:"primaryKey"`
+	SessionID   uint      `gorm:"index;not null"`
+	PointIndex  int       `gorm:"not null"`
+	ClickNumber int       `gorm:"not null"`
+	X           float64   `gorm:"not null"`
+	Y           float64   `gorm:"not null"`
+	Timestamp   time.Time `gorm:"not null"`
+}
+
+func (v1CalibrationData) TableName() string { return "calibration_data" }
+
+type v1AccuracyMeasurement struct {
+	ID                uint      `gorm:"primaryKey"`
+	SessionID         uint      `gorm:"index;not null"`
+	Accuracy          float64   `gorm:"not null"`
+	Duration          int       `gorm:"not null"`
+	Passed            bool      `gorm:"not null"`
+	Timestamp         time.Time `gorm:"not null"`
+	Method            string    `gorm:"default:client"`
+	SampleCount       int
+	MeanErrorPX       *float64
+	MeanErrorDeg      *float64
+	PrecisionRMSPX    *float64
+	PrecisionRMSDeg   *float64
+	ThresholdDeg      *float64
+	ScreenWidth       int
+	ScreenHeight      int
+	PixelsPerCM       float64
+	ViewingDistanceCM float64
+}
+
+func (v1AccuracyMeasurement) TableName() string { return "accuracy_measurements" }
+
+// Migration 2 adds the backfilled column
+type v1QuizResponse struct {
+	ID           uint   `gorm:"primaryKey"`
+	SessionID    uint   `gorm:"index;not null"`
+	QuestionID   string `gorm:"not null"`
+	AnswerIndex  int    `gorm:"not null"`
+	IsCorrect    *bool
+	ResponseTime int
+	Timestamp    time.Time `gorm:"not null"`
+}
+
+func (v1QuizResponse) TableName() string { return "quiz_responses" }
+
+type v1GazePoint struct {
+	ID        uint    `gorm:"primaryKey"`
+	SessionID uint    `gorm:"index;not null"`
+	X         float64 `gorm:"not null"`
+	Y         float64 `gorm:"not null"`
+	Panel     string
+	Phase     string
+	PassageID *uint     `gorm:"index"`
+	AOIID     *uint     `gorm:"index"`
+	Timestamp time.Time `gorm:"not null"`
+}
+
+func (v1GazePoint) TableName() string { return "gaze_points" }
+
+type v1ReadingEvent struct {
+	ID        uint   `gorm:"primaryKey"`
+	SessionID uint   `gorm:"index;not null"`
+	EventType string `gorm:"not null"`
+	Panel     string `gorm:"not null"`
+	Duration  int
+	Timestamp time.Time `gorm:"not null"`
+}
+
+func (v1ReadingEvent) TableName() string { return "reading_events" }
+
+type v1StudyText struct {
+	ID             uint   `gorm:"primaryKey"`
+	Version        string `gorm:"uniqueIndex;not null"`
+	Content        string `gorm:"type:text"`
+	FontLeft       string `gorm:"default:serif"`
+	FontRight      string `gorm:"default:sans"`
+	Active         bool   `gorm:"default:true"`
+	CompletionCode string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (v1StudyText) TableName() string { return "study_texts" }
+
+type v1Passage struct {
+	ID          uint   `gorm:"primaryKey"`
+	StudyTextID uint   `gorm:"index;not null"`
+	Order       int    `gorm:"not null"`
+	Content     string `gorm:"type:text;not null"`
+	Title       string
+	FontLeft    string `gorm:"default:serif"`
+	FontRight   string `gorm:"default:sans"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (v1Passage) TableName() string { return "passages" }
+
+type v1QuizQuestion struct {
+	ID          uint   `gorm:"primaryKey"`
+	StudyTextID uint   `gorm:"index;not null"`
+	QuestionID  string `gorm:"not null"`
+	Prompt      string `gorm:"type:text;not null"`
+	Choices     string `gorm:"type:text;not null"`
+	Answer      int    `gorm:"not null"`
+	Order       int    `gorm:"default:0"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (v1QuizQuestion) TableName() string { return "quiz_questions" }
+
+type v1FixationDetection struct {
+	ID                  uint   `gorm:"primaryKey"`
+	SessionID           uint   `gorm:"uniqueIndex;not null"`
+	Algorithm           string `gorm:"not null"`
+	VelocityThreshold   float64
+	DispersionThreshold float64
+	MinDurationMS       int
+	MaxGapMS            int
+	FixationCount       int
+	SaccadeCount        int
+	ComputedAt          time.Time
+}
+
+func (v1FixationDetection) TableName() string { return "fixation_detections" }
+
+type v1Fixation struct {
+	ID          uint      `gorm:"primaryKey"`
+	SessionID   uint      `gorm:"index;not null"`
+	Index       int       `gorm:"not null"`
+	StartTime   time.Time `gorm:"not null"`
+	EndTime     time.Time `gorm:"not null"`
+	DurationMS  int       `gorm:"not null"`
+	X           float64   `gorm:"not null"`
+	Y           float64   `gorm:"not null"`
+	Dispersion  float64
+	SampleCount int
+	Panel       string
+	Phase       string
+	PassageID   *uint `gorm:"index"`
+	AOIID       *uint `gorm:"index"`
+}
+
+func (v1Fixation) TableName() string { return "fixations" }
+
+type v1Saccade struct {
+	ID                uint `gorm:"primaryKey"`
+	SessionID         uint `gorm:"index;not null"`
+	Index             int  `gorm:"not null"`
+	FromFixationIndex int
+	ToFixationIndex   int
+	StartTime         time.Time `gorm:"not null"`
+	EndTime           time.Time `gorm:"not null"`
+	DurationMS        int
+	StartX            float64
+	StartY            float64
+	EndX              float64
+	EndY              float64
+	Amplitude         float64
+	PeakVelocity      float64
+	Panel             string
+}
+
+func (v1Saccade) TableName() string { return "saccades" }
+
+type v1AOI struct {
+	ID        uint   `gorm:"primaryKey"`
+	SessionID uint   `gorm:"index;not null"`
+	PassageID uint   `gorm:"index;not null"`
+	Panel     string `gorm:"not null"`
+	Kind      string `gorm:"not null"`
+	Index     int
+	Line      int
+	Text      string
+	X         float64 `gorm:"not null"`
+	Y         float64 `gorm:"not null"`
+	Width     float64 `gorm:"not null"`
+	Height    float64 `gorm:"not null"`
+	CreatedAt time.Time
+}
+
+func (v1AOI) TableName() string { return "aois" }
+
+type v1ConditionCell struct {
+	ID           uint   `gorm:"primaryKey"`
+	StudyTextID  uint   `gorm:"uniqueIndex:idx_condition_cell;not null"`
+	Design       string `gorm:"uniqueIndex:idx_condition_cell;not null"`
+	Cell         int    `gorm:"uniqueIndex:idx_condition_cell;not null"`
+	PassageOrder string `gorm:"not null"`
+	FirstLeft    string `gorm:"not null"`
+	Count        int    `gorm:"not null;default:0"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (v1ConditionCell) TableName() string { return "condition_cells" }
+
+type v1AdminToken struct {
+	ID         uint   `gorm:"primaryKey"`
+	Name       string `gorm:"not null"`
+	Role       string `gorm:"not null"`
+	TokenHash  string `gorm:"uniqueIndex;not null"`
+	Prefix     string `gorm:"not null"`
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+func (v1AdminToken) TableName() string { return "admin_tokens" }
+
+type v1AccuracyTarget struct {
+	ID              uint    `gorm:"primaryKey"`
+	MeasurementID   uint    `gorm:"index;not null"`
+	SessionID       uint    `gorm:"index;not null"`
+	Index           int     `gorm:"not null"`
+	X               float64 `gorm:"not null"`
+	Y               float64 `gorm:"not null"`
+	SampleCount     int
+	MeanErrorPX     float64
+	MeanErrorDeg    float64
+	BiasX           float64
+	BiasY           float64
+	PrecisionRMSPX  float64
+	PrecisionRMSDeg float64
+}
+
+func (v1AccuracyTarget) TableName() string { return "accuracy_targets" }
+
+type v1ValidationSample struct {
+	ID            uint    `gorm:"primaryKey"`
+	MeasurementID uint    `gorm:"index;not null"`
+	TargetIndex   int     `gorm:"not null"`
+	X             float64 `gorm:"not null"`
+	Y             float64 `gorm:"not null"`
+	Timestamp     time.Time
+}
+
+func (v1ValidationSample) TableName() string { return "validation_samples" }
+
+type v1ExclusionRule struct {
+	ID          uint   `gorm:"primaryKey"`
+	StudyTextID uint   `gorm:"index;not null"`
+	Field       string `gorm:"not null"`
+	Operator    string `gorm:"not null"`
+	Threshold   float64
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (v1ExclusionRule) TableName() string { return "exclusion_rules" }
+
+type v1ConsentForm struct {
+	ID          uint   `gorm:"primaryKey"`
+	StudyTextID uint   `gorm:"uniqueIndex:idx_consent_form_version;not null"`
+	Version     string `gorm:"uniqueIndex:idx_consent_form_version;not null"`
+	Content     string `gorm:"type:text;not null"`
+	Items       string `gorm:"type:text"`
+	Active      bool
+	CreatedAt   time.Time
+}
+
+func (v1ConsentForm) TableName() string { return "consent_forms" }
+
+type v1ConsentRecord struct {
+	ID            uint   `gorm:"primaryKey"`
+	ParticipantID uint   `gorm:"index;not null"`
+	ConsentFormID uint   `gorm:"index;not null"`
+	StudyTextID   uint   `gorm:"index;not null"`
+	FormVersion   string `gorm:"not null"`
+	Consented     bool   `gorm:"not null"`
+	Choices       string `gorm:"type:text"`
+	UserAgent     string
+	CreatedAt     time.Time
+}
+
+func (v1ConsentRecord) TableName() string { return "consent_records" }
+
+type v1ErasureTombstone struct {
+	ID            uint   `gorm:"primaryKey"`
+	ParticipantID uint   `gorm:"index;not null"`
+	Mode          string `gorm:"not null"`
+	RequestedBy   string `gorm:"not null"`
+	Reason        string
+	Rows          string `gorm:"type:text"`
+	CreatedAt     time.Time
+}
+
+func (v1ErasureTombstone) TableName() string { return "erasure_tombstones" }
+
+// v1Tables lists the tables of migration 1 in creation order
+func v1Tables() []interface{} {
+	return []interface{}{
+		&v1Participant{},
+		&v1StudySession{},
+		&v1CalibrationData{},
+		&v1AccuracyMeasurement{},
+		&v1QuizResponse{},
+		&v1GazePoint{},
+		&v1ReadingEvent{},
+		&v1StudyText{},
+		&v1Passage{},
+		&v1QuizQuestion{},
+		&v1FixationDetection{},
+		&v1Fixation{},
+		&v1Saccade{},
+		&v1AOI{},
+		&v1ConditionCell{},
+		&v1AdminToken{},
+		&v1AccuracyTarget{},
+		&v1ValidationSample{},
+		&v1ExclusionRule{},
+		&v1ConsentForm{},
+		&v1ConsentRecord{},
+		&v1ErasureTombstone{},
+	}
+}
+
+// createTables creates the tables of migration 1, or adds missing columns
+// and indexes to a database created before migrations were introduced
+func createTables(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(v1Tables()...); err != nil {
+		return err
+	}
+	return sessionIDsAsText(tx)
+}
+
+// sessionIDsAsText changes study_sessions.session_id to text in a database
+// created from the models before migrations were introduced: gorm took the
+// field for a foreign key to the session's ID and created it as an integer
+func sessionIDsAsText(tx *gorm.DB) error {
+	columns, err := tx.Migrator().ColumnTypes(&v1StudySession{})
+	if err != nil {
+		return err
+	}
+	for _, column := range columns {
+		if column.Name() == "session_id" && !strings.EqualFold(column.DatabaseTypeName(), "text") {
+			if err := tx.Migrator().AlterColumn(&v1StudySession{}, "SessionID"); err != nil {
+				return err
+			}
+			// SQLite alters a column by recreating the table, without its indexes
+			return tx.AutoMigrate(&v1StudySession{})
+		}
+	}
+	return nil
+}
+
+// dropTables drops the tables of migration 1 and all the data in them
+func dropTables(tx *gorm.DB) error {
+	tables := v1Tables()
+	for i := len(tables) - 1; i >= 0; i-- {
+		if err := tx.Migrator().DropTable(tables[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -12,6 +12,17 @@ type Participant struct {
 	Source    string    `gorm:"index" json:"source"` // e.g., "mturk", "prolific", "internal", etc.
 	CreatedAt time.Time `json:"created_at"`
 	
+	// Recruitment platform IDs from the latest entry URL (see platform.go). A
+	// participant is unique per platform ID; nil for participants not recruited on a platform.
+	Platform              string  `gorm:"uniqueIndex:idx_participant_platform" json:"platform,omitempty"`                // "prolific" or "mturk"
+	PlatformParticipantID *string `gorm:"uniqueIndex:idx_participant_platform" json:"platform_participant_id,omitempty"` // PROLIFIC_PID or workerId
+	PlatformStudyID       string  `json:"platform_study_id,omitempty"`                                                   // STUDY_ID or hitId
+	PlatformSessionID     string  `json:"platform_session_id,omitempty"`                                                 // SESSION_ID or assignmentId
+	PlatformSubmitURL     string  `json:"platform_submit_url,omitempty"`                                                 // MTurk turkSubmitTo
+
+	// Hex-encoded SHA-256 of the token the participant can withdraw with (see erasure.go)
+	WithdrawalTokenHash string `json:"-"`
+
 	// Relationships
 	StudySessions []StudySession `gorm:"foreignKey:ParticipantID;references:ID" json:"study_sessions,omitempty"`
 }
@@ -21,7 +32,10 @@ type StudySession struct {
 	ID                uint      `gorm:"primaryKey" json:"id"`
 	SessionID         string    `gorm:"uniqueIndex;not null" json:"session_id"`
 	ParticipantID     uint      `gorm:"index" json:"participant_id"`
+	Status            string    `gorm:"index;default:created" json:"status"` // See session_lifecycle.go
 	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	CompletedAt       *time.Time `json:"completed_at,omitempty"`
 	
 	// Relationships
 	Participant        Participant        `gorm:"foreignKey:ParticipantID;references:ID" json:"participant,omitempty"`
@@ -30,6 +44,8 @@ type StudySession struct {
 	QuizResponses      []QuizResponse     `gorm:"foreignKey:SessionID;references:ID" json:"quiz_responses,omitempty"`
 	GazePoints         []GazePoint        `gorm:"foreignKey:SessionID;references:ID" json:"gaze_points,omitempty"`
 	ReadingEvents      []ReadingEvent     `gorm:"foreignKey:SessionID;references:ID" json:"reading_events,omitempty"`
+	Fixations          []Fixation         `gorm:"foreignKey:SessionID;references:ID" json:"fixations,omitempty"`
+	Saccades           []Saccade          `gorm:"foreignKey:SessionID;references:ID" json:"saccades,omitempty"`
 	
 	// Calibration data (legacy - kept for backward compatibility)
 	CalibrationPoints int `json:"calibration_points"`
@@ -47,10 +63,29 @@ type StudySession struct {
 	// Quiz responses (legacy - kept for backward compatibility)
 	QuizResponsesJSON string  `json:"quiz_responses_json"` // JSON array of {question_id, answer_index}
 	
+	// Quiz score, computed by the server from quiz responses (see quiz_scoring.go)
+	QuizCorrect  int      `json:"quiz_correct"`         // Questions answered correctly
+	QuizAnswered int      `json:"quiz_answered"`        // Questions answered (latest answer per question)
+	QuizTotal    int      `json:"quiz_total"`           // Questions in the session's study text
+	QuizScore    *float64 `json:"quiz_score,omitempty"` // QuizCorrect / QuizTotal, nil until a response is scored
+
 	// Additional metadata
 	UserAgent         string  `json:"user_agent,omitempty"`
 	ScreenWidth       int     `json:"screen_width,omitempty"`
 	ScreenHeight      int     `json:"screen_height,omitempty"`
+	
+	// Counterbalancing assignment (see counterbalance.go)
+	StudyTextID   uint   `gorm:"index" json:"study_text_id,omitempty"`
+	ConditionCell *int   `json:"condition_cell,omitempty"`              // Counterbalancing cell the session was assigned to
+	Assignment    string `gorm:"type:text" json:"assignment,omitempty"` // JSON array of {passage_id, order, font_left, font_right}
+
+	// Highest gaze stream sequence number persisted (see gaze_stream.go)
+	GazeStreamSeq int64 `json:"gaze_stream_seq"`
+
+	// Recruitment platform submission (see platform.go)
+	PlatformStudyID   string `json:"platform_study_id,omitempty"`   // Copied from the participant when the session starts
+	PlatformSessionID string `json:"platform_session_id,omitempty"` // Copied from the participant when the session starts
+	CompletionCode    string `json:"completion_code,omitempty"`     // Issued when the session is completed
 }
 
 // BeforeCreate hook to generate session ID if not provided
@@ -84,8 +119,49 @@ type AccuracyMeasurement struct {
 	Passed    bool      `gorm:"not null" json:"passed"`      // Whether it passed the threshold
 	Timestamp time.Time `gorm:"not null" json:"timestamp"`
 	
-	// Relationship
-	Session StudySession `gorm:"foreignKey:SessionID;references:ID" json:"session,omitempty"`
+	// Validation computed by the server from raw samples (see accuracy.go); nil for client-reported measurements
+	Method            string   `gorm:"default:client" json:"method"` // "client" (reported by the browser) or "server"
+	SampleCount       int      `json:"sample_count,omitempty"`
+	MeanErrorPX       *float64 `json:"mean_error_px,omitempty"` // Mean of per-target mean errors
+	MeanErrorDeg      *float64 `json:"mean_error_deg,omitempty"`
+	PrecisionRMSPX    *float64 `json:"precision_rms_px,omitempty"` // RMS sample-to-sample distance
+	PrecisionRMSDeg   *float64 `json:"precision_rms_deg,omitempty"`
+	ThresholdDeg      *float64 `json:"threshold_deg,omitempty"` // Maximum mean error to pass
+	ScreenWidth       int      `json:"screen_width,omitempty"`
+	ScreenHeight      int      `json:"screen_height,omitempty"`
+	PixelsPerCM       float64  `json:"pixels_per_cm,omitempty"`
+	ViewingDistanceCM float64  `json:"viewing_distance_cm,omitempty"`
+
+	// Relationships
+	Session StudySession     `gorm:"foreignKey:SessionID;references:ID" json:"session,omitempty"`
+	Targets []AccuracyTarget `gorm:"foreignKey:MeasurementID;references:ID" json:"targets,omitempty"`
+}
+
+// AccuracyTarget is the error measured at one target of a server-computed validation
+type AccuracyTarget struct {
+	ID              uint    `gorm:"primaryKey" json:"id"`
+	MeasurementID   uint    `gorm:"index;not null" json:"measurement_id"`
+	SessionID       uint    `gorm:"index;not null" json:"session_id"`
+	Index           int     `gorm:"not null" json:"index"` // Order of the target in the validation (0-based)
+	X               float64 `gorm:"not null" json:"x"`     // Target position
+	Y               float64 `gorm:"not null" json:"y"`
+	SampleCount     int     `json:"sample_count"`
+	MeanErrorPX     float64 `json:"mean_error_px"`
+	MeanErrorDeg    float64 `json:"mean_error_deg"`
+	BiasX           float64 `json:"bias_x"` // Mean offset of the gaze samples from the target
+	BiasY           float64 `json:"bias_y"`
+	PrecisionRMSPX  float64 `json:"precision_rms_px"`
+	PrecisionRMSDeg float64 `json:"precision_rms_deg"`
+}
+
+// ValidationSample is a raw gaze sample recorded while a validation target was shown
+type ValidationSample struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	MeasurementID uint      `gorm:"index;not null" json:"measurement_id"`
+	TargetIndex   int       `gorm:"not null" json:"target_index"`
+	X             float64   `gorm:"not null" json:"x"`
+	Y             float64   `gorm:"not null" json:"y"`
+	Timestamp     time.Time `json:"timestamp"`
 }
 
 // QuizResponse represents an individual quiz answer
@@ -94,9 +170,10 @@ type QuizResponse struct {
 	SessionID   uint      `gorm:"index;not null" json:"session_id"`
 	QuestionID  string    `gorm:"not null" json:"question_id"`  // e.g., "q1", "q2"
 	AnswerIndex int       `gorm:"not null" json:"answer_index"`  // Selected answer index (0-based)
-	IsCorrect   *bool     `json:"is_correct,omitempty"`          // Whether answer is correct (nullable)
+	IsCorrect   *bool     `json:"is_correct,omitempty"`          // Whether answer is correct, set by the server (nil for unknown questions)
 	ResponseTime int      `json:"response_time,omitempty"`       // Time to answer in milliseconds (optional)
 	Timestamp   time.Time `gorm:"not null" json:"timestamp"`
+	Backfilled  bool      `json:"backfilled,omitempty"`          // Created from the session's legacy quiz_responses_json (see migrations.go); Timestamp is the session's
 	
 	// Relationship
 	Session StudySession `gorm:"foreignKey:SessionID;references:ID" json:"session,omitempty"`
@@ -110,6 +187,8 @@ type GazePoint struct {
 	Y         float64   `gorm:"not null" json:"y"`              // Y coordinate
 	Panel     string    `json:"panel,omitempty"`                 // "A", "B", "left", "right", or empty
 	Phase     string    `json:"phase,omitempty"`                 // "start", "middle", "end", or empty
+	PassageID *uint     `gorm:"index" json:"passage_id,omitempty"` // Passage on screen when the sample was taken (optional)
+	AOIID     *uint     `gorm:"index" json:"aoi_id,omitempty"`     // Most specific AOI containing the sample (set by the server)
 	Timestamp time.Time `gorm:"not null" json:"timestamp"`
 	
 	// Relationship
@@ -137,6 +216,7 @@ type StudyText struct {
 	FontLeft  string    `gorm:"default:serif" json:"font_left"`      // Font for left panel: "serif" or "sans"
 	FontRight string    `gorm:"default:sans" json:"font_right"`      // Font for right panel: "serif" or "sans"
 	Active    bool      `gorm:"default:true" json:"active"`          // Whether this is the active version
+	CompletionCode string `json:"completion_code,omitempty"`         // Completion code configured on the recruitment platform; generated when first issued if empty
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	
@@ -177,3 +257,180 @@ type QuizQuestion struct {
 	StudyText StudyText `gorm:"foreignKey:StudyTextID;references:ID" json:"study_text,omitempty"`
 }
 
+
+// FixationDetection records the thresholds last used to detect fixations for a session
+type FixationDetection struct {
+	ID                  uint      `gorm:"primaryKey" json:"id"`
+	SessionID           uint      `gorm:"uniqueIndex;not null" json:"session_id"`
+	Algorithm           string    `gorm:"not null" json:"algorithm"` // "ivt" or "idt"
+	VelocityThreshold   float64   `json:"velocity_threshold"`        // px/s (I-VT)
+	DispersionThreshold float64   `json:"dispersion_threshold"`      // px (I-DT)
+	MinDurationMS       int       `json:"min_duration_ms"`           // Minimum fixation duration
+	MaxGapMS            int       `json:"max_gap_ms"`                // Longer gaps between samples are treated as track loss
+	FixationCount       int       `json:"fixation_count"`
+	SaccadeCount        int       `json:"saccade_count"`
+	ComputedAt          time.Time `json:"computed_at"`
+
+	// Relationship
+	Session StudySession `gorm:"foreignKey:SessionID;references:ID" json:"session,omitempty"`
+}
+
+// Fixation represents a detected fixation within a session's gaze data
+type Fixation struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	SessionID   uint      `gorm:"index;not null" json:"session_id"`
+	Index       int       `gorm:"not null" json:"index"` // Order within the session (0-based)
+	StartTime   time.Time `gorm:"not null" json:"start_time"`
+	EndTime     time.Time `gorm:"not null" json:"end_time"`
+	DurationMS  int       `gorm:"not null" json:"duration_ms"`
+	X           float64   `gorm:"not null" json:"x"` // Centroid X coordinate
+	Y           float64   `gorm:"not null" json:"y"` // Centroid Y coordinate
+	Dispersion  float64   `json:"dispersion"`        // Spatial spread in pixels
+	SampleCount int       `json:"sample_count"`      // Number of gaze points in the fixation
+	Panel       string    `json:"panel,omitempty"`   // "A", "B", "left", "right", or empty
+	Phase       string    `json:"phase,omitempty"`   // "start", "middle", "end", or empty
+	PassageID   *uint     `gorm:"index" json:"passage_id,omitempty"`
+	AOIID       *uint     `gorm:"index" json:"aoi_id,omitempty"` // Most specific AOI containing the centroid
+
+	// Relationship
+	Session StudySession `gorm:"foreignKey:SessionID;references:ID" json:"session,omitempty"`
+}
+
+// Saccade represents the movement between two consecutive fixations
+type Saccade struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	SessionID         uint      `gorm:"index;not null" json:"session_id"`
+	Index             int       `gorm:"not null" json:"index"` // Order within the session (0-based)
+	FromFixationIndex int       `json:"from_fixation_index"`
+	ToFixationIndex   int       `json:"to_fixation_index"`
+	StartTime         time.Time `gorm:"not null" json:"start_time"`
+	EndTime           time.Time `gorm:"not null" json:"end_time"`
+	DurationMS        int       `json:"duration_ms"`
+	StartX            float64   `json:"start_x"`
+	StartY            float64   `json:"start_y"`
+	EndX              float64   `json:"end_x"`
+	EndY              float64   `json:"end_y"`
+	Amplitude         float64   `json:"amplitude"`     // Distance in pixels
+	PeakVelocity      float64   `json:"peak_velocity"` // Pixels per second
+	Panel             string    `json:"panel,omitempty"`
+
+	// Relationship
+	Session StudySession `gorm:"foreignKey:SessionID;references:ID" json:"session,omitempty"`
+}
+
+// AOI kinds, from most to least specific
+const (
+	AOIKindWord  = "word"
+	AOIKindLine  = "line"
+	AOIKindPanel = "panel"
+)
+
+// AOI represents an area of interest (word, line or panel) as rendered for a
+// passage in a session. Coordinates are in the same space as GazePoint X/Y.
+type AOI struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SessionID uint      `gorm:"index;not null" json:"session_id"`
+	PassageID uint      `gorm:"index;not null" json:"passage_id"`
+	Panel     string    `gorm:"not null" json:"panel"` // Panel label as sent with gaze points
+	Kind      string    `gorm:"not null" json:"kind"`  // "word", "line" or "panel"
+	Index     int       `json:"index"`                 // Position among AOIs of the same kind (0-based)
+	Line      int       `json:"line"`                  // Line number for words and lines (0-based)
+	Text      string    `json:"text,omitempty"`        // Word or line text
+	X         float64   `gorm:"not null" json:"x"`     // Left edge
+	Y         float64   `gorm:"not null" json:"y"`     // Top edge
+	Width     float64   `gorm:"not null" json:"width"`
+	Height    float64   `gorm:"not null" json:"height"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Relationships
+	Session StudySession `gorm:"foreignKey:SessionID;references:ID" json:"session,omitempty"`
+	Passage Passage      `gorm:"foreignKey:PassageID;references:ID" json:"passage,omitempty"`
+}
+
+// ConditionCell counts the sessions assigned to one counterbalancing cell of a study text
+type ConditionCell struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	StudyTextID  uint      `gorm:"uniqueIndex:idx_condition_cell;not null" json:"study_text_id"`
+	Design       string    `gorm:"uniqueIndex:idx_condition_cell;not null" json:"design"` // Sorted passage IDs the cells were built from, e.g. "1,2,3"
+	Cell         int       `gorm:"uniqueIndex:idx_condition_cell;not null" json:"cell"`
+	PassageOrder string    `gorm:"not null" json:"passage_order"`   // Comma-separated passage IDs in presentation order
+	FirstLeft    string    `gorm:"not null" json:"first_left"`      // Font on the left panel of the first passage; sides alternate after that
+	Count        int       `gorm:"not null;default:0" json:"count"` // Number of sessions assigned to this cell
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// AdminToken is an API token for the admin endpoints. Only the SHA-256 hash
+// of the token is stored; the token itself is shown once when created.
+type AdminToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `gorm:"not null" json:"name"`          // Who or what the token is for
+	Role       string     `gorm:"not null" json:"role"`          // "viewer", "editor" or "owner"
+	TokenHash  string     `gorm:"uniqueIndex;not null" json:"-"` // Hex-encoded SHA-256 of the token
+	Prefix     string     `gorm:"not null" json:"prefix"`        // First characters of the token, to tell tokens apart
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ExclusionRule excludes sessions of a study text from analysis when a
+// session metric compares to a threshold (see exclusion.go)
+type ExclusionRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	StudyTextID uint      `gorm:"index;not null" json:"study_text_id"`
+	Field       string    `gorm:"not null" json:"field"`    // Session metric, e.g. "quiz_score"
+	Operator    string    `gorm:"not null" json:"operator"` // "<", "<=", ">", ">=", "==" or "!="
+	Threshold   float64   `json:"threshold"`                // Boolean metrics compare as 1 (true) or 0 (false)
+	Description string    `json:"description,omitempty"`    // Reason reported for excluded sessions
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ConsentForm is one version of a study text's informed consent form (see
+// consent.go). Forms are not edited once created; a changed text is a new version.
+type ConsentForm struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	StudyTextID uint      `gorm:"uniqueIndex:idx_consent_form_version;not null" json:"study_text_id"`
+	Version     string    `gorm:"uniqueIndex:idx_consent_form_version;not null" json:"version"` // e.g., "2025-03-01"
+	Content     string    `gorm:"type:text;not null" json:"content"`                            // Consent text shown to participants
+	Items       string    `gorm:"type:text" json:"items"`                                       // JSON array of {id, text, required}
+	Active      bool      `json:"active"`                                                       // Version shown to new participants
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ConsentRecord is a participant's answer to a consent form. Records are
+// never changed, so they form an audit trail of consent; they are only
+// deleted or anonymized with the rest of the participant's data (see erasure.go).
+type ConsentRecord struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ParticipantID uint      `gorm:"index;not null" json:"participant_id"`
+	ConsentFormID uint      `gorm:"index;not null" json:"consent_form_id"`
+	StudyTextID   uint      `gorm:"index;not null" json:"study_text_id"`
+	FormVersion   string    `gorm:"not null" json:"form_version"`
+	Consented     bool      `gorm:"not null" json:"consented"` // Agreed to the form and every required item
+	Choices       string    `gorm:"type:text" json:"choices"`  // JSON object of item ID to whether it was agreed to
+	UserAgent     string    `json:"user_agent,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+
+	// Relationship
+	Participant Participant `gorm:"foreignKey:ParticipantID;references:ID" json:"participant,omitempty"`
+}
+
+// ErasureTombstone records that a participant's data was deleted or
+// anonymized (see erasure.go). It holds no personal data.
+type ErasureTombstone struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	ParticipantID uint      `gorm:"index;not null" json:"participant_id"` // No longer exists if the data was deleted
+	Mode          string    `gorm:"not null" json:"mode"`                 // "delete" or "anonymize"
+	RequestedBy   string    `gorm:"not null" json:"requested_by"`         // "participant" or "admin:<token name>"
+	Reason        string    `json:"reason,omitempty"`
+	Rows          string    `gorm:"type:text" json:"rows"` // JSON object of table name to rows deleted or anonymized
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// SchemaMigration records a migration applied to the database (see migrations.go)
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"not null" json:"name"`
+	AppliedAt time.Time `gorm:"not null" json:"applied_at"`
+}
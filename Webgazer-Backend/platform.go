@@ -0,0 +1,437 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Recruitment platforms whose participant IDs are captured from the entry URL
+const (
+	PlatformProlific = "prolific"
+	PlatformMTurk    = "mturk"
+)
+
+// mturkPreviewAssignmentID is the assignmentId MTurk sends while a worker
+// previews a HIT without having accepted it
+const mturkPreviewAssignmentID = "ASSIGNMENT_ID_NOT_AVAILABLE"
+
+// maxPlatformIDLength bounds the platform IDs accepted from entry URLs
+const maxPlatformIDLength = 128
+
+var errMTurkPreview = errors.New("the HIT must be accepted before starting the study")
+
+// platformSettings configures where participants are sent on completion.
+// Both can point at a local fake of the platform for testing (see
+// scripts/fake_platform.go).
+type platformSettings struct {
+	ProlificCompletionURL string   `yaml:"prolific_completion_url"` // Prolific participants are sent here with ?cc=<completion code>
+	MTurkSubmitOrigins    []string `yaml:"mturk_submit_origins"`    // Origins accepted as turkSubmitTo
+}
+
+// platformConfig is set from the configuration at startup (see config.go)
+var platformConfig = defaultConfig().Platform
+
+// platformEntry holds the recruitment platform IDs passed in an entry URL
+type platformEntry struct {
+	Platform      string
+	ParticipantID string // PROLIFIC_PID or workerId
+	StudyID       string // STUDY_ID or hitId
+	SessionID     string // SESSION_ID or assignmentId
+	SubmitURL     string // MTurk turkSubmitTo
+}
+
+// parsePlatformEntry extracts the Prolific (PROLIFIC_PID, STUDY_ID,
+// SESSION_ID) or MTurk (workerId, assignmentId, hitId, turkSubmitTo) IDs
+// from the URL a participant arrived on. It returns nil if the URL carries
+// no platform IDs.
+func parsePlatformEntry(rawURL string) (*platformEntry, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid entry_url: %v", err)
+	}
+	q := u.Query()
+
+	var entry platformEntry
+	switch {
+	case q.Has("PROLIFIC_PID"):
+		entry = platformEntry{
+			Platform:      PlatformProlific,
+			ParticipantID: q.Get("PROLIFIC_PID"),
+			StudyID:       q.Get("STUDY_ID"),
+			SessionID:     q.Get("SESSION_ID"),
+		}
+	case q.Has("workerId") || q.Has("assignmentId"):
+		if q.Get("assignmentId") == mturkPreviewAssignmentID {
+			return nil, errMTurkPreview
+		}
+		entry = platformEntry{
+			Platform:      PlatformMTurk,
+			ParticipantID: q.Get("workerId"),
+			StudyID:       q.Get("hitId"),
+			SessionID:     q.Get("assignmentId"),
+			SubmitURL:     q.Get("turkSubmitTo"),
+		}
+		if entry.SubmitURL != "" && !allowedMTurkSubmitURL(entry.SubmitURL) {
+			return nil, fmt.Errorf("turkSubmitTo %q is not an accepted MTurk origin", entry.SubmitURL)
+		}
+	default:
+		return nil, nil
+	}
+
+	if entry.ParticipantID == "" {
+		return nil, fmt.Errorf("%s participant ID is missing from entry_url", entry.Platform)
+	}
+	for _, id := range []string{entry.ParticipantID, entry.StudyID, entry.SessionID, entry.SubmitURL} {
+		if len(id) > maxPlatformIDLength {
+			return nil, fmt.Errorf("platform IDs must be at most %d characters", maxPlatformIDLength)
+		}
+	}
+	return &entry, nil
+}
+
+// allowedMTurkSubmitURL reports whether a turkSubmitTo URL is one of the
+// configured origins, so completion redirects cannot be sent elsewhere
+func allowedMTurkSubmitURL(submitURL string) bool {
+	u, err := url.Parse(submitURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	origin := u.Scheme + "://" + u.Host
+	for _, allowed := range platformConfig.MTurkSubmitOrigins {
+		if strings.EqualFold(origin, strings.TrimSuffix(allowed, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// registerPlatformParticipant returns the participant with the entry's
+// platform ID, creating it on first entry. A returning participant keeps its
+// ID and has its study and session IDs updated to the latest entry. Either
+// way the participant's withdrawal token is replaced by the one hashed, as
+// only the latest token issued is known to the participant's browser.
+func registerPlatformParticipant(db *gorm.DB, entry platformEntry, source, withdrawalTokenHash string) (Participant, bool, error) {
+	var participant Participant
+	created := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("platform = ? AND platform_participant_id = ?", entry.Platform, entry.ParticipantID).First(&participant).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			platformID := entry.ParticipantID
+			participant = Participant{
+				Source:                source,
+				Platform:              entry.Platform,
+				PlatformParticipantID: &platformID,
+				PlatformStudyID:       entry.StudyID,
+				PlatformSessionID:     entry.SessionID,
+				PlatformSubmitURL:     entry.SubmitURL,
+				WithdrawalTokenHash:   withdrawalTokenHash,
+			}
+			created = true
+			return tx.Omit("StudySessions").Create(&participant).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		participant.PlatformStudyID = entry.StudyID
+		participant.PlatformSessionID = entry.SessionID
+		participant.PlatformSubmitURL = entry.SubmitURL
+		participant.WithdrawalTokenHash = withdrawalTokenHash
+		return tx.Model(&participant).
+			Select("platform_study_id", "platform_session_id", "platform_submit_url", "withdrawal_token_hash").
+			Updates(&participant).Error
+	})
+	return participant, created, err
+}
+
+// applyPlatformIDs copies a platform participant's current study and
+// session IDs onto a new session
+func (p Participant) applyPlatformIDs(session *StudySession) {
+	session.PlatformStudyID = p.PlatformStudyID
+	session.PlatformSessionID = p.PlatformSessionID
+}
+
+// completedPlatformStudy reports whether a platform participant has already
+// completed a session of the study text
+func completedPlatformStudy(db *gorm.DB, participant Participant, studyTextID uint) (bool, error) {
+	if participant.Platform == "" {
+		return false, nil
+	}
+	var count int64
+	err := db.Model(&StudySession{}).
+		Where("participant_id = ? AND study_text_id = ? AND status = ?", participant.ID, studyTextID, SessionStatusCompleted).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// platformCompletion tells the frontend which code to show a participant
+// who completed the study and where to send them
+type platformCompletion struct {
+	Platform    string `json:"platform"`
+	Code        string `json:"code"`
+	RedirectURL string `json:"redirect_url,omitempty"`
+}
+
+// generateCompletionCode returns a random code for study texts without a
+// configured completion code
+func generateCompletionCode() string {
+	return strings.ToUpper(generateSessionID()[:8])
+}
+
+// studyTextCompletionCode returns a study text's completion code. A study
+// text without one gets a random code the first time it is needed, which
+// is stored so every participant of the study submits the same code.
+func studyTextCompletionCode(tx *gorm.DB, studyTextID uint) (string, error) {
+	var studyText StudyText
+	if err := tx.Select("id", "completion_code").First(&studyText, studyTextID).Error; err != nil {
+		return "", err
+	}
+	if studyText.CompletionCode != "" {
+		return studyText.CompletionCode, nil
+	}
+
+	// Only set while still empty, so concurrent completions agree on the code
+	err := tx.Model(&StudyText{}).
+		Where("id = ? AND (completion_code = '' OR completion_code IS NULL)", studyTextID).
+		Update("completion_code", generateCompletionCode()).Error
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Select("id", "completion_code").First(&studyText, studyTextID).Error; err != nil {
+		return "", err
+	}
+	return studyText.CompletionCode, nil
+}
+
+// platformCompletionFor issues the completion code of a session completed
+// by a platform participant: the code of the session's study text (see
+// studyTextCompletionCode). It returns nil for participants not recruited
+// on a platform.
+func platformCompletionFor(tx *gorm.DB, session StudySession) (*platformCompletion, error) {
+	var participant Participant
+	if err := tx.First(&participant, session.ParticipantID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if participant.Platform == "" {
+		return nil, nil
+	}
+
+	studyTextID, err := quizStudyTextID(tx, session)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("session has no study text to issue a completion code for")
+	}
+	if err != nil {
+		return nil, err
+	}
+	code, err := studyTextCompletionCode(tx, studyTextID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &platformCompletion{
+		Platform:    participant.Platform,
+		Code:        code,
+		RedirectURL: completionRedirectURL(participant, session, code),
+	}, nil
+}
+
+// completionRedirectURL returns the platform page that records a
+// submission: Prolific's completion URL with the code, or MTurk's external
+// submit URL for the session's assignment
+func completionRedirectURL(participant Participant, session StudySession, code string) string {
+	switch participant.Platform {
+	case PlatformProlific:
+		u, err := url.Parse(platformConfig.ProlificCompletionURL)
+		if err != nil {
+			return ""
+		}
+		q := u.Query()
+		q.Set("cc", code)
+		u.RawQuery = q.Encode()
+		return u.String()
+	case PlatformMTurk:
+		if participant.PlatformSubmitURL == "" || session.PlatformSessionID == "" {
+			return ""
+		}
+		q := url.Values{}
+		q.Set("assignmentId", session.PlatformSessionID)
+		q.Set("completion_code", code)
+		return strings.TrimSuffix(participant.PlatformSubmitURL, "/") + "/mturk/externalSubmit?" + q.Encode()
+	}
+	return ""
+}
+
+// platformReportRow is a platform participant's session with what to do
+// with their submission on the platform
+type platformReportRow struct {
+	SessionID             uint       `json:"session_id"`
+	Platform              string     `json:"platform"`
+	PlatformParticipantID string     `json:"platform_participant_id"`
+	PlatformStudyID       string     `json:"platform_study_id"`
+	PlatformSessionID     string     `json:"platform_session_id"`
+	StudyTextID           uint       `json:"study_text_id"`
+	Status                string     `json:"status"`
+	StartedAt             time.Time  `json:"started_at"`
+	CompletedAt           *time.Time `json:"completed_at"`
+	CompletionCode        string     `json:"completion_code"`
+	Repeat                bool       `json:"repeat"` // The participant completed an earlier session of the same study text
+	Excluded              bool       `json:"excluded"`
+	ExclusionReasons      []string   `json:"exclusion_reasons"`
+	Recommendation        string     `json:"recommendation"` // "approve", "review" or "incomplete"
+}
+
+var platformReportCSVHeader = []string{
+	"session_id", "platform", "platform_participant_id", "platform_study_id", "platform_session_id",
+	"study_text_id", "status", "started_at", "completed_at", "completion_code", "repeat",
+	"excluded", "exclusion_reasons", "recommendation",
+}
+
+func (r platformReportRow) csvRecord() []string {
+	return []string{
+		formatUint(r.SessionID),
+		r.Platform,
+		r.PlatformParticipantID,
+		r.PlatformStudyID,
+		r.PlatformSessionID,
+		formatUint(r.StudyTextID),
+		r.Status,
+		formatTime(r.StartedAt),
+		formatOptionalTime(r.CompletedAt),
+		r.CompletionCode,
+		strconv.FormatBool(r.Repeat),
+		strconv.FormatBool(r.Excluded),
+		strings.Join(r.ExclusionReasons, "; "),
+		r.Recommendation,
+	}
+}
+
+// handleAdminPlatformReport lists the sessions of platform participants,
+// optionally of one platform and study text version, recommending whether
+// to approve each submission. Completed sessions are approved unless they
+// are excluded by their study's rules or repeat an earlier completion, in
+// which case they need review. Returns CSV if format=csv.
+func handleAdminPlatformReport(c *gin.Context) {
+	db := dbFrom(c)
+	platform := c.Query("platform")
+	if platform != "" && platform != PlatformProlific && platform != PlatformMTurk {
+		c.JSON(400, gin.H{"error": "platform must be prolific or mturk"})
+		return
+	}
+
+	var studyTextID uint
+	if version := c.Query("version"); version != "" {
+		var studyText StudyText
+		if err := db.Where("version = ?", version).First(&studyText).Error; err != nil {
+			c.JSON(404, gin.H{"error": fmt.Sprintf("Study text version %q not found", version)})
+			return
+		}
+		studyTextID = studyText.ID
+	}
+
+	query := db.Where("platform <> ''")
+	if platform != "" {
+		query = query.Where("platform = ?", platform)
+	}
+	var participants []Participant
+	if err := query.Find(&participants).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch participants: " + err.Error()})
+		return
+	}
+	participantByID := make(map[uint]Participant, len(participants))
+	participantIDs := make([]uint, len(participants))
+	for i, p := range participants {
+		participantByID[p.ID] = p
+		participantIDs[i] = p.ID
+	}
+
+	var sessions []StudySession
+	if len(participantIDs) > 0 {
+		if err := db.Where("participant_id IN ?", participantIDs).Order("id ASC").Find(&sessions).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to fetch sessions: " + err.Error()})
+			return
+		}
+	}
+
+	type completionKey struct {
+		participantID uint
+		studyTextID   uint
+	}
+	completed := make(map[completionKey]bool)
+	evaluator := newExclusionEvaluator(db)
+	summary := map[string]int{"approve": 0, "review": 0, "incomplete": 0}
+	rows := []platformReportRow{}
+	for _, s := range sessions {
+		textID, err := quizStudyTextID(db, s)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(500, gin.H{"error": "Failed to resolve study text: " + err.Error()})
+			return
+		}
+		if studyTextID != 0 && textID != studyTextID {
+			continue
+		}
+
+		participant := participantByID[s.ParticipantID]
+		row := platformReportRow{
+			SessionID:         s.ID,
+			Platform:          participant.Platform,
+			PlatformStudyID:   s.PlatformStudyID,
+			PlatformSessionID: s.PlatformSessionID,
+			StudyTextID:       textID,
+			Status:            s.Status,
+			StartedAt:         s.CreatedAt,
+			CompletedAt:       s.CompletedAt,
+			CompletionCode:    s.CompletionCode,
+			ExclusionReasons:  []string{},
+			Recommendation:    "incomplete",
+		}
+		if participant.PlatformParticipantID != nil {
+			row.PlatformParticipantID = *participant.PlatformParticipantID
+		}
+
+		if s.Status == SessionStatusCompleted {
+			key := completionKey{s.ParticipantID, textID}
+			row.Repeat = completed[key]
+			completed[key] = true
+
+			exclusion, err := evaluator.evaluate(s)
+			if err != nil {
+				c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to evaluate exclusion rules for session %d: %v", s.ID, err)})
+				return
+			}
+			row.Excluded = exclusion.Excluded
+			row.ExclusionReasons = exclusion.Reasons
+
+			row.Recommendation = "approve"
+			if row.Repeat || row.Excluded {
+				row.Recommendation = "review"
+			}
+		}
+		summary[row.Recommendation]++
+		rows = append(rows, row)
+	}
+
+	if c.Query("format") == "csv" {
+		records := make([][]string, len(rows))
+		for i, r := range rows {
+			records[i] = r.csvRecord()
+		}
+		writeCSV(c, "platform-report.csv", platformReportCSVHeader, records)
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    rows,
+		"summary": summary,
+	})
+}
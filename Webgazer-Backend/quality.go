@@ -0,0 +1,284 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"readability-backend/analysis"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Thresholds used to flag quality issues. Reading speeds outside the
+// plausible range suggest skimming or an interrupted reading.
+const (
+	qualityMaxGap          = 250 * time.Millisecond // Longer gaps between gaze samples count as track loss
+	qualityMinSamplingRate = 10.0                   // Hz
+	qualityMaxTrackLoss    = 20.0                   // Percent of the recording
+	qualityMaxOffScreen    = 20.0                   // Percent of samples
+	minPlausibleWPM        = 80.0
+	maxPlausibleWPM        = 800.0
+)
+
+// sessionQuality holds the data-quality metrics of a session. Metrics that
+// cannot be computed for lack of data are nil.
+type sessionQuality struct {
+	SessionID uint `json:"session_id"`
+
+	// Gaze recording
+	GazePointCount   int      `json:"gaze_point_count"`
+	GazeDurationMS   int      `json:"gaze_duration_ms"`   // First to last gaze sample
+	SamplingRateHz   *float64 `json:"sampling_rate_hz"`   // Effective rate over the recording
+	TrackLossMS      int      `json:"track_loss_ms"`      // Total length of gaps longer than 250 ms
+	TrackLossPercent *float64 `json:"track_loss_percent"` // Share of the recording lost to gaps
+	OffScreenPercent *float64 `json:"off_screen_percent"` // Share of samples outside the session's screen
+
+	// Latest calibration accuracy check, preferring server-side validations
+	AccuracyMethod   string   `json:"accuracy_method,omitempty"` // "server" or "client"
+	AccuracyPercent  *float64 `json:"accuracy_percent"`
+	AccuracyErrorDeg *float64 `json:"accuracy_error_deg"` // Server-side validations only
+	AccuracyPassed   *bool    `json:"accuracy_passed"`
+
+	// Reading time of the last passage read, as recorded on the session
+	ReadingWordCount     int      `json:"reading_word_count"`
+	ReadingSpeedAWPM     *float64 `json:"reading_speed_a_wpm"` // Words per minute in box A
+	ReadingSpeedBWPM     *float64 `json:"reading_speed_b_wpm"` // Words per minute in box B
+	ReadingTimePlausible *bool    `json:"reading_time_plausible"`
+
+	// Issues lists the metrics outside their acceptable range
+	Issues []string `json:"issues"`
+}
+
+var sessionQualityCSVHeader = []string{
+	"gaze_point_count", "gaze_duration_ms", "sampling_rate_hz", "track_loss_ms", "track_loss_percent",
+	"off_screen_percent", "accuracy_method", "accuracy_percent", "accuracy_error_deg", "accuracy_passed",
+	"reading_word_count", "reading_speed_a_wpm", "reading_speed_b_wpm", "reading_time_plausible",
+	"quality_issues",
+}
+
+func (q sessionQuality) csvRecord() []string {
+	return []string{
+		strconv.Itoa(q.GazePointCount),
+		strconv.Itoa(q.GazeDurationMS),
+		formatOptionalFloat(q.SamplingRateHz),
+		strconv.Itoa(q.TrackLossMS),
+		formatOptionalFloat(q.TrackLossPercent),
+		formatOptionalFloat(q.OffScreenPercent),
+		q.AccuracyMethod,
+		formatOptionalFloat(q.AccuracyPercent),
+		formatOptionalFloat(q.AccuracyErrorDeg),
+		formatOptionalBool(q.AccuracyPassed),
+		strconv.Itoa(q.ReadingWordCount),
+		formatOptionalFloat(q.ReadingSpeedAWPM),
+		formatOptionalFloat(q.ReadingSpeedBWPM),
+		formatOptionalBool(q.ReadingTimePlausible),
+		strings.Join(q.Issues, "; "),
+	}
+}
+
+// qualityChecker computes session quality, caching the passages of each
+// study text so many sessions can be checked cheaply
+type qualityChecker struct {
+	db       *gorm.DB
+	passages map[uint][]Passage
+	texts    map[uint]StudyText
+}
+
+func newQualityChecker(db *gorm.DB) *qualityChecker {
+	return &qualityChecker{
+		db:       db,
+		passages: make(map[uint][]Passage),
+		texts:    make(map[uint]StudyText),
+	}
+}
+
+// roundedFloat returns v rounded to two decimals, as a pointer for the
+// optional metrics
+func roundedFloat(v float64) *float64 {
+	r := math.Round(v*100) / 100
+	return &r
+}
+
+// check computes the quality metrics of a session
+func (qc *qualityChecker) check(session StudySession) (sessionQuality, error) {
+	q := sessionQuality{SessionID: session.ID, Issues: []string{}}
+
+	if err := qc.checkGaze(session, &q); err != nil {
+		return q, err
+	}
+	if err := qc.checkAccuracy(session, &q); err != nil {
+		return q, err
+	}
+	if err := qc.checkReadingTime(session, &q); err != nil {
+		return q, err
+	}
+	return q, nil
+}
+
+func (qc *qualityChecker) checkGaze(session StudySession, q *sessionQuality) error {
+	var points []GazePoint
+	err := qc.db.Select("x", "y", "timestamp").Where("session_id = ?", session.ID).Order("timestamp ASC, id ASC").Find(&points).Error
+	if err != nil {
+		return err
+	}
+	samples := make([]analysis.Sample, len(points))
+	for i, p := range points {
+		samples[i] = analysis.Sample{X: p.X, Y: p.Y, Time: p.Timestamp}
+	}
+
+	gq := analysis.ComputeGazeQuality(samples, float64(session.ScreenWidth), float64(session.ScreenHeight), qualityMaxGap)
+	q.GazePointCount = gq.SampleCount
+	q.GazeDurationMS = int(gq.Duration.Milliseconds())
+	q.TrackLossMS = int(gq.TrackLoss.Milliseconds())
+	if gq.SampleCount == 0 {
+		q.Issues = append(q.Issues, "no gaze data")
+		return nil
+	}
+	if gq.SampleCount > 1 && gq.Duration > 0 {
+		q.SamplingRateHz = roundedFloat(gq.SamplingRate)
+		q.TrackLossPercent = roundedFloat(gq.TrackLossPercent())
+		if gq.SamplingRate < qualityMinSamplingRate {
+			q.Issues = append(q.Issues, fmt.Sprintf("sampling rate below %g Hz", qualityMinSamplingRate))
+		}
+		if gq.TrackLossPercent() > qualityMaxTrackLoss {
+			q.Issues = append(q.Issues, fmt.Sprintf("track loss above %g%%", qualityMaxTrackLoss))
+		}
+	}
+	if session.ScreenWidth > 0 && session.ScreenHeight > 0 {
+		q.OffScreenPercent = roundedFloat(gq.OffScreenPercent())
+		if gq.OffScreenPercent() > qualityMaxOffScreen {
+			q.Issues = append(q.Issues, fmt.Sprintf("off-screen gaze above %g%%", qualityMaxOffScreen))
+		}
+	}
+	return nil
+}
+
+func (qc *qualityChecker) checkAccuracy(session StudySession, q *sessionQuality) error {
+	var measurements []AccuracyMeasurement
+	if err := qc.db.Where("session_id = ?", session.ID).Order("timestamp DESC, id DESC").Find(&measurements).Error; err != nil {
+		return err
+	}
+	if len(measurements) == 0 {
+		q.Issues = append(q.Issues, "no accuracy check")
+		return nil
+	}
+
+	latest := measurements[0]
+	for _, m := range measurements {
+		if m.Method == "server" {
+			latest = m
+			break
+		}
+	}
+	q.AccuracyMethod = latest.Method
+	q.AccuracyPercent = roundedFloat(latest.Accuracy)
+	if latest.MeanErrorDeg != nil {
+		q.AccuracyErrorDeg = roundedFloat(*latest.MeanErrorDeg)
+	}
+	passed := latest.Passed
+	q.AccuracyPassed = &passed
+	if !passed {
+		q.Issues = append(q.Issues, "accuracy check failed")
+	}
+	return nil
+}
+
+// readingPassageWords returns the number of words of the passage the
+// session's reading times refer to: the last passage read
+func (qc *qualityChecker) readingPassageWords(session StudySession) (int, error) {
+	studyTextID, err := quizStudyTextID(qc.db, session)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	passages, ok := qc.passages[studyTextID]
+	if !ok {
+		if err := qc.db.Where("study_text_id = ?", studyTextID).Order("\"order\" ASC").Find(&passages).Error; err != nil {
+			return 0, err
+		}
+		var text StudyText
+		if err := qc.db.Select("id", "content").First(&text, studyTextID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, err
+		}
+		qc.passages[studyTextID] = passages
+		qc.texts[studyTextID] = text
+	}
+
+	content := qc.texts[studyTextID].Content
+	if len(passages) > 0 {
+		last := passages[len(passages)-1]
+		if assignments := session.passageAssignments(); len(assignments) > 0 {
+			lastID := assignments[len(assignments)-1].PassageID
+			for _, p := range passages {
+				if p.ID == lastID {
+					last = p
+				}
+			}
+		}
+		content = last.Content
+	}
+	return len(strings.Fields(content)), nil
+}
+
+func (qc *qualityChecker) checkReadingTime(session StudySession, q *sessionQuality) error {
+	words, err := qc.readingPassageWords(session)
+	if err != nil {
+		return err
+	}
+	q.ReadingWordCount = words
+	if words == 0 || (session.TimeAMS <= 0 && session.TimeBMS <= 0) {
+		return nil
+	}
+
+	plausible := true
+	for _, box := range []struct {
+		ms    int
+		speed **float64
+	}{
+		{session.TimeAMS, &q.ReadingSpeedAWPM},
+		{session.TimeBMS, &q.ReadingSpeedBWPM},
+	} {
+		if box.ms <= 0 {
+			plausible = false
+			continue
+		}
+		wpm := float64(words) / (float64(box.ms) / 60000)
+		*box.speed = roundedFloat(wpm)
+		if wpm < minPlausibleWPM || wpm > maxPlausibleWPM {
+			plausible = false
+		}
+	}
+	q.ReadingTimePlausible = &plausible
+	if !plausible {
+		q.Issues = append(q.Issues, fmt.Sprintf("reading speed outside %g-%g words per minute", minPlausibleWPM, maxPlausibleWPM))
+	}
+	return nil
+}
+
+// handleAdminSessionQuality reports the data-quality metrics of a session
+func handleAdminSessionQuality(c *gin.Context) {
+	db := dbFrom(c)
+	var session StudySession
+	if !findSession(c, &session) {
+		return
+	}
+
+	quality, err := newQualityChecker(db).check(session)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to compute session quality: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    quality,
+	})
+}
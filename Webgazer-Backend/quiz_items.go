@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"readability-backend/analysis"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Items outside these ranges are flagged for review. A distractor chosen
+// by fewer respondents than the minimum share does not discriminate.
+const (
+	itemEasyDifficulty     = 0.9
+	itemHardDifficulty     = 0.3
+	itemMinDiscrimination  = 0.2
+	itemMinDistractorShare = 0.05
+)
+
+// quizItemChoice is how often one choice of a question was selected
+type quizItemChoice struct {
+	Index      int      `json:"index"`
+	Text       string   `json:"text"`
+	Correct    bool     `json:"correct"`
+	Count      int      `json:"count"`
+	Proportion *float64 `json:"proportion"`
+}
+
+// quizItemRow holds the item statistics of one quiz question over the
+// sessions of one font condition ("all", "serif" or "sans")
+type quizItemRow struct {
+	StudyTextID        uint             `json:"study_text_id"`
+	Version            string           `json:"version"`
+	QuizQuestionID     uint             `json:"quiz_question_id"`
+	QuestionID         string           `json:"question_id"`
+	Prompt             string           `json:"prompt"`
+	Font               string           `json:"font"`
+	Responses          int              `json:"responses"` // Sessions that answered (latest answer counts)
+	Correct            int              `json:"correct"`
+	Difficulty         *float64         `json:"difficulty"`     // Proportion correct
+	Discrimination     *float64         `json:"discrimination"` // Point-biserial correlation with the rest score
+	MeanResponseTimeMS *float64         `json:"mean_response_time_ms"`
+	Choices            []quizItemChoice `json:"choices"`
+	Flags              []string         `json:"flags"`
+}
+
+var quizItemCSVHeader = []string{
+	"study_text_id", "version", "quiz_question_id", "question_id", "prompt", "font",
+	"responses", "correct", "difficulty", "discrimination", "mean_response_time_ms",
+	"choice_counts", "flags",
+}
+
+func (r quizItemRow) csvRecord() []string {
+	counts := make([]string, len(r.Choices))
+	for i, choice := range r.Choices {
+		counts[i] = strconv.Itoa(choice.Count)
+	}
+	return []string{
+		formatUint(r.StudyTextID),
+		r.Version,
+		formatUint(r.QuizQuestionID),
+		r.QuestionID,
+		r.Prompt,
+		r.Font,
+		strconv.Itoa(r.Responses),
+		strconv.Itoa(r.Correct),
+		formatOptionalFloat(r.Difficulty),
+		formatOptionalFloat(r.Discrimination),
+		formatOptionalFloat(r.MeanResponseTimeMS),
+		strings.Join(counts, ";"),
+		strings.Join(r.Flags, "; "),
+	}
+}
+
+// quizItemAnswer is a session's latest answer to a question, with the
+// session's total score over the study text's questions
+type quizItemAnswer struct {
+	font           string
+	answerIndex    int
+	correct        bool
+	responseTimeMS int
+	totalCorrect   int
+}
+
+// analyzeQuizItem computes the statistics of a question from the answers
+// of one font condition
+func analyzeQuizItem(question QuizQuestion, version, font string, answers []quizItemAnswer) quizItemRow {
+	var choices []string
+	choicesErr := json.Unmarshal([]byte(question.Choices), &choices)
+
+	row := quizItemRow{
+		StudyTextID:    question.StudyTextID,
+		Version:        version,
+		QuizQuestionID: question.ID,
+		QuestionID:     question.QuestionID,
+		Prompt:         question.Prompt,
+		Font:           font,
+		Responses:      len(answers),
+		Choices:        make([]quizItemChoice, len(choices)),
+		Flags:          []string{},
+	}
+	if choicesErr != nil {
+		// Answers are still counted, but no choice can be reported
+		row.Flags = append(row.Flags, "choices are not a valid JSON array")
+	}
+	for i, text := range choices {
+		row.Choices[i] = quizItemChoice{Index: i, Text: text, Correct: i == question.Answer}
+	}
+
+	var items, rest, times []float64
+	for _, a := range answers {
+		item := 0.0
+		if a.correct {
+			row.Correct++
+			item = 1
+		}
+		items = append(items, item)
+		rest = append(rest, float64(a.totalCorrect)-item)
+		if a.answerIndex >= 0 && a.answerIndex < len(row.Choices) {
+			row.Choices[a.answerIndex].Count++
+		}
+		if a.responseTimeMS > 0 {
+			times = append(times, float64(a.responseTimeMS))
+		}
+	}
+	if len(answers) == 0 {
+		return row
+	}
+
+	difficulty := float64(row.Correct) / float64(len(answers))
+	row.Difficulty = &difficulty
+	for i := range row.Choices {
+		p := float64(row.Choices[i].Count) / float64(len(answers))
+		row.Choices[i].Proportion = &p
+	}
+	if r, ok := analysis.Correlation(items, rest); ok {
+		row.Discrimination = finiteFloat(r)
+	}
+	if len(times) > 0 {
+		row.MeanResponseTimeMS = finiteFloat(analysis.Mean(times))
+	}
+
+	if difficulty > itemEasyDifficulty {
+		row.Flags = append(row.Flags, "too easy")
+	}
+	if difficulty < itemHardDifficulty {
+		row.Flags = append(row.Flags, "too hard")
+	}
+	if row.Discrimination != nil && *row.Discrimination < itemMinDiscrimination {
+		row.Flags = append(row.Flags, "low discrimination")
+	}
+	for _, choice := range row.Choices {
+		if !choice.Correct && *choice.Proportion < itemMinDistractorShare {
+			row.Flags = append(row.Flags, fmt.Sprintf("distractor %d rarely chosen", choice.Index))
+		}
+	}
+	return row
+}
+
+// quizItemAnalysis computes item statistics for the questions of the given
+// study texts over the sessions not excluded by their study's rules, for
+// all sessions and for each font condition (the font on the left panel; see
+// quizByFontNote)
+func quizItemAnalysis(db *gorm.DB, studyTexts []StudyText, include bool) ([]quizItemRow, int, error) {
+	textIDs := make([]uint, len(studyTexts))
+	for i, t := range studyTexts {
+		textIDs[i] = t.ID
+	}
+
+	var questions []QuizQuestion
+	if err := db.Where("study_text_id IN ?", textIDs).Order("study_text_id ASC, \"order\" ASC, id ASC").Find(&questions).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Sessions scored against one of the study texts; sessions without a
+	// study text belong to the active one
+	var activeID uint
+	var active StudyText
+	if err := db.Where("active = ?", true).First(&active).Error; err == nil {
+		activeID = active.ID
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, err
+	}
+	query := db.Where("study_text_id IN ?", textIDs)
+	for _, id := range textIDs {
+		if id == activeID {
+			query = db.Where("study_text_id IN ? OR study_text_id = 0", textIDs)
+		}
+	}
+	var sessions []StudySession
+	if err := query.Order("id ASC").Find(&sessions).Error; err != nil {
+		return nil, 0, err
+	}
+	sessions, excluded, err := excludeSessions(db, sessions, include)
+	if err != nil {
+		return nil, 0, err
+	}
+	sessionByID := make(map[uint]StudySession, len(sessions))
+	sessionIDs := make([]uint, len(sessions))
+	for i, s := range sessions {
+		if s.StudyTextID == 0 {
+			s.StudyTextID = activeID
+		}
+		sessionByID[s.ID] = s
+		sessionIDs[i] = s.ID
+	}
+
+	// The latest answer of each session to each question counts, as in
+	// quiz scoring
+	var responses []QuizResponse
+	if len(sessionIDs) > 0 {
+		if err := db.Where("session_id IN ?", sessionIDs).Order("timestamp ASC, id ASC").Find(&responses).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	type answerKey struct {
+		sessionID  uint
+		questionID string
+	}
+	latest := make(map[answerKey]QuizResponse)
+	for _, r := range responses {
+		latest[answerKey{r.SessionID, r.QuestionID}] = r
+	}
+
+	questionsByText := make(map[uint][]QuizQuestion)
+	for _, q := range questions {
+		questionsByText[q.StudyTextID] = append(questionsByText[q.StudyTextID], q)
+	}
+	totals := make(map[uint]int)
+	for _, s := range sessions {
+		for _, q := range questionsByText[sessionByID[s.ID].StudyTextID] {
+			if r, ok := latest[answerKey{s.ID, q.QuestionID}]; ok && r.AnswerIndex == q.Answer {
+				totals[s.ID]++
+			}
+		}
+	}
+
+	var rows []quizItemRow
+	for _, text := range studyTexts {
+		for _, q := range questionsByText[text.ID] {
+			var answers []quizItemAnswer
+			for _, s := range sessions {
+				session := sessionByID[s.ID]
+				if session.StudyTextID != text.ID {
+					continue
+				}
+				r, ok := latest[answerKey{s.ID, q.QuestionID}]
+				if !ok {
+					continue
+				}
+				answers = append(answers, quizItemAnswer{
+					font:           session.FontLeft,
+					answerIndex:    r.AnswerIndex,
+					correct:        r.AnswerIndex == q.Answer,
+					responseTimeMS: r.ResponseTime,
+					totalCorrect:   totals[s.ID],
+				})
+			}
+
+			rows = append(rows, analyzeQuizItem(q, text.Version, "all", answers))
+			for _, font := range []string{"serif", "sans"} {
+				var fontAnswers []quizItemAnswer
+				for _, a := range answers {
+					if a.font == font {
+						fontAnswers = append(fontAnswers, a)
+					}
+				}
+				rows = append(rows, analyzeQuizItem(q, text.Version, font, fontAnswers))
+			}
+		}
+	}
+	return rows, excluded, nil
+}
+
+// handleAdminQuizItems reports item statistics for every quiz question,
+// optionally of one study text version, as JSON or as CSV if format=csv
+func handleAdminQuizItems(c *gin.Context) {
+	db := dbFrom(c)
+	query := db.Order("id ASC")
+	if version := c.Query("version"); version != "" {
+		query = query.Where("version = ?", version)
+	}
+	var studyTexts []StudyText
+	if err := query.Select("id", "version", "active").Find(&studyTexts).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch study texts: " + err.Error()})
+		return
+	}
+	if len(studyTexts) == 0 && c.Query("version") != "" {
+		c.JSON(404, gin.H{"error": fmt.Sprintf("Study text version %q not found", c.Query("version"))})
+		return
+	}
+
+	rows, excluded, err := quizItemAnalysis(db, studyTexts, includeExcluded(c))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to analyze quiz items: " + err.Error()})
+		return
+	}
+	c.Header("X-Excluded-Sessions", strconv.Itoa(excluded))
+
+	if c.Query("format") == "csv" {
+		records := make([][]string, len(rows))
+		for i, r := range rows {
+			records[i] = r.csvRecord()
+		}
+		writeCSV(c, "quiz-items.csv", quizItemCSVHeader, records)
+		return
+	}
+
+	if rows == nil {
+		rows = []quizItemRow{}
+	}
+	c.JSON(200, gin.H{
+		"success":   true,
+		"data":      rows,
+		"excluded":  excluded,
+		"font_note": quizByFontNote,
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"gorm.io/gorm"
+)
+
+// quizStudyTextID returns the study text a session's quiz is scored
+// against: the one it was started with, otherwise the active study text
+func quizStudyTextID(tx *gorm.DB, session StudySession) (uint, error) {
+	if session.StudyTextID != 0 {
+		return session.StudyTextID, nil
+	}
+	var studyText StudyText
+	if err := tx.Where("active = ?", true).First(&studyText).Error; err != nil {
+		return 0, err
+	}
+	return studyText.ID, nil
+}
+
+// scoreSessionQuiz marks each of a session's quiz responses correct or not
+// against the answer keys and stores the score summary on the session. Only
+// the latest answer to each question counts towards the score. Sessions
+// without a study text are pinned to the one they were scored against.
+func scoreSessionQuiz(tx *gorm.DB, session StudySession) error {
+	studyTextID, err := quizStudyTextID(tx, session)
+	if err != nil {
+		return err
+	}
+
+	var questions []QuizQuestion
+	if err := tx.Where("study_text_id = ?", studyTextID).Find(&questions).Error; err != nil {
+		return err
+	}
+	answers := make(map[string]int, len(questions))
+	for _, q := range questions {
+		answers[q.QuestionID] = q.Answer
+	}
+
+	var responses []QuizResponse
+	if err := tx.Where("session_id = ?", session.ID).Order("timestamp ASC, id ASC").Find(&responses).Error; err != nil {
+		return err
+	}
+
+	latest := make(map[string]*bool)
+	for _, r := range responses {
+		var isCorrect *bool
+		if answer, ok := answers[r.QuestionID]; ok {
+			correct := r.AnswerIndex == answer
+			isCorrect = &correct
+		}
+		latest[r.QuestionID] = isCorrect
+
+		if !sameOptionalBool(r.IsCorrect, isCorrect) {
+			if err := tx.Model(&QuizResponse{}).Where("id = ?", r.ID).Update("is_correct", isCorrect).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	correct, answered := 0, 0
+	for _, isCorrect := range latest {
+		if isCorrect == nil {
+			continue // Question is not part of the study text
+		}
+		answered++
+		if *isCorrect {
+			correct++
+		}
+	}
+
+	var score *float64
+	if answered > 0 && len(questions) > 0 {
+		s := float64(correct) / float64(len(questions))
+		score = &s
+	}
+
+	return tx.Model(&StudySession{}).Where("id = ?", session.ID).Updates(map[string]interface{}{
+		"study_text_id": studyTextID,
+		"quiz_correct":  correct,
+		"quiz_answered": answered,
+		"quiz_total":    len(questions),
+		"quiz_score":    score,
+	}).Error
+}
+
+// rescoreStudyTextQuizzes rescores every session of a study text after its
+// answer keys have changed, including unscored sessions without a study text
+// if it is the active one
+func rescoreStudyTextQuizzes(db *gorm.DB, studyTextID uint) error {
+	var studyText StudyText
+	if err := db.First(&studyText, studyTextID).Error; err != nil {
+		return err
+	}
+
+	query := db.Where("study_text_id = ?", studyTextID)
+	if studyText.Active {
+		query = query.Or("study_text_id = 0 AND id IN (?)", db.Model(&QuizResponse{}).Select("session_id"))
+	}
+	var sessions []StudySession
+	if err := query.Find(&sessions).Error; err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return scoreSessionQuiz(tx, session)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameOptionalBool(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"readability-backend/analysis"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// readingMeasureRow holds the reading measures for one word of one panel
+// of a passage in a session. First-pass measures are nil for skipped words.
+type readingMeasureRow struct {
+	SessionID       uint   `json:"session_id"`
+	ParticipantID   uint   `json:"participant_id"`
+	PassageID       uint   `json:"passage_id"`
+	Panel           string `json:"panel"`
+	Font            string `json:"font"`
+	WordIndex       int    `json:"word_index"`
+	Line            int    `json:"line"`
+	Word            string `json:"word"`
+	FixationCount   int    `json:"fixation_count"`
+	FirstFixationMS *int   `json:"first_fixation_ms"`
+	GazeDurationMS  *int   `json:"gaze_duration_ms"`
+	GoPastMS        *int   `json:"go_past_ms"`
+	TotalReadingMS  int    `json:"total_reading_ms"`
+	Skipped         bool   `json:"skipped"`
+	RegressionIn    bool   `json:"regression_in"`
+	RegressionOut   bool   `json:"regression_out"`
+}
+
+var readingMeasureCSVHeader = []string{
+	"session_id", "participant_id", "passage_id", "panel", "font", "word_index", "line", "word",
+	"fixation_count", "first_fixation_ms", "gaze_duration_ms", "go_past_ms", "total_reading_ms",
+	"skipped", "regression_in", "regression_out",
+}
+
+func (r readingMeasureRow) csvRecord() []string {
+	return []string{
+		formatUint(r.SessionID),
+		formatUint(r.ParticipantID),
+		formatUint(r.PassageID),
+		r.Panel,
+		r.Font,
+		strconv.Itoa(r.WordIndex),
+		strconv.Itoa(r.Line),
+		r.Word,
+		strconv.Itoa(r.FixationCount),
+		formatOptionalInt(r.FirstFixationMS),
+		formatOptionalInt(r.GazeDurationMS),
+		formatOptionalInt(r.GoPastMS),
+		strconv.Itoa(r.TotalReadingMS),
+		strconv.FormatBool(r.Skipped),
+		strconv.FormatBool(r.RegressionIn),
+		strconv.FormatBool(r.RegressionOut),
+	}
+}
+
+// panelFont returns the font shown on a panel ("left"/"A" or "right"/"B")
+// for a passage: the session's counterbalanced assignment if it has one,
+// otherwise the passage's fonts, falling back to the session's fonts
+func panelFont(session StudySession, passage Passage, panel string) string {
+	for _, a := range session.passageAssignments() {
+		if a.PassageID == passage.ID {
+			passage.FontLeft, passage.FontRight = a.FontLeft, a.FontRight
+		}
+	}
+
+	switch panel {
+	case "left", "A":
+		if passage.FontLeft != "" {
+			return passage.FontLeft
+		}
+		return session.FontLeft
+	case "right", "B":
+		if passage.FontRight != "" {
+			return passage.FontRight
+		}
+		return session.FontRight
+	}
+	return ""
+}
+
+// sessionReadingMeasures computes word-level reading measures for every
+// passage panel with a word layout in the session
+func sessionReadingMeasures(db *gorm.DB, session StudySession) ([]readingMeasureRow, error) {
+	var words []AOI
+	if err := db.Where("session_id = ? AND kind = ?", session.ID, AOIKindWord).Order("passage_id ASC, panel ASC, \"index\" ASC").Find(&words).Error; err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	if err := ensureFixations(db, session.ID); err != nil {
+		return nil, err
+	}
+
+	var fixations []Fixation
+	if err := db.Where("session_id = ? AND aoi_id IS NOT NULL", session.ID).Order("\"index\" ASC").Find(&fixations).Error; err != nil {
+		return nil, err
+	}
+
+	// Group word AOIs and their fixations by passage panel
+	type panelKey struct {
+		passageID uint
+		panel     string
+	}
+	var keys []panelKey
+	wordsByPanel := make(map[panelKey][]AOI)
+	wordByID := make(map[uint]AOI, len(words))
+	passageIDs := make(map[uint]bool)
+	for _, w := range words {
+		key := panelKey{w.PassageID, w.Panel}
+		if _, ok := wordsByPanel[key]; !ok {
+			keys = append(keys, key)
+		}
+		wordsByPanel[key] = append(wordsByPanel[key], w)
+		wordByID[w.ID] = w
+		passageIDs[w.PassageID] = true
+	}
+
+	fixationsByPanel := make(map[panelKey][]analysis.WordFixation)
+	for _, f := range fixations {
+		w, ok := wordByID[*f.AOIID]
+		if !ok {
+			continue // Fixation is on a line or panel, not a word
+		}
+		key := panelKey{w.PassageID, w.Panel}
+		fixationsByPanel[key] = append(fixationsByPanel[key], analysis.WordFixation{
+			Word:     w.Index,
+			Duration: msDuration(f.DurationMS),
+		})
+	}
+
+	ids := make([]uint, 0, len(passageIDs))
+	for id := range passageIDs {
+		ids = append(ids, id)
+	}
+	var passages []Passage
+	if err := db.Where("id IN ?", ids).Find(&passages).Error; err != nil {
+		return nil, err
+	}
+	passageByID := make(map[uint]Passage, len(passages))
+	for _, p := range passages {
+		passageByID[p.ID] = p
+	}
+
+	var rows []readingMeasureRow
+	for _, key := range keys {
+		panelWords := wordsByPanel[key]
+		wordCount := 0
+		for _, w := range panelWords {
+			if w.Index+1 > wordCount {
+				wordCount = w.Index + 1
+			}
+		}
+
+		measures := analysis.ReadingMeasures(wordCount, fixationsByPanel[key])
+		font := panelFont(session, passageByID[key.passageID], key.panel)
+		for _, w := range panelWords {
+			if w.Index < 0 {
+				continue
+			}
+			m := measures[w.Index]
+			row := readingMeasureRow{
+				SessionID:      session.ID,
+				ParticipantID:  session.ParticipantID,
+				PassageID:      key.passageID,
+				Panel:          key.panel,
+				Font:           font,
+				WordIndex:      w.Index,
+				Line:           w.Line,
+				Word:           w.Text,
+				FixationCount:  m.FixationCount,
+				TotalReadingMS: int(m.TotalReadingTime.Milliseconds()),
+				Skipped:        m.Skipped,
+				RegressionIn:   m.RegressionIn,
+				RegressionOut:  m.RegressionOut,
+			}
+			if m.FirstPass {
+				row.FirstFixationMS = intPtr(int(m.FirstFixationDuration.Milliseconds()))
+				row.GazeDurationMS = intPtr(int(m.GazeDuration.Milliseconds()))
+				row.GoPastMS = intPtr(int(m.GoPastTime.Milliseconds()))
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// writeReadingMeasures responds with rows as JSON, or as CSV if format=csv
+func writeReadingMeasures(c *gin.Context, filename string, rows []readingMeasureRow) {
+	if c.Query("format") == "csv" {
+		records := make([][]string, len(rows))
+		for i, r := range rows {
+			records[i] = r.csvRecord()
+		}
+		writeCSV(c, filename, readingMeasureCSVHeader, records)
+		return
+	}
+
+	if rows == nil {
+		rows = []readingMeasureRow{}
+	}
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    rows,
+	})
+}
+
+func handleAdminSessionReadingMeasures(c *gin.Context) {
+	db := dbFrom(c)
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid session id"})
+		return
+	}
+
+	var session StudySession
+	if err := db.First(&session, sessionID).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return
+	}
+
+	rows, err := sessionReadingMeasures(db, session)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to compute reading measures: " + err.Error()})
+		return
+	}
+
+	writeReadingMeasures(c, fmt.Sprintf("reading-measures-session-%d.csv", session.ID), rows)
+}
+
+// handleAdminReadingMeasures returns word-level measures for all sessions
+// that have a word layout, leaving out excluded sessions unless
+// include_excluded is set
+func handleAdminReadingMeasures(c *gin.Context) {
+	db := dbFrom(c)
+	var sessionIDs []uint
+	if err := db.Model(&AOI{}).Where("kind = ?", AOIKindWord).Distinct().Order("session_id ASC").Pluck("session_id", &sessionIDs).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch sessions: " + err.Error()})
+		return
+	}
+
+	var sessions []StudySession
+	if len(sessionIDs) > 0 {
+		if err := db.Where("id IN ?", sessionIDs).Order("id ASC").Find(&sessions).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to fetch sessions: " + err.Error()})
+			return
+		}
+	}
+
+	sessions, excluded, err := excludeSessions(db, sessions, includeExcluded(c))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to evaluate exclusion rules: " + err.Error()})
+		return
+	}
+	c.Header("X-Excluded-Sessions", strconv.Itoa(excluded))
+
+	var rows []readingMeasureRow
+	for _, session := range sessions {
+		sessionRows, err := sessionReadingMeasures(db, session)
+		if err != nil {
+			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to compute reading measures for session %d: %v", session.ID, err)})
+			return
+		}
+		rows = append(rows, sessionRows...)
+	}
+
+	writeReadingMeasures(c, "reading-measures.csv", rows)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scanpathRequest holds the query parameters of the scanpath endpoint
+type scanpathRequest struct {
+	Panel     string `form:"panel"`
+	Phase     string `form:"phase"`
+	PassageID *uint  `form:"passage_id"`
+	AOIs      bool   `form:"aois"` // Draw the word AOIs under the scanpath
+	Width     int    `form:"width"`
+	Height    int    `form:"height"`
+}
+
+// scanpathPanelColors gives the fixations on each panel their own colour so
+// the serif and sans panels can be told apart
+var scanpathPanelColors = map[string]string{
+	"A":     "#1f77b4",
+	"left":  "#1f77b4",
+	"B":     "#d62728",
+	"right": "#d62728",
+}
+
+const scanpathDefaultColor = "#555555"
+
+// fixationRadius sizes a fixation's circle by its duration, so the area
+// grows linearly with duration
+func fixationRadius(durationMS int) float64 {
+	r := 3 + math.Sqrt(float64(durationMS))*0.8
+	return math.Min(r, 40)
+}
+
+// renderScanpath draws fixations as numbered circles connected by saccade
+// lines, over the word AOIs if any are given
+func renderScanpath(width, height int, fixations []Fixation, saccades []Saccade, words []AOI) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif">`+"\n", width, height, width, height)
+	b.WriteString(`<rect width="100%" height="100%" fill="#ffffff"/>` + "\n")
+
+	if len(words) > 0 {
+		b.WriteString(`<g class="aois" fill="#f2f2f2" stroke="#cccccc" stroke-width="0.5">` + "\n")
+		for _, w := range words {
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f"/>`+"\n", w.X, w.Y, w.Width, w.Height)
+		}
+		b.WriteString("</g>\n")
+		b.WriteString(`<g class="words" fill="#999999" text-anchor="middle" dominant-baseline="central">` + "\n")
+		for _, w := range words {
+			if w.Text == "" {
+				continue
+			}
+			size := math.Max(6, math.Min(w.Height*0.6, 24))
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" font-size="%.1f">%s</text>`+"\n", w.X+w.Width/2, w.Y+w.Height/2, size, html.EscapeString(w.Text))
+		}
+		b.WriteString("</g>\n")
+	}
+
+	// Saccades are drawn only between fixations that are both shown
+	position := make(map[int]Fixation, len(fixations))
+	for _, f := range fixations {
+		position[f.Index] = f
+	}
+	b.WriteString(`<g class="saccades" stroke="#333333" stroke-width="1.5" stroke-opacity="0.6">` + "\n")
+	for _, s := range saccades {
+		from, ok1 := position[s.FromFixationIndex]
+		to, ok2 := position[s.ToFixationIndex]
+		if !ok1 || !ok2 {
+			continue
+		}
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`+"\n", from.X, from.Y, to.X, to.Y)
+	}
+	b.WriteString("</g>\n")
+
+	b.WriteString(`<g class="fixations" fill-opacity="0.45" stroke-width="1">` + "\n")
+	for i, f := range fixations {
+		color, ok := scanpathPanelColors[f.Panel]
+		if !ok {
+			color = scanpathDefaultColor
+		}
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s" stroke="%s"><title>%d: %d ms, panel %s</title></circle>`+"\n",
+			f.X, f.Y, fixationRadius(f.DurationMS), color, color, i+1, f.DurationMS, html.EscapeString(f.Panel))
+	}
+	b.WriteString("</g>\n")
+
+	b.WriteString(`<g class="labels" font-size="11" fill="#000000" text-anchor="middle" dominant-baseline="central">` + "\n")
+	for i, f := range fixations {
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f">%d</text>`+"\n", f.X, f.Y, i+1)
+	}
+	b.WriteString("</g>\n")
+
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// handleAdminScanpath renders a session's scanpath as SVG, optionally only
+// for one panel, phase or passage. Fixations are detected with the default
+// thresholds if none have been computed yet.
+func handleAdminScanpath(c *gin.Context) {
+	db := dbFrom(c)
+	var session StudySession
+	if !findSession(c, &session) {
+		return
+	}
+
+	var req scanpathRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid parameters: " + err.Error()})
+		return
+	}
+	if req.Width < 0 || req.Height < 0 || req.Width > maxHeatmapSize || req.Height > maxHeatmapSize {
+		c.JSON(400, gin.H{"error": fmt.Sprintf("width and height must be at most %d pixels", maxHeatmapSize)})
+		return
+	}
+
+	if err := ensureFixations(db, session.ID); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to detect fixations: " + err.Error()})
+		return
+	}
+
+	query := db.Where("session_id = ?", session.ID).Order("\"index\" ASC")
+	if req.Panel != "" {
+		query = query.Where("panel = ?", req.Panel)
+	}
+	if req.Phase != "" {
+		query = query.Where("phase = ?", req.Phase)
+	}
+	if req.PassageID != nil {
+		query = query.Where("passage_id = ?", *req.PassageID)
+	}
+	var fixations []Fixation
+	if err := query.Find(&fixations).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch fixations: " + err.Error()})
+		return
+	}
+
+	var saccades []Saccade
+	if err := db.Where("session_id = ?", session.ID).Order("\"index\" ASC").Find(&saccades).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch saccades: " + err.Error()})
+		return
+	}
+
+	var words []AOI
+	if req.AOIs {
+		aoiQuery := db.Where("session_id = ? AND kind = ?", session.ID, AOIKindWord)
+		if req.Panel != "" {
+			aoiQuery = aoiQuery.Where("panel = ?", req.Panel)
+		}
+		if req.PassageID != nil {
+			aoiQuery = aoiQuery.Where("passage_id = ?", *req.PassageID)
+		}
+		if err := aoiQuery.Order("passage_id ASC, panel ASC, \"index\" ASC").Find(&words).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to fetch AOIs: " + err.Error()})
+			return
+		}
+	}
+
+	width, height := screenSize(req.Width, req.Height, []StudySession{session})
+	c.Header("X-Fixations", fmt.Sprint(len(fixations)))
+	c.Data(200, "image/svg+xml; charset=utf-8", []byte(renderScanpath(width, height, fixations, saccades, words)))
+}
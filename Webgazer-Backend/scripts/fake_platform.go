@@ -0,0 +1,258 @@
+//go:build ignore
+// +build ignore
+
+// fake_platform stands in for Prolific and MTurk to test the recruitment
+// integration end to end against a local backend. It serves the platforms'
+// completion endpoints and walks a participant from each platform through
+// the study, checking deduplication and completion codes.
+//
+// Start the backend pointed at the fake platform:
+//
+//	PROLIFIC_COMPLETION_URL=http://localhost:8090/submissions/complete \
+//	MTURK_SUBMIT_ORIGINS=http://localhost:8090 go run .
+//
+// Then run:
+//
+//	ADMIN_TOKEN=rbt_... go run scripts/fake_platform.go
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+var (
+	backendURL  = flag.String("backend", "http://localhost:8080", "backend base URL")
+	platformURL = flag.String("platform", "http://localhost:8090", "URL the fake platform listens on")
+	frontendURL = flag.String("frontend", "http://localhost:5173/", "study URL participants are sent to")
+)
+
+// submissions records the completion codes the fake platform received, by
+// participant session (SESSION_ID or assignmentId)
+var submissions = struct {
+	sync.Mutex
+	codes map[string]string
+}{codes: make(map[string]string)}
+
+var failures int
+
+func check(ok bool, format string, args ...interface{}) {
+	if ok {
+		fmt.Printf("✅ "+format+"\n", args...)
+		return
+	}
+	failures++
+	fmt.Printf("❌ "+format+"\n", args...)
+}
+
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// call sends a JSON request to the backend and decodes the JSON response
+func call(method, path string, body interface{}) (int, map[string]interface{}) {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, *backendURL+path, reader)
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(1)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+// serve emulates the platforms' completion endpoints
+func serve(listener net.Listener) {
+	mux := http.NewServeMux()
+	// Prolific identifies the submission by the participant's session
+	// cookie; the fake uses the last Prolific session started
+	mux.HandleFunc("/submissions/complete", func(w http.ResponseWriter, r *http.Request) {
+		submissions.Lock()
+		submissions.codes["prolific"] = r.URL.Query().Get("cc")
+		submissions.Unlock()
+		fmt.Fprintln(w, "Submission complete")
+	})
+	mux.HandleFunc("/mturk/externalSubmit", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		submissions.Lock()
+		submissions.codes[r.Form.Get("assignmentId")] = r.Form.Get("completion_code")
+		submissions.Unlock()
+		fmt.Fprintln(w, "HIT submitted")
+	})
+	http.Serve(listener, mux)
+}
+
+// giveConsent agrees to everything on the study's consent form, if it has one
+func giveConsent(name string, participantID float64) {
+	status, result := call("GET", "/api/consent-form", nil)
+	if status != 200 {
+		return
+	}
+	form, _ := result["data"].(map[string]interface{})
+	items, _ := form["items"].([]interface{})
+	choices := make(map[string]bool, len(items))
+	for _, i := range items {
+		item, _ := i.(map[string]interface{})
+		if id, ok := item["id"].(string); ok {
+			choices[id] = true
+		}
+	}
+	status, result = call("POST", "/api/consent", map[string]interface{}{
+		"participant_id":  participantID,
+		"consent_form_id": form["id"],
+		"agree":           true,
+		"choices":         choices,
+	})
+	check(status == 201 && result["consented"] == true, "%s: consent recorded (%d)", name, status)
+}
+
+// runStudy walks a participant arriving with the given entry query through
+// the study and follows the completion redirect. It returns the completion
+// code the backend issued.
+func runStudy(name string, query url.Values) (participantID float64, code string) {
+	entryURL := *frontendURL + "?" + query.Encode()
+
+	status, result := call("POST", "/api/participant", map[string]interface{}{"entry_url": entryURL})
+	check(status == 201, "%s: participant created (%d)", name, status)
+	participantID, _ = result["id"].(float64)
+	firstToken, _ := result["withdrawal_token"].(string)
+
+	status, result = call("POST", "/api/participant", map[string]interface{}{"entry_url": entryURL})
+	id, _ := result["id"].(float64)
+	check(status == 200 && id == participantID && result["returning"] == true,
+		"%s: returning participant deduplicated (%d, id %.0f)", name, status, id)
+	token, _ := result["withdrawal_token"].(string)
+	check(token != "" && token != firstToken, "%s: returning participant gets a new withdrawal token", name)
+
+	giveConsent(name, participantID)
+	status, result = call("POST", "/api/session/start", map[string]interface{}{"participant_id": participantID})
+	check(status == 201, "%s: session started (%d)", name, status)
+	sessionUID, _ := result["session_id"].(string)
+
+	path := "/api/session/" + sessionUID
+	for _, s := range []string{"calibrating", "validating", "reading", "quiz", "completed"} {
+		status, result = call("PATCH", path, map[string]interface{}{"status": s})
+		if status != 200 {
+			check(false, "%s: session moved to %s (%d: %v)", name, s, status, result["error"])
+			return participantID, ""
+		}
+	}
+
+	completion, _ := result["completion"].(map[string]interface{})
+	code, _ = completion["code"].(string)
+	redirectURL, _ := completion["redirect_url"].(string)
+	check(code != "" && redirectURL != "", "%s: completion code %q issued", name, code)
+	if redirectURL != "" {
+		resp, err := http.Get(redirectURL)
+		check(err == nil && resp.StatusCode == 200, "%s: completion redirect followed to %s", name, redirectURL)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	status, _ = call("POST", "/api/session/start", map[string]interface{}{"participant_id": participantID})
+	check(status == 409, "%s: repeat session refused (%d)", name, status)
+	status, _ = call("POST", "/api/session", map[string]interface{}{"participant_id": participantID})
+	check(status == 409, "%s: repeat legacy session refused (%d)", name, status)
+	return participantID, code
+}
+
+func main() {
+	flag.Parse()
+
+	u, err := url.Parse(*platformURL)
+	if err != nil {
+		fmt.Printf("❌ Invalid platform URL: %v\n", err)
+		os.Exit(1)
+	}
+	listener, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		fmt.Printf("❌ Error: %v\n", err)
+		os.Exit(1)
+	}
+	go serve(listener)
+
+	fmt.Println("🧪 Testing recruitment platform integration")
+	fmt.Println("===========================================")
+
+	// Prolific
+	prolificSession := randomID()
+	_, prolificCode := runStudy("Prolific", url.Values{
+		"PROLIFIC_PID": {randomID()},
+		"STUDY_ID":     {"fake-study"},
+		"SESSION_ID":   {prolificSession},
+	})
+	submissions.Lock()
+	check(prolificCode != "" && submissions.codes["prolific"] == prolificCode, "Prolific: platform received code %q", submissions.codes["prolific"])
+	submissions.Unlock()
+
+	// MTurk previews carry no worker and must not start the study
+	status, _ := call("POST", "/api/participant", map[string]interface{}{
+		"entry_url": *frontendURL + "?assignmentId=ASSIGNMENT_ID_NOT_AVAILABLE&hitId=fake-hit",
+	})
+	check(status == 400, "MTurk: HIT preview refused (%d)", status)
+
+	// MTurk
+	assignmentID := randomID()
+	_, mturkCode := runStudy("MTurk", url.Values{
+		"workerId":     {randomID()},
+		"assignmentId": {assignmentID},
+		"hitId":        {"fake-hit"},
+		"turkSubmitTo": {*platformURL},
+	})
+	submissions.Lock()
+	check(mturkCode != "" && submissions.codes[assignmentID] == mturkCode, "MTurk: platform received code %q", submissions.codes[assignmentID])
+	submissions.Unlock()
+
+	// Completion report
+	if os.Getenv("ADMIN_TOKEN") == "" {
+		fmt.Println("⚠️  Set ADMIN_TOKEN to check the completion report")
+	} else {
+		status, result := call("GET", "/api/admin/platform-report", nil)
+		rows, _ := result["data"].([]interface{})
+		found := 0
+		for _, r := range rows {
+			row, _ := r.(map[string]interface{})
+			if row["platform_session_id"] == prolificSession || row["platform_session_id"] == assignmentID {
+				found++
+				fmt.Printf("   %v %v: %v, code %v → %v\n", row["platform"], row["platform_participant_id"],
+					row["status"], row["completion_code"], row["recommendation"])
+			}
+		}
+		check(status == 200 && found == 2, "Completion report lists both submissions (%d)", status)
+	}
+
+	fmt.Println()
+	if failures > 0 {
+		fmt.Printf("❌ %d check(s) failed\n", failures)
+		os.Exit(1)
+	}
+	fmt.Println("✅ All platform checks passed!")
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"log"
+
+	"gorm.io/gorm"
 )
 
 // seedInitialData populates the database with initial study text and quiz questions
-func seedInitialData() {
+func seedInitialData(db *gorm.DB) {
 	// Check if study text already exists
 	var count int64
 	db.Model(&StudyText{}).Count(&count)
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Session statuses, in the order a participant moves through the study
+const (
+	SessionStatusCreated     = "created"
+	SessionStatusCalibrating = "calibrating"
+	SessionStatusValidating  = "validating"
+	SessionStatusReading     = "reading"
+	SessionStatusQuiz        = "quiz"
+	SessionStatusCompleted   = "completed"
+	SessionStatusAbandoned   = "abandoned"
+)
+
+// sessionTransitions lists the statuses each status may move to. A failed
+// validation sends the participant back to calibration. Completed and
+// abandoned sessions are final.
+var sessionTransitions = map[string][]string{
+	SessionStatusCreated:     {SessionStatusCalibrating, SessionStatusAbandoned},
+	SessionStatusCalibrating: {SessionStatusValidating, SessionStatusAbandoned},
+	SessionStatusValidating:  {SessionStatusReading, SessionStatusCalibrating, SessionStatusAbandoned},
+	SessionStatusReading:     {SessionStatusQuiz, SessionStatusAbandoned},
+	SessionStatusQuiz:        {SessionStatusCompleted, SessionStatusAbandoned},
+	SessionStatusCompleted:   {},
+	SessionStatusAbandoned:   {},
+}
+
+var errSessionModified = errors.New("session was modified concurrently")
+
+// isFinalSessionStatus reports whether a session can no longer change
+func isFinalSessionStatus(status string) bool {
+	return status == SessionStatusCompleted || status == SessionStatusAbandoned
+}
+
+// checkSessionTransition returns an error if a session may not move from
+// one status to another. Staying in the same status is always allowed for
+// sessions that are not final.
+func checkSessionTransition(from, to string) error {
+	if _, ok := sessionTransitions[to]; !ok {
+		return fmt.Errorf("unknown status %q", to)
+	}
+	if isFinalSessionStatus(from) {
+		return fmt.Errorf("session is already %s", from)
+	}
+	if from == to {
+		return nil
+	}
+	for _, allowed := range sessionTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot move session from %s to %s", from, to)
+}
+
+// sessionUpdateRequest is the body of PATCH /api/session/:uid. Only fields
+// present in the request are changed.
+type sessionUpdateRequest struct {
+	Status            *string `json:"status"`
+	CalibrationPoints *int    `json:"calibration_points"`
+	TimeLeftMS        *int    `json:"time_left_ms"`
+	TimeRightMS       *int    `json:"time_right_ms"`
+	TimeAMS           *int    `json:"time_a_ms"`
+	TimeBMS           *int    `json:"time_b_ms"`
+	FontPreference    *string `json:"font_preference"`
+	PreferredFontType *string `json:"preferred_font_type"`
+	QuizResponsesJSON *string `json:"quiz_responses_json"`
+	UserAgent         *string `json:"user_agent"`
+	ScreenWidth       *int    `json:"screen_width"`
+	ScreenHeight      *int    `json:"screen_height"`
+}
+
+// findSession loads a session by the numeric id in the :id route parameter,
+// writing an error response and returning false if that fails
+func findSession(c *gin.Context, session *StudySession) bool {
+	db := dbFrom(c)
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid session id"})
+		return false
+	}
+	if err := db.First(session, id).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return false
+	}
+	return true
+}
+
+// findSessionByUID loads a session by the random session_id in the :uid
+// route parameter, writing an error response and returning false if that
+// fails. The participant-facing session endpoints use it so that sessions
+// cannot be read or changed by guessing sequential numeric IDs.
+func findSessionByUID(c *gin.Context, session *StudySession) bool {
+	db := dbFrom(c)
+	if err := db.Where("session_id = ?", c.Param("uid")).First(session).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Session not found"})
+		return false
+	}
+	return true
+}
+
+// sessionView is a session as shown to the participant. The completion code
+// and platform IDs are left out, as is the quiz score.
+type sessionView struct {
+	ID                uint                `json:"id"`
+	SessionID         string              `json:"session_id"`
+	ParticipantID     uint                `json:"participant_id"`
+	Status            string              `json:"status"`
+	CreatedAt         time.Time           `json:"created_at"`
+	UpdatedAt         time.Time           `json:"updated_at"`
+	CompletedAt       *time.Time          `json:"completed_at,omitempty"`
+	CalibrationPoints int                 `json:"calibration_points"`
+	FontLeft          string              `json:"font_left"`
+	FontRight         string              `json:"font_right"`
+	TimeLeftMS        int                 `json:"time_left_ms"`
+	TimeRightMS       int                 `json:"time_right_ms"`
+	TimeAMS           int                 `json:"time_a_ms"`
+	TimeBMS           int                 `json:"time_b_ms"`
+	FontPreference    string              `json:"font_preference"`
+	PreferredFontType string              `json:"preferred_font_type"`
+	UserAgent         string              `json:"user_agent,omitempty"`
+	ScreenWidth       int                 `json:"screen_width,omitempty"`
+	ScreenHeight      int                 `json:"screen_height,omitempty"`
+	StudyTextID       uint                `json:"study_text_id,omitempty"`
+	ConditionCell     *int                `json:"condition_cell,omitempty"`
+	Passages          []passageAssignment `json:"passages,omitempty"`
+}
+
+func (s StudySession) view() sessionView {
+	return sessionView{
+		ID:                s.ID,
+		SessionID:         s.SessionID,
+		ParticipantID:     s.ParticipantID,
+		Status:            s.Status,
+		CreatedAt:         s.CreatedAt,
+		UpdatedAt:         s.UpdatedAt,
+		CompletedAt:       s.CompletedAt,
+		CalibrationPoints: s.CalibrationPoints,
+		FontLeft:          s.FontLeft,
+		FontRight:         s.FontRight,
+		TimeLeftMS:        s.TimeLeftMS,
+		TimeRightMS:       s.TimeRightMS,
+		TimeAMS:           s.TimeAMS,
+		TimeBMS:           s.TimeBMS,
+		FontPreference:    s.FontPreference,
+		PreferredFontType: s.PreferredFontType,
+		UserAgent:         s.UserAgent,
+		ScreenWidth:       s.ScreenWidth,
+		ScreenHeight:      s.ScreenHeight,
+		StudyTextID:       s.StudyTextID,
+		ConditionCell:     s.ConditionCell,
+		Passages:          s.passageAssignments(),
+	}
+}
+
+func handleGetSession(c *gin.Context) {
+	var session StudySession
+	if !findSessionByUID(c, &session) {
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data":    session.view(),
+	})
+}
+
+// handleSessionUpdate updates a session as the participant completes each
+// phase, enforcing the status order
+func handleSessionUpdate(c *gin.Context) {
+	db := dbFrom(c)
+	var session StudySession
+	if !findSessionByUID(c, &session) {
+		return
+	}
+
+	var update sessionUpdateRequest
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+
+	status := session.Status
+	if update.Status != nil {
+		status = *update.Status
+	}
+	if err := checkSessionTransition(session.Status, status); err != nil {
+		c.JSON(409, gin.H{
+			"error":  err.Error(),
+			"status": session.Status,
+		})
+		return
+	}
+
+	// Abandoning a session is always allowed, e.g. after declining consent
+	if status != SessionStatusAbandoned && !requireConsent(c, session) {
+		return
+	}
+
+	updates := map[string]interface{}{"status": status}
+	if status == SessionStatusCompleted && session.CompletedAt == nil {
+		updates["completed_at"] = time.Now()
+	}
+	if update.CalibrationPoints != nil {
+		updates["calibration_points"] = *update.CalibrationPoints
+	}
+	if update.TimeLeftMS != nil {
+		updates["time_left_ms"] = *update.TimeLeftMS
+	}
+	if update.TimeRightMS != nil {
+		updates["time_right_ms"] = *update.TimeRightMS
+	}
+	if update.TimeAMS != nil {
+		updates["time_ams"] = *update.TimeAMS
+	}
+	if update.TimeBMS != nil {
+		updates["time_bms"] = *update.TimeBMS
+	}
+	if update.FontPreference != nil {
+		updates["font_preference"] = *update.FontPreference
+	}
+	if update.PreferredFontType != nil {
+		updates["preferred_font_type"] = *update.PreferredFontType
+	}
+	if update.QuizResponsesJSON != nil {
+		updates["quiz_responses_json"] = *update.QuizResponsesJSON
+	}
+	if update.UserAgent != nil {
+		updates["user_agent"] = *update.UserAgent
+	}
+	if update.ScreenWidth != nil {
+		updates["screen_width"] = *update.ScreenWidth
+	}
+	if update.ScreenHeight != nil {
+		updates["screen_height"] = *update.ScreenHeight
+	}
+
+	// Participants recruited on a platform get a completion code to submit
+	// there, issued in the transaction that completes the session
+	var completion *platformCompletion
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if status == SessionStatusCompleted {
+			var err error
+			if completion, err = platformCompletionFor(tx, session); err != nil {
+				return fmt.Errorf("issuing completion code: %w", err)
+			}
+			if completion != nil {
+				updates["completion_code"] = completion.Code
+			}
+		}
+
+		// Guard against a concurrent update having moved the session on
+		result := tx.Model(&StudySession{}).Where("id = ? AND status = ?", session.ID, session.Status).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errSessionModified
+		}
+		return nil
+	})
+	if errors.Is(err, errSessionModified) {
+		c.JSON(409, gin.H{"error": "Session was modified concurrently, please retry"})
+		return
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to update session: " + err.Error()})
+		return
+	}
+
+	if isFinalSessionStatus(status) {
+		closeGazeStream(session.ID)
+	}
+
+	response := gin.H{
+		"success": true,
+		"id":      session.ID,
+		"status":  status,
+	}
+	if completion != nil {
+		response["completion"] = completion
+	}
+	c.JSON(200, response)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckSessionTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		ok       bool
+	}{
+		{SessionStatusCreated, SessionStatusCalibrating, true},
+		{SessionStatusCreated, SessionStatusCreated, true},
+		{SessionStatusCreated, SessionStatusReading, false},
+		{SessionStatusValidating, SessionStatusCalibrating, true},
+		{SessionStatusReading, SessionStatusAbandoned, true},
+		{SessionStatusQuiz, SessionStatusCompleted, true},
+		{SessionStatusCompleted, SessionStatusCompleted, false},
+		{SessionStatusAbandoned, SessionStatusCalibrating, false},
+		{SessionStatusCreated, "finished", false},
+	}
+	for _, tt := range tests {
+		if err := checkSessionTransition(tt.from, tt.to); (err == nil) != tt.ok {
+			t.Errorf("checkSessionTransition(%s, %s) = %v, want ok %v", tt.from, tt.to, err, tt.ok)
+		}
+	}
+}
+
+// completeSession moves a session through every status to completion and
+// returns the final response
+func (s *testServer) completeSession(sessionID string) map[string]interface{} {
+	s.t.Helper()
+	statuses := []string{SessionStatusCalibrating, SessionStatusValidating, SessionStatusReading, SessionStatusQuiz}
+	for _, status := range statuses {
+		s.expect(200, "PATCH", "/api/session/"+sessionID, "", gin.H{"status": status})
+	}
+	return s.expect(200, "PATCH", "/api/session/"+sessionID, "", gin.H{"status": SessionStatusCompleted})
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	studyText := s.studyText("lifecycle")
+	participantID, _ := s.participant("")
+	sessionID := s.startSession(participantID, studyText.ID)
+
+	// Statuses cannot be skipped
+	response := s.expect(409, "PATCH", "/api/session/"+sessionID, "", gin.H{"status": SessionStatusReading})
+	if response["status"] != SessionStatusCreated {
+		t.Errorf("status after refused update = %v, want %s", response["status"], SessionStatusCreated)
+	}
+
+	response = s.completeSession(sessionID)
+	if _, ok := response["completion"]; ok {
+		t.Errorf("completion for a participant not recruited on a platform: %v", response["completion"])
+	}
+	var session StudySession
+	s.db.Where("session_id = ?", sessionID).First(&session)
+	if session.Status != SessionStatusCompleted || session.CompletedAt == nil {
+		t.Errorf("session status %s, completed at %v; want completed with a time", session.Status, session.CompletedAt)
+	}
+
+	// Completed sessions are final
+	s.expect(409, "PATCH", "/api/session/"+sessionID, "", gin.H{"status": SessionStatusAbandoned})
+	s.expect(404, "PATCH", "/api/session/not-a-session", "", gin.H{"status": SessionStatusCalibrating})
+}
+
+func TestSessionCompletionCode(t *testing.T) {
+	s := newTestServer(t)
+	studyText := s.studyText("platform")
+
+	// Every participant of a study gets the study's one completion code
+	var codes []string
+	for _, pid := range []string{"first", "second"} {
+		participantID, _ := s.participant("https://study.example/?PROLIFIC_PID=" + pid + "&STUDY_ID=study&SESSION_ID=" + pid + "-session")
+		response := s.completeSession(s.startSession(participantID, studyText.ID))
+		completion, ok := response["completion"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("no completion in %v", response)
+		}
+		if completion["platform"] != PlatformProlific {
+			t.Errorf("completion platform = %v, want %s", completion["platform"], PlatformProlific)
+		}
+		codes = append(codes, completion["code"].(string))
+
+		// Platform participants complete each study only once
+		s.expect(409, "POST", "/api/session/start", "", gin.H{"participant_id": participantID, "study_text_id": studyText.ID})
+		s.expect(409, "POST", "/api/session", "", gin.H{"participant_id": participantID, "study_text_id": studyText.ID})
+	}
+
+	s.db.First(&studyText, studyText.ID)
+	if codes[0] == "" || codes[0] != codes[1] || codes[0] != studyText.CompletionCode {
+		t.Errorf("completion codes %q, study text code %q; want one stored code", codes, studyText.CompletionCode)
+	}
+}
+
+func TestLegacySessionCreate(t *testing.T) {
+	s := newTestServer(t)
+	studyText := s.studyText("legacy")
+	participantID, _ := s.participant("")
+
+	// Sessions cannot be created completed, or with server-set fields
+	s.expect(400, "POST", "/api/session", "", gin.H{
+		"participant_id": participantID,
+		"study_text_id":  studyText.ID,
+		"status":         SessionStatusCompleted,
+	})
+	response := s.expect(201, "POST", "/api/session", "", gin.H{
+		"participant_id":  participantID,
+		"study_text_id":   studyText.ID,
+		"completion_code": "CHOSEN",
+		"quiz_correct":    5,
+	})
+
+	var session StudySession
+	s.db.First(&session, uint(response["id"].(float64)))
+	if session.Status != SessionStatusCreated || session.CompletionCode != "" || session.QuizCorrect != 0 {
+		t.Errorf("session status %q, completion code %q, quiz correct %d; want created, none and 0",
+			session.Status, session.CompletionCode, session.QuizCorrect)
+	}
+}
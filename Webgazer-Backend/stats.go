@@ -0,0 +1,407 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"readability-backend/analysis"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Statistics are reported at this confidence level, and bootstrap
+// intervals are seeded so repeated requests give the same numbers
+const (
+	statsConfidenceLevel    = 0.95
+	defaultBootstrapSamples = 10000
+	maxBootstrapSamples     = 100000
+	defaultBootstrapSeed    = 1
+)
+
+// finiteFloat returns v, or nil if it is not a finite number (which JSON
+// cannot represent)
+func finiteFloat(v float64) *float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return nil
+	}
+	return &v
+}
+
+// confidenceInterval is a [low, high] interval in JSON
+type confidenceInterval [2]*float64
+
+func newConfidenceInterval(low, high float64) confidenceInterval {
+	return confidenceInterval{finiteFloat(low), finiteFloat(high)}
+}
+
+// fontReadingTimes are a session's reading times (ms) in serif and in sans
+type fontReadingTimes struct {
+	SerifMS, SansMS int
+	FromGaze        bool // Gaze dwell on each passage, rather than the times the frontend reported
+}
+
+// passagePanel is a panel of a passage as labelled on gaze points
+type passagePanel struct {
+	passageID uint
+	panel     string
+}
+
+// gazeDwell returns the time spent looking at each passage panel: the
+// intervals between successive gaze samples on the same panel, leaving out
+// gaps longer than qualityMaxGap (track loss)
+func gazeDwell(points []GazePoint) map[passagePanel]time.Duration {
+	dwell := make(map[passagePanel]time.Duration)
+	for i := 1; i < len(points); i++ {
+		prev, p := points[i-1], points[i]
+		if prev.PassageID == nil || p.PassageID == nil || *prev.PassageID != *p.PassageID || prev.Panel != p.Panel {
+			continue
+		}
+		if gap := p.Timestamp.Sub(prev.Timestamp); gap <= qualityMaxGap {
+			dwell[passagePanel{*p.PassageID, p.Panel}] += gap
+		}
+	}
+	return dwell
+}
+
+// sessionFontReadingTimes returns a session's reading times in serif and in
+// sans. Times are paired within passages: on every passage the time spent on
+// the serif panel is set against the time spent on the sans panel, from gaze
+// dwell, and the session's times are the sums over the passages where both
+// panels were read. Sessions without gaze on passages fall back to the
+// reading times the frontend reported (box A is the left panel and box B the
+// right), but only with at most one passage, as those are not per passage.
+func sessionFontReadingTimes(db *gorm.DB, s StudySession, passages map[uint]Passage) (fontReadingTimes, bool, error) {
+	var points []GazePoint
+	err := db.Select("passage_id", "panel", "timestamp").
+		Where("session_id = ? AND passage_id IS NOT NULL", s.ID).
+		Order("timestamp ASC, id ASC").Find(&points).Error
+	if err != nil {
+		return fontReadingTimes{}, false, err
+	}
+
+	if len(points) > 0 {
+		type fontTimes struct{ serif, sans time.Duration }
+		byPassage := make(map[uint]*fontTimes)
+		for key, d := range gazeDwell(points) {
+			passage, ok := passages[key.passageID]
+			if !ok {
+				continue
+			}
+			t := byPassage[key.passageID]
+			if t == nil {
+				t = &fontTimes{}
+				byPassage[key.passageID] = t
+			}
+			switch panelFont(s, passage, key.panel) {
+			case "serif":
+				t.serif += d
+			case "sans":
+				t.sans += d
+			}
+		}
+		var r fontReadingTimes
+		for _, t := range byPassage {
+			if t.serif > 0 && t.sans > 0 {
+				r.SerifMS += int(t.serif.Milliseconds())
+				r.SansMS += int(t.sans.Milliseconds())
+			}
+		}
+		r.FromGaze = true
+		return r, r.SerifMS > 0 && r.SansMS > 0, nil
+	}
+
+	fontA, fontB := s.FontLeft, s.FontRight
+	switch assignments := s.passageAssignments(); len(assignments) {
+	case 0:
+	case 1:
+		fontA, fontB = assignments[0].FontLeft, assignments[0].FontRight
+	default:
+		return fontReadingTimes{}, false, nil
+	}
+	timeA, timeB := s.TimeAMS, s.TimeBMS
+	if timeA <= 0 && timeB <= 0 {
+		timeA, timeB = s.TimeLeftMS, s.TimeRightMS
+	}
+	if timeA <= 0 || timeB <= 0 {
+		return fontReadingTimes{}, false, nil
+	}
+
+	switch {
+	case fontA == "serif" && fontB == "sans":
+		return fontReadingTimes{SerifMS: timeA, SansMS: timeB}, true, nil
+	case fontA == "sans" && fontB == "serif":
+		return fontReadingTimes{SerifMS: timeB, SansMS: timeA}, true, nil
+	}
+	return fontReadingTimes{}, false, nil
+}
+
+// sessionsFontReadingTimes returns the reading times of the sessions that
+// have them
+func sessionsFontReadingTimes(db *gorm.DB, sessions []StudySession) ([]fontReadingTimes, error) {
+	var passageList []Passage
+	if err := db.Select("id", "font_left", "font_right").Find(&passageList).Error; err != nil {
+		return nil, err
+	}
+	passages := make(map[uint]Passage, len(passageList))
+	for _, p := range passageList {
+		passages[p.ID] = p
+	}
+
+	var times []fontReadingTimes
+	for _, s := range sessions {
+		t, ok, err := sessionFontReadingTimes(db, s, passages)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			times = append(times, t)
+		}
+	}
+	return times, nil
+}
+
+type tTestResult struct {
+	T          *float64           `json:"t"`
+	DF         float64            `json:"df"`
+	PValue     *float64           `json:"p_value"`
+	MeanDiffMS *float64           `json:"mean_difference_ms"`
+	CI         confidenceInterval `json:"ci"`
+	CohensDz   *float64           `json:"cohens_dz"`
+}
+
+type wilcoxonResult struct {
+	N            int      `json:"n"` // Pairs with a non-zero difference
+	V            float64  `json:"v"` // Sum of ranks of positive (serif slower) differences
+	Z            *float64 `json:"z"`
+	PValue       *float64 `json:"p_value"`
+	Method       string   `json:"method"` // "exact" or "normal"
+	RankBiserial *float64 `json:"rank_biserial"`
+}
+
+type bootstrapResult struct {
+	Resamples    int                `json:"resamples"`
+	Seed         int64              `json:"seed"`
+	MeanDiffMS   confidenceInterval `json:"mean_difference_ms_ci"`
+	MedianDiffMS confidenceInterval `json:"median_difference_ms_ci"`
+	CohensDz     confidenceInterval `json:"cohens_dz_ci"`
+}
+
+// readingTimeComparison compares serif and sans reading times within
+// sessions. Differences are serif minus sans, so positive values mean
+// serif was read more slowly.
+type readingTimeComparison struct {
+	N            int              `json:"n"`
+	FromGaze     int              `json:"from_gaze"`           // Sessions timed by gaze dwell per passage
+	FromReported int              `json:"from_reported_times"` // Single-passage sessions timed by the frontend
+	SerifMeanMS  *float64         `json:"serif_mean_ms"`
+	SansMeanMS   *float64         `json:"sans_mean_ms"`
+	MeanDiffMS   *float64         `json:"mean_difference_ms"`
+	MedianDiffMS *float64         `json:"median_difference_ms"`
+	TTest        *tTestResult     `json:"t_test"`
+	Wilcoxon     *wilcoxonResult  `json:"wilcoxon"`
+	Bootstrap    *bootstrapResult `json:"bootstrap"`
+}
+
+// preferenceTest tests whether serif is preferred more or less often than
+// sans (chance is 0.5)
+type preferenceTest struct {
+	N               int                `json:"n"`
+	Serif           int                `json:"serif"`
+	Sans            int                `json:"sans"`
+	ProportionSerif *float64           `json:"proportion_serif"`
+	CI              confidenceInterval `json:"ci"`
+	PValue          float64            `json:"p_value"`
+}
+
+// quizByFont is the quiz accuracy of the sessions in one font condition
+type quizByFont struct {
+	Font          string             `json:"font"`
+	Sessions      int                `json:"sessions"` // Sessions with at least one scored answer
+	Correct       int                `json:"correct"`
+	Answered      int                `json:"answered"`
+	Accuracy      *float64           `json:"accuracy"` // Correct / answered over all sessions
+	CI            confidenceInterval `json:"ci"`
+	MeanQuizScore *float64           `json:"mean_quiz_score"`
+}
+
+func compareReadingTimes(times []fontReadingTimes, resamples int, seed int64) readingTimeComparison {
+	var r readingTimeComparison
+	var serif, sans, diffs []float64
+	for _, t := range times {
+		serif = append(serif, float64(t.SerifMS))
+		sans = append(sans, float64(t.SansMS))
+		diffs = append(diffs, float64(t.SerifMS-t.SansMS))
+		if t.FromGaze {
+			r.FromGaze++
+		} else {
+			r.FromReported++
+		}
+	}
+
+	r.N = len(diffs)
+	if len(diffs) == 0 {
+		return r
+	}
+	r.SerifMeanMS = finiteFloat(analysis.Mean(serif))
+	r.SansMeanMS = finiteFloat(analysis.Mean(sans))
+	r.MeanDiffMS = finiteFloat(analysis.Mean(diffs))
+	r.MedianDiffMS = finiteFloat(analysis.Median(diffs))
+
+	if t, err := analysis.PairedTTest(diffs, statsConfidenceLevel); err == nil {
+		r.TTest = &tTestResult{
+			T:          finiteFloat(t.T),
+			DF:         t.DF,
+			PValue:     finiteFloat(t.PValue),
+			MeanDiffMS: finiteFloat(t.Mean),
+			CI:         newConfidenceInterval(t.CILow, t.CIHigh),
+			CohensDz:   finiteFloat(t.CohensDz),
+		}
+	}
+
+	if w, err := analysis.WilcoxonSignedRank(diffs); err == nil {
+		method := "normal"
+		if w.Exact {
+			method = "exact"
+		}
+		r.Wilcoxon = &wilcoxonResult{
+			N:            w.N,
+			V:            w.V,
+			Z:            finiteFloat(w.Z),
+			PValue:       finiteFloat(w.PValue),
+			Method:       method,
+			RankBiserial: finiteFloat(w.RankBiserial),
+		}
+	}
+
+	if len(diffs) >= 2 {
+		mean, median, dz := analysis.BootstrapPaired(diffs, resamples, statsConfidenceLevel, seed)
+		r.Bootstrap = &bootstrapResult{
+			Resamples:    resamples,
+			Seed:         seed,
+			MeanDiffMS:   newConfidenceInterval(mean.Low, mean.High),
+			MedianDiffMS: newConfidenceInterval(median.Low, median.High),
+			CohensDz:     newConfidenceInterval(dz.Low, dz.High),
+		}
+	}
+	return r
+}
+
+func testPreference(sessions []StudySession) preferenceTest {
+	var r preferenceTest
+	for _, s := range sessions {
+		switch s.PreferredFontType {
+		case "serif":
+			r.Serif++
+		case "sans":
+			r.Sans++
+		}
+	}
+	r.N = r.Serif + r.Sans
+	r.PValue = analysis.BinomialTest(r.Serif, r.N, 0.5)
+	if r.N > 0 {
+		r.ProportionSerif = finiteFloat(float64(r.Serif) / float64(r.N))
+		r.CI = newConfidenceInterval(analysis.WilsonInterval(r.Serif, r.N, statsConfidenceLevel))
+	}
+	return r
+}
+
+// quizByFontNote is reported with quizAccuracyByFont, whose grouping does
+// not hold for counterbalanced sessions
+const quizByFontNote = "Sessions are grouped by font_left, the font on the left panel when the session started. " +
+	"Counterbalanced sessions show both fonts and the quiz covers all passages, so the groups are not font conditions for them."
+
+// quizAccuracyByFont groups sessions by font condition (the font on the
+// left panel). See quizByFontNote.
+func quizAccuracyByFont(sessions []StudySession) []quizByFont {
+	var results []quizByFont
+	for _, font := range []string{"serif", "sans"} {
+		r := quizByFont{Font: font}
+		var scores []float64
+		for _, s := range sessions {
+			if s.FontLeft != font || s.QuizAnswered == 0 {
+				continue
+			}
+			r.Sessions++
+			r.Correct += s.QuizCorrect
+			r.Answered += s.QuizAnswered
+			if s.QuizScore != nil {
+				scores = append(scores, *s.QuizScore)
+			}
+		}
+		if r.Answered > 0 {
+			r.Accuracy = finiteFloat(float64(r.Correct) / float64(r.Answered))
+			r.CI = newConfidenceInterval(analysis.WilsonInterval(r.Correct, r.Answered, statsConfidenceLevel))
+		}
+		if len(scores) > 0 {
+			r.MeanQuizScore = finiteFloat(analysis.Mean(scores))
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// handleAdminFontComparison compares the serif and sans conditions over
+// the sessions not excluded by their study's rules: reading times within
+// sessions, font preference, and quiz accuracy by font condition
+func handleAdminFontComparison(c *gin.Context) {
+	db := dbFrom(c)
+	resamples := defaultBootstrapSamples
+	if v := c.Query("resamples"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 100 || n > maxBootstrapSamples {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("resamples must be between 100 and %d", maxBootstrapSamples)})
+			return
+		}
+		resamples = n
+	}
+	seed := int64(defaultBootstrapSeed)
+	if v := c.Query("seed"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(400, gin.H{"error": "seed must be an integer"})
+			return
+		}
+		seed = n
+	}
+
+	query := db.Order("id ASC")
+	if version := c.Query("version"); version != "" {
+		var studyText StudyText
+		if err := db.Where("version = ?", version).First(&studyText).Error; err != nil {
+			c.JSON(404, gin.H{"error": fmt.Sprintf("Study text version %q not found", version)})
+			return
+		}
+		query = query.Where("study_text_id = ?", studyText.ID)
+	}
+	var sessions []StudySession
+	if err := query.Find(&sessions).Error; err != nil {
+		c.JSON(500, gin.H{"error": "Failed to fetch sessions: " + err.Error()})
+		return
+	}
+	sessions, excluded, err := excludeSessions(db, sessions, includeExcluded(c))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to evaluate exclusion rules: " + err.Error()})
+		return
+	}
+	times, err := sessionsFontReadingTimes(db, sessions)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to compute reading times: " + err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"success": true,
+		"data": gin.H{
+			"sessions":          len(sessions),
+			"excluded":          excluded,
+			"confidence_level":  statsConfidenceLevel,
+			"reading_time":      compareReadingTimes(times, resamples, seed),
+			"preference":        testPreference(sessions),
+			"quiz_by_font":      quizAccuracyByFont(sessions),
+			"quiz_by_font_note": quizByFontNote,
+		},
+	})
+}
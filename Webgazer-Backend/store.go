@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Database drivers
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// Defaults used when the configuration does not set the database
+const (
+	defaultDriver = DriverSQLite
+	defaultDSN    = "readability.db"
+)
+
+// sqliteBusyTimeoutMS is how long a SQLite write waits for other writers
+// before failing with "database is locked". Waiting writers are not served
+// in order, so with many participants streaming gaze a write can wait
+// several seconds.
+const sqliteBusyTimeoutMS = 30000
+
+// storeContextKey is the gin context key the store is injected under
+const storeContextKey = "store"
+
+// Store is the database the API reads and writes. It is opened once at
+// startup and injected into every request (see useStore).
+type Store interface {
+	DB() *gorm.DB
+	Driver() string
+	Close() error
+}
+
+type gormStore struct {
+	db     *gorm.DB
+	driver string
+}
+
+func (s *gormStore) DB() *gorm.DB   { return s.db }
+func (s *gormStore) Driver() string { return s.driver }
+
+func (s *gormStore) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// sqliteDSN adds the connection settings that let concurrent requests
+// write to SQLite: WAL so reads do not block writes, a busy timeout so
+// writers wait for each other, and immediate transactions so a transaction
+// takes the write lock up front instead of failing to upgrade a read lock.
+// Settings already in the DSN are kept.
+func sqliteDSN(dsn string) string {
+	settings := []string{
+		"_journal_mode=WAL",
+		fmt.Sprintf("_busy_timeout=%d", sqliteBusyTimeoutMS),
+		"_txlock=immediate",
+	}
+	var add []string
+	for _, s := range settings {
+		name := s[:strings.Index(s, "=")+1]
+		if !strings.Contains(dsn, name) {
+			add = append(add, s)
+		}
+	}
+	if len(add) == 0 {
+		return dsn
+	}
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + strings.Join(add, "&")
+}
+
+// openStore connects to the database with the given driver
+func openStore(driver, dsn string) (Store, error) {
+	var dialector gorm.Dialector
+	switch driver {
+	case DriverSQLite:
+		dialector = sqlite.Open(sqliteDSN(dsn))
+	case DriverPostgres:
+		dialector = postgres.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q (must be %s or %s)", driver, DriverSQLite, DriverPostgres)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{
+		// Report constraint violations as gorm errors (e.g. gorm.ErrDuplicatedKey)
+		// whatever the driver
+		TranslateError: true,
+		// SQLite does not enforce foreign keys, and the handlers check that
+		// referenced rows exist, so PostgreSQL does not get them either
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	// Every connection to an in-memory SQLite database opens a new, empty
+	// database, so all queries must share one
+	if driver == DriverSQLite && strings.Contains(dsn, ":memory:") {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return &gormStore{db: db, driver: driver}, nil
+}
+
+// initStore opens the configured database and applies pending migrations
+func initStore(settings databaseSettings) (Store, error) {
+	store, err := openStore(settings.Driver, settings.URL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := migrateUp(store.DB(), 0); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+	return store, nil
+}
+
+// useStore injects the store into every request
+func useStore(store Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(storeContextKey, store)
+		c.Next()
+	}
+}
+
+// dbFrom returns the database of the store injected into the request
+func dbFrom(c *gin.Context) *gorm.DB {
+	return c.MustGet(storeContextKey).(Store).DB()
+}
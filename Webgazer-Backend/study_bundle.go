@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// studyBundleFormat is the version of the bundle format written by export.
+// Import rejects bundles of other versions.
+const studyBundleFormat = 1
+
+// errStudyBundleDryRun rolls back the transaction of a dry-run import
+var errStudyBundleDryRun = errors.New("dry run")
+
+// studyBundle describes a study text with everything needed to run it
+// again: its fonts, passages, quiz questions, consent forms and exclusion
+// rules. It has no database IDs, so it can be kept in git and imported into
+// any database. Passages and quiz questions are listed in display order.
+type studyBundle struct {
+	Format         int                        `json:"format" yaml:"format"`
+	Version        string                     `json:"version" yaml:"version"`
+	Content        string                     `json:"content,omitempty" yaml:"content,omitempty"` // Legacy single passage
+	FontLeft       string                     `json:"font_left" yaml:"font_left"`
+	FontRight      string                     `json:"font_right" yaml:"font_right"`
+	Active         bool                       `json:"active" yaml:"active"`
+	CompletionCode string                     `json:"completion_code,omitempty" yaml:"completion_code,omitempty"`
+	Passages       []studyBundlePassage       `json:"passages" yaml:"passages"`
+	QuizQuestions  []studyBundleQuizQuestion  `json:"quiz_questions" yaml:"quiz_questions"`
+	ConsentForms   []studyBundleConsentForm   `json:"consent_forms" yaml:"consent_forms"`
+	ExclusionRules []studyBundleExclusionRule `json:"exclusion_rules" yaml:"exclusion_rules"`
+}
+
+type studyBundlePassage struct {
+	Title     string `json:"title,omitempty" yaml:"title,omitempty"`
+	Content   string `json:"content" yaml:"content"`
+	FontLeft  string `json:"font_left,omitempty" yaml:"font_left,omitempty"` // The study text's fonts if empty
+	FontRight string `json:"font_right,omitempty" yaml:"font_right,omitempty"`
+}
+
+type studyBundleQuizQuestion struct {
+	QuestionID string   `json:"question_id" yaml:"question_id"`
+	Prompt     string   `json:"prompt" yaml:"prompt"`
+	Choices    []string `json:"choices" yaml:"choices"`
+	Answer     int      `json:"answer" yaml:"answer"` // Index of the correct choice (0-based)
+}
+
+type studyBundleConsentForm struct {
+	Version string        `json:"version" yaml:"version"`
+	Content string        `json:"content" yaml:"content"`
+	Items   []consentItem `json:"items" yaml:"items"`
+	Active  bool          `json:"active" yaml:"active"`
+}
+
+type studyBundleExclusionRule struct {
+	Field       string  `json:"field" yaml:"field"`
+	Operator    string  `json:"operator" yaml:"operator"`
+	Threshold   float64 `json:"threshold" yaml:"threshold"`
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// studyBundleSummary counts what an import created (or would create)
+type studyBundleSummary struct {
+	Version        string `json:"version"`
+	Passages       int    `json:"passages"`
+	QuizQuestions  int    `json:"quiz_questions"`
+	ConsentForms   int    `json:"consent_forms"`
+	ExclusionRules int    `json:"exclusion_rules"`
+}
+
+func validStudyFont(font string) bool {
+	return font == "serif" || font == "sans"
+}
+
+// validate fills in the default fonts and returns every problem with the
+// bundle
+func (b *studyBundle) validate() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if b.Format != studyBundleFormat {
+		add("format must be %d", studyBundleFormat)
+	}
+	if b.Version == "" {
+		add("version is required")
+	}
+	if b.FontLeft == "" {
+		b.FontLeft = "serif"
+	}
+	if b.FontRight == "" {
+		b.FontRight = "sans"
+	}
+	if !validStudyFont(b.FontLeft) || !validStudyFont(b.FontRight) {
+		add("font_left and font_right must be serif or sans")
+	}
+	if len(b.Passages) == 0 && b.Content == "" {
+		add("passages (or the legacy content) are required")
+	}
+
+	for i := range b.Passages {
+		p := &b.Passages[i]
+		if p.Content == "" {
+			add("passages[%d]: content is required", i)
+		}
+		if p.FontLeft == "" {
+			p.FontLeft = b.FontLeft
+		}
+		if p.FontRight == "" {
+			p.FontRight = b.FontRight
+		}
+		if !validStudyFont(p.FontLeft) || !validStudyFont(p.FontRight) {
+			add("passages[%d]: font_left and font_right must be serif or sans", i)
+		}
+	}
+
+	questionIDs := make(map[string]bool, len(b.QuizQuestions))
+	for i, q := range b.QuizQuestions {
+		if q.QuestionID == "" || q.Prompt == "" {
+			add("quiz_questions[%d]: question_id and prompt are required", i)
+		}
+		if questionIDs[q.QuestionID] {
+			add("quiz_questions[%d]: duplicate question_id %q", i, q.QuestionID)
+		}
+		questionIDs[q.QuestionID] = true
+		if len(q.Choices) < 2 {
+			add("quiz_questions[%d]: at least two choices are required", i)
+		}
+		for j, choice := range q.Choices {
+			if choice == "" {
+				add("quiz_questions[%d]: choices[%d] is empty", i, j)
+			}
+		}
+		if q.Answer < 0 || q.Answer >= len(q.Choices) {
+			add("quiz_questions[%d]: answer must be the index of one of the choices", i)
+		}
+	}
+
+	formVersions := make(map[string]bool, len(b.ConsentForms))
+	activeForms := 0
+	for i, f := range b.ConsentForms {
+		if f.Version == "" || f.Content == "" {
+			add("consent_forms[%d]: version and content are required", i)
+		}
+		if formVersions[f.Version] {
+			add("consent_forms[%d]: duplicate version %q", i, f.Version)
+		}
+		formVersions[f.Version] = true
+		if msg := validateConsentItems(f.Items); msg != "" {
+			add("consent_forms[%d]: %s", i, msg)
+		}
+		if f.Active {
+			activeForms++
+		}
+	}
+	if activeForms > 1 {
+		add("at most one consent form can be active")
+	}
+
+	for i, r := range b.ExclusionRules {
+		rule := ExclusionRule{Field: r.Field, Operator: r.Operator, Threshold: r.Threshold}
+		if msg := validateExclusionCondition(rule); msg != "" {
+			add("exclusion_rules[%d]: %s", i, msg)
+		}
+	}
+	return problems
+}
+
+// importStudyBundle creates the study text of a validated bundle with its
+// passages, quiz questions, consent forms and exclusion rules. It must run
+// in a transaction.
+func importStudyBundle(tx *gorm.DB, b studyBundle) (StudyText, error) {
+	studyText := StudyText{
+		Version:        b.Version,
+		Content:        b.Content,
+		FontLeft:       b.FontLeft,
+		FontRight:      b.FontRight,
+		Active:         b.Active,
+		CompletionCode: b.CompletionCode,
+	}
+	if b.Active {
+		if err := tx.Model(&StudyText{}).Where("active = ?", true).Update("active", false).Error; err != nil {
+			return studyText, err
+		}
+	}
+	if err := tx.Omit("QuizQuestions", "Passages").Create(&studyText).Error; err != nil {
+		return studyText, err
+	}
+	// Create stores the column default (true) for Active=false
+	if !b.Active {
+		if err := tx.Model(&studyText).Update("active", false).Error; err != nil {
+			return studyText, err
+		}
+	}
+
+	for i, p := range b.Passages {
+		passage := Passage{
+			StudyTextID: studyText.ID,
+			Order:       i,
+			Title:       p.Title,
+			Content:     p.Content,
+			FontLeft:    p.FontLeft,
+			FontRight:   p.FontRight,
+		}
+		if err := tx.Omit("StudyText").Create(&passage).Error; err != nil {
+			return studyText, err
+		}
+	}
+
+	for i, q := range b.QuizQuestions {
+		choicesJSON, err := json.Marshal(q.Choices)
+		if err != nil {
+			return studyText, err
+		}
+		question := QuizQuestion{
+			StudyTextID: studyText.ID,
+			QuestionID:  q.QuestionID,
+			Prompt:      q.Prompt,
+			Choices:     string(choicesJSON),
+			Answer:      q.Answer,
+			Order:       i,
+		}
+		if err := tx.Omit("StudyText").Create(&question).Error; err != nil {
+			return studyText, err
+		}
+	}
+
+	for _, f := range b.ConsentForms {
+		items := f.Items
+		if items == nil {
+			items = []consentItem{}
+		}
+		itemsJSON, err := json.Marshal(items)
+		if err != nil {
+			return studyText, err
+		}
+		form := ConsentForm{
+			StudyTextID: studyText.ID,
+			Version:     f.Version,
+			Content:     f.Content,
+			Items:       string(itemsJSON),
+			Active:      f.Active,
+		}
+		if err := tx.Create(&form).Error; err != nil {
+			return studyText, err
+		}
+	}
+
+	for _, r := range b.ExclusionRules {
+		rule := ExclusionRule{
+			StudyTextID: studyText.ID,
+			Field:       r.Field,
+			Operator:    r.Operator,
+			Threshold:   r.Threshold,
+			Description: r.Description,
+		}
+		if err := tx.Create(&rule).Error; err != nil {
+			return studyText, err
+		}
+	}
+	return studyText, nil
+}
+
+// exportStudyBundle builds the bundle of a study text
+func exportStudyBundle(db *gorm.DB, studyText StudyText) (studyBundle, error) {
+	b := studyBundle{
+		Format:         studyBundleFormat,
+		Version:        studyText.Version,
+		Content:        studyText.Content,
+		FontLeft:       studyText.FontLeft,
+		FontRight:      studyText.FontRight,
+		Active:         studyText.Active,
+		CompletionCode: studyText.CompletionCode,
+		Passages:       []studyBundlePassage{},
+		QuizQuestions:  []studyBundleQuizQuestion{},
+		ConsentForms:   []studyBundleConsentForm{},
+		ExclusionRules: []studyBundleExclusionRule{},
+	}
+
+	var passages []Passage
+	if err := db.Where("study_text_id = ?", studyText.ID).Order("\"order\" ASC, id ASC").Find(&passages).Error; err != nil {
+		return b, err
+	}
+	for _, p := range passages {
+		b.Passages = append(b.Passages, studyBundlePassage{
+			Title:     p.Title,
+			Content:   p.Content,
+			FontLeft:  p.FontLeft,
+			FontRight: p.FontRight,
+		})
+	}
+
+	var questions []QuizQuestion
+	if err := db.Where("study_text_id = ?", studyText.ID).Order("\"order\" ASC, id ASC").Find(&questions).Error; err != nil {
+		return b, err
+	}
+	for _, q := range questions {
+		var choices []string
+		if err := json.Unmarshal([]byte(q.Choices), &choices); err != nil {
+			return b, fmt.Errorf("quiz question %s has invalid choices: %w", q.QuestionID, err)
+		}
+		b.QuizQuestions = append(b.QuizQuestions, studyBundleQuizQuestion{
+			QuestionID: q.QuestionID,
+			Prompt:     q.Prompt,
+			Choices:    choices,
+			Answer:     q.Answer,
+		})
+	}
+
+	var forms []ConsentForm
+	if err := db.Where("study_text_id = ?", studyText.ID).Order("id ASC").Find(&forms).Error; err != nil {
+		return b, err
+	}
+	for _, f := range forms {
+		b.ConsentForms = append(b.ConsentForms, studyBundleConsentForm{
+			Version: f.Version,
+			Content: f.Content,
+			Items:   f.items(),
+			Active:  f.Active,
+		})
+	}
+
+	var rules []ExclusionRule
+	if err := db.Where("study_text_id = ?", studyText.ID).Order("id ASC").Find(&rules).Error; err != nil {
+		return b, err
+	}
+	for _, r := range rules {
+		b.ExclusionRules = append(b.ExclusionRules, studyBundleExclusionRule{
+			Field:       r.Field,
+			Operator:    r.Operator,
+			Threshold:   r.Threshold,
+			Description: r.Description,
+		})
+	}
+	return b, nil
+}
+
+// isYAMLContentType reports whether a Content-Type names YAML
+func isYAMLContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "application/yaml" || mediaType == "application/x-yaml" || mediaType == "text/yaml"
+}
+
+// decodeStudyBundle parses a JSON or YAML bundle, rejecting unknown fields
+// so that misspelt settings are not silently dropped
+func decodeStudyBundle(body []byte, isYAML bool) (studyBundle, error) {
+	var b studyBundle
+	if isYAML {
+		decoder := yaml.NewDecoder(bytes.NewReader(body))
+		decoder.KnownFields(true)
+		err := decoder.Decode(&b)
+		return b, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&b)
+	return b, err
+}
+
+// handleAdminImportStudyBundle creates a study text from a JSON or YAML
+// bundle (Content-Type application/yaml) in one transaction. With
+// dry_run=true the import is run and rolled back, reporting what it would
+// create or why it would fail.
+func handleAdminImportStudyBundle(c *gin.Context) {
+	db := dbFrom(c)
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Failed to read body: " + err.Error()})
+		return
+	}
+	bundle, err := decodeStudyBundle(body, isYAMLContentType(c.ContentType()))
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Invalid bundle: " + err.Error()})
+		return
+	}
+	if problems := bundle.validate(); len(problems) > 0 {
+		c.JSON(400, gin.H{"error": "Invalid bundle: " + strings.Join(problems, "; ")})
+		return
+	}
+	dryRun := c.Query("dry_run") == "true"
+
+	var studyText StudyText
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&StudyText{}).Where("version = ?", bundle.Version).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return gorm.ErrDuplicatedKey
+		}
+		created, err := importStudyBundle(tx, bundle)
+		if err != nil {
+			return err
+		}
+		studyText = created
+		if dryRun {
+			return errStudyBundleDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		c.JSON(409, gin.H{"error": fmt.Sprintf("Study text with version '%s' already exists", bundle.Version)})
+		return
+	}
+	if err != nil && !errors.Is(err, errStudyBundleDryRun) {
+		c.JSON(500, gin.H{"error": "Failed to import study text: " + err.Error()})
+		return
+	}
+
+	summary := studyBundleSummary{
+		Version:        bundle.Version,
+		Passages:       len(bundle.Passages),
+		QuizQuestions:  len(bundle.QuizQuestions),
+		ConsentForms:   len(bundle.ConsentForms),
+		ExclusionRules: len(bundle.ExclusionRules),
+	}
+	if dryRun {
+		c.JSON(200, gin.H{
+			"success": true,
+			"dry_run": true,
+			"data":    summary,
+		})
+		return
+	}
+	c.JSON(201, gin.H{
+		"success": true,
+		"id":      studyText.ID,
+		"data":    summary,
+		"message": "Study text imported successfully",
+	})
+}
+
+// handleAdminExportStudyBundle downloads a study text as a bundle that
+// import recreates it from, as JSON or (with format=yaml) YAML
+func handleAdminExportStudyBundle(c *gin.Context) {
+	db := dbFrom(c)
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "yaml" {
+		c.JSON(400, gin.H{"error": "format must be json or yaml"})
+		return
+	}
+
+	var studyText StudyText
+	if err := db.First(&studyText, c.Param("id")).Error; err != nil {
+		c.JSON(404, gin.H{"error": "Study text not found"})
+		return
+	}
+	bundle, err := exportStudyBundle(db, studyText)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to export study text: " + err.Error()})
+		return
+	}
+
+	var out []byte
+	contentType := "application/json; charset=utf-8"
+	if format == "yaml" {
+		out, err = yaml.Marshal(bundle)
+		contentType = "application/yaml; charset=utf-8"
+	} else {
+		out, err = json.MarshalIndent(bundle, "", "  ")
+		out = append(out, '\n')
+	}
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to encode bundle: " + err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("study-text-%s.%s", studyText.Version, format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(200, contentType, out)
+}
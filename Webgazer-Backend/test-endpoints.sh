@@ -1,7 +1,9 @@
 #!/bin/bash
 
 # Test script for individual API endpoints
+# Admin endpoints need a token: ADMIN_TOKEN=<editor token> ./test-endpoints.sh
 BASE_URL="http://localhost:8080"
+ADMIN_TOKEN="${ADMIN_TOKEN:-}"
 
 echo "🧪 Testing Readability Backend API Endpoints"
 echo "=============================================="
@@ -35,9 +37,12 @@ test_endpoint() {
     echo "  Endpoint: ${method} ${endpoint}"
     
     if [ "$method" = "GET" ]; then
-        response=$(curl -s -w "\n%{http_code}" "${BASE_URL}${endpoint}")
+        response=$(curl -s -w "\n%{http_code}" \
+            -H "Authorization: Bearer ${ADMIN_TOKEN}" \
+            "${BASE_URL}${endpoint}")
     else
         response=$(curl -s -w "\n%{http_code}" -X "${method}" \
+            -H "Authorization: Bearer ${ADMIN_TOKEN}" \
             -H "Content-Type: application/json" \
             -d "${data}" \
             "${BASE_URL}${endpoint}")
@@ -111,6 +116,7 @@ SESSION_RESPONSE=$(curl -s -X POST \
     -d "$SESSION_DATA" \
     "${BASE_URL}/api/session")
 SESSION_ID=$(echo "$SESSION_RESPONSE" | jq -r '.id' 2>/dev/null)
+SESSION_UID=$(echo "$SESSION_RESPONSE" | jq -r '.session_id' 2>/dev/null)
 test_endpoint "Create Study Session" "POST" "/api/session" "$SESSION_DATA"
 
 if [ -z "$SESSION_ID" ] || [ "$SESSION_ID" = "null" ]; then
@@ -122,7 +128,7 @@ echo ""
 
 # Test 6: Submit Quiz Response
 QUIZ_RESPONSE_DATA="{
-    \"session_id\": $SESSION_ID,
+    \"session_id\": \"$SESSION_UID\",
     \"question_id\": \"q1\",
     \"answer_index\": 1,
     \"is_correct\": true,
@@ -213,6 +219,7 @@ ADMIN_PASSAGE_DATA="{
     \"font_right\": \"sans\"
 }"
 PASSAGE_RESPONSE=$(curl -s -X POST \
+    -H "Authorization: Bearer ${ADMIN_TOKEN}" \
     -H "Content-Type: application/json" \
     -d "$ADMIN_PASSAGE_DATA" \
     "${BASE_URL}/api/admin/passage")
@@ -251,6 +258,7 @@ ADMIN_PASSAGE_DELETE_DATA="{
     \"font_right\": \"sans\"
 }"
 DELETE_PASSAGE_RESPONSE=$(curl -s -X POST \
+    -H "Authorization: Bearer ${ADMIN_TOKEN}" \
     -H "Content-Type: application/json" \
     -d "$ADMIN_PASSAGE_DELETE_DATA" \
     "${BASE_URL}/api/admin/passage")
@@ -48,6 +48,7 @@ SESSION_RESPONSE=$(curl -s -X POST "$BASE_URL/api/session" \
   }")
 echo "$SESSION_RESPONSE" | jq .
 SESSION_ID=$(echo "$SESSION_RESPONSE" | jq -r '.id')
+SESSION_UID=$(echo "$SESSION_RESPONSE" | jq -r '.session_id')
 echo "Session ID: $SESSION_ID"
 echo ""
 echo ""
@@ -84,7 +85,7 @@ echo "6. Adding Quiz Response..."
 curl -s -X POST "$BASE_URL/api/quiz-response" \
   -H "Content-Type: application/json" \
   -d "{
-    \"session_id\": $SESSION_ID,
+    \"session_id\": \"$SESSION_UID\",
     \"question_id\": \"q1\",
     \"answer_index\": 1,
     \"is_correct\": true,
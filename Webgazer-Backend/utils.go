@@ -2,9 +2,13 @@ package main
 
 import (
 	"crypto/rand"
+	"encoding/csv"
 	"encoding/hex"
 	"fmt"
+	"strconv"
 	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
 func generateSessionID() string {
@@ -16,3 +20,78 @@ func generateSessionID() string {
 	return hex.EncodeToString(bytes)
 }
 
+// writeCSV sends a CSV file download with the given header and records
+func writeCSV(c *gin.Context, filename string, header []string, records [][]string) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(200)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(header)
+	w.WriteAll(records)
+}
+
+func formatUint(v uint) string {
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+// formatOptionalInt formats v, or returns an empty cell for nil
+func formatOptionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func msDuration(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// formatOptionalFloat formats v, or returns an empty cell for nil
+func formatOptionalFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return formatFloat(*v)
+}
+
+// formatOptionalUint formats v, or returns an empty cell for nil
+func formatOptionalUint(v *uint) string {
+	if v == nil {
+		return ""
+	}
+	return formatUint(*v)
+}
+
+// formatOptionalBool formats v, or returns an empty cell for nil
+func formatOptionalBool(v *bool) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatBool(*v)
+}
+
+// formatTime formats t as an ISO-8601 (RFC 3339) UTC timestamp, or returns
+// an empty cell for the zero time
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// formatOptionalTime formats t like formatTime, or returns an empty cell for nil
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatTime(*t)
+}
@@ -2,6 +2,8 @@
  * API client for Readability Study Backend
  */
 
+import type { LayoutAOI } from './layout';
+
 const API_BASE_URL = import.meta.env.VITE_API_URL || 'http://localhost:8080';
 
 export interface Passage {
@@ -27,12 +29,12 @@ export interface QuizQuestionResponse {
 	id: string;
 	prompt: string;
 	choices: string[];
-	answer: number;
 }
 
 export interface StudySessionData {
 	participant_id?: number;
 	session_id?: string;
+	status?: string;
 	calibration_points?: number;
 	font_left?: string;
 	font_right?: string;
@@ -48,19 +50,51 @@ export interface StudySessionData {
 	screen_height?: number;
 }
 
+export interface PassageAssignment {
+	passage_id: number;
+	order: number;
+	font_left: string;
+	font_right: string;
+}
+
+export interface SessionAssignment {
+	study_text_id: number;
+	condition_cell: number;
+	font_left: string;
+	font_right: string;
+	passages: PassageAssignment[];
+}
+
 export interface QuizResponseData {
-	session_id: number;
+	session_id: string; // The session's random session_id, not its numeric id
 	question_id: string;
 	answer_index: number;
-	is_correct?: boolean;
 	response_time?: number;
 }
 
+export interface PlatformCompletion {
+	platform: string;
+	code: string;
+	redirect_url?: string;
+}
+
 export interface ApiResponse {
 	success: boolean;
 	session_id?: string;
 	id?: number;
 	error?: string;
+	completion?: PlatformCompletion;
+	assignment?: SessionAssignment;
+}
+
+/**
+ * Remember the URL the participant arrived on, which carries the Prolific or
+ * MTurk IDs when they were recruited on a platform
+ */
+export function recordEntryUrl(): void {
+	if (!sessionStorage.getItem('entry_url')) {
+		sessionStorage.setItem('entry_url', window.location.href);
+	}
 }
 
 /**
@@ -79,7 +113,10 @@ export async function createParticipant(source: string = 'web'): Promise<number>
 			headers: {
 				'Content-Type': 'application/json'
 			},
-			body: JSON.stringify({ source })
+			body: JSON.stringify({
+				source,
+				entry_url: sessionStorage.getItem('entry_url') || window.location.href
+			})
 		});
 
 		if (!response.ok) {
@@ -91,6 +128,10 @@ export async function createParticipant(source: string = 'web'): Promise<number>
 
 		// Store in sessionStorage for reuse
 		sessionStorage.setItem('participant_id', String(participantId));
+		// Needed to withdraw later; a returning participant's earlier token is replaced
+		if (data.withdrawal_token) {
+			sessionStorage.setItem('withdrawal_token', data.withdrawal_token);
+		}
 
 		return participantId;
 	} catch (error) {
@@ -156,6 +197,96 @@ export async function submitStudySession(data: StudySessionData): Promise<ApiRes
 	}
 }
 
+/**
+ * Start the participant's session. The backend assigns the counterbalanced
+ * passage order and fonts, which are kept for the reading page.
+ */
+export async function startSession(): Promise<ApiResponse> {
+	try {
+		const participantId = await createParticipant();
+		const response = await fetch(`${API_BASE_URL}/api/session/start`, {
+			method: 'POST',
+			headers: {
+				'Content-Type': 'application/json'
+			},
+			body: JSON.stringify({
+				participant_id: participantId,
+				user_agent: navigator.userAgent,
+				screen_width: window.screen.width,
+				screen_height: window.screen.height
+			})
+		});
+
+		const result = await response.json();
+		if (!response.ok) {
+			throw new Error(result.error || `Failed to start session: ${response.statusText}`);
+		}
+
+		sessionStorage.setItem('session_id', result.session_id);
+		sessionStorage.setItem('session_db_id', String(result.id));
+		sessionStorage.setItem('session_assignment', JSON.stringify(result.assignment));
+		return result;
+	} catch (error) {
+		console.error('Error starting session:', error);
+		return {
+			success: false,
+			error: error instanceof Error ? error.message : 'Unknown error'
+		};
+	}
+}
+
+/**
+ * The passage order and fonts assigned when the session started, if any
+ */
+export function getSessionAssignment(): SessionAssignment | null {
+	const assignment = sessionStorage.getItem('session_assignment');
+	return assignment ? JSON.parse(assignment) : null;
+}
+
+/**
+ * Update the started session, e.g. to move it to the next phase of the
+ * study. Does nothing if no session was started.
+ */
+export async function updateSession(
+	data: Omit<StudySessionData, 'participant_id' | 'session_id' | 'font_left' | 'font_right'>
+): Promise<ApiResponse> {
+	// Sessions are updated by their random session_id, not the numeric id
+	const sessionUid = sessionStorage.getItem('session_id');
+	if (!sessionUid) {
+		return { success: false, error: 'No session has been started' };
+	}
+
+	try {
+		const response = await fetch(`${API_BASE_URL}/api/session/${encodeURIComponent(sessionUid)}`, {
+			method: 'PATCH',
+			headers: {
+				'Content-Type': 'application/json'
+			},
+			body: JSON.stringify(data)
+		});
+
+		const result = await response.json();
+		if (!response.ok) {
+			throw new Error(result.error || `Failed to update session: ${response.statusText}`);
+		}
+
+		// Participants recruited on a platform submit a completion code there
+		if (result.completion) {
+			sessionStorage.setItem('completion_code', result.completion.code);
+			if (result.completion.redirect_url) {
+				sessionStorage.setItem('completion_redirect_url', result.completion.redirect_url);
+			}
+		}
+		return result;
+	} catch (error) {
+		console.error('Error updating session:', error);
+		return {
+			success: false,
+			error: error instanceof Error ? error.message : 'Unknown error'
+		};
+	}
+}
+
 /**
  * Submit individual quiz responses
  */
@@ -233,6 +364,94 @@ export async function submitAccuracyMeasurement(data: {
 	}
 }
 
+export interface ValidationTarget {
+	x: number;
+	y: number;
+	samples: { x: number; y: number; timestamp: string }[];
+}
+
+export interface ValidationResult {
+	passed: boolean;
+	accuracy: number;
+	mean_error_deg: number;
+}
+
+/**
+ * Submit the raw gaze samples recorded while the participant looked at the
+ * validation targets. The backend computes the accuracy and whether it
+ * passes. Returns null if no session was started or the request failed.
+ */
+export async function submitValidation(data: {
+	screen_width: number;
+	screen_height: number;
+	targets: ValidationTarget[];
+}): Promise<ValidationResult | null> {
+	const sessionUid = sessionStorage.getItem('session_id');
+	if (!sessionUid) {
+		return null;
+	}
+
+	try {
+		const response = await fetch(`${API_BASE_URL}/api/sessions/${encodeURIComponent(sessionUid)}/validation`, {
+			method: 'POST',
+			headers: {
+				'Content-Type': 'application/json'
+			},
+			body: JSON.stringify(data)
+		});
+
+		const result = await response.json();
+		if (!response.ok) {
+			throw new Error(result.error || `Failed to submit validation: ${response.statusText}`);
+		}
+
+		return {
+			passed: result.passed,
+			accuracy: result.data.accuracy,
+			mean_error_deg: result.data.mean_error_deg
+		};
+	} catch (error) {
+		console.error('Error submitting validation:', error);
+		return null;
+	}
+}
+
+/**
+ * Submit the rendered bounding boxes of a passage on one panel, so the
+ * backend can map gaze samples to words and lines. Does nothing if no
+ * session was started.
+ */
+export async function submitSessionLayout(data: {
+	passage_id: number;
+	panel: string;
+	aois: LayoutAOI[];
+}): Promise<boolean> {
+	const sessionUid = sessionStorage.getItem('session_id');
+	if (!sessionUid) {
+		return false;
+	}
+
+	try {
+		const response = await fetch(`${API_BASE_URL}/api/sessions/${encodeURIComponent(sessionUid)}/layout`, {
+			method: 'POST',
+			headers: {
+				'Content-Type': 'application/json'
+			},
+			body: JSON.stringify(data)
+		});
+
+		if (!response.ok) {
+			const errorText = await response.text();
+			console.error(`Failed to submit layout: ${response.status} ${errorText}`);
+			return false;
+		}
+		return true;
+	} catch (error) {
+		console.error('Error submitting layout:', error);
+		return false;
+	}
+}
+
 /**
  * Submit gaze point
  */
@@ -242,6 +461,7 @@ export async function submitGazePoint(data: {
 	y: number;
 	panel?: string;
 	phase?: string;
+	passage_id?: number;
 }): Promise<boolean> {
 	try {
 		const response = await fetch(`${API_BASE_URL}/api/gaze-point`, {
@@ -259,6 +479,47 @@ export async function submitGazePoint(data: {
 	}
 }
 
+export interface GazeSample {
+	x: number;
+	y: number;
+	panel?: string;
+	phase?: string;
+	passage_id?: number;
+	timestamp: string; // ISO 8601 time the sample was taken
+}
+
+/**
+ * Submit buffered gaze samples of the started session in one request.
+ * Returns the number of samples the backend stored, or null if the request
+ * failed in a way worth retrying (network or server error).
+ */
+export async function submitGazePointBatch(points: GazeSample[]): Promise<number | null> {
+	const sessionUid = sessionStorage.getItem('session_id');
+	if (!sessionUid) {
+		return 0;
+	}
+
+	try {
+		const response = await fetch(`${API_BASE_URL}/api/gaze-points/batch`, {
+			method: 'POST',
+			headers: {
+				'Content-Type': 'application/json'
+			},
+			body: JSON.stringify({ session_id: sessionUid, points })
+		});
+
+		const result = await response.json().catch(() => ({}));
+		if (!response.ok) {
+			console.error(`Failed to submit gaze points: ${response.status}`, result.error);
+			return response.status >= 500 ? null : 0;
+		}
+		return result.accepted ?? points.length;
+	} catch (error) {
+		console.error('Error submitting gaze points:', error);
+		return null;
+	}
+}
+
 /**
  * Submit reading event
  */
@@ -328,6 +589,131 @@ export async function fetchQuizQuestions(studyTextId?: number): Promise<QuizQues
 	}
 }
 
+export interface ConsentItem {
+	id: string;
+	text: string;
+	required: boolean;
+}
+
+export interface ConsentForm {
+	id: number;
+	study_text_id: number;
+	version: string;
+	content: string;
+	items: ConsentItem[];
+}
+
+/**
+ * Fetch the consent form of the active study text, or null if it has none
+ */
+export async function fetchConsentForm(): Promise<ConsentForm | null> {
+	try {
+		const response = await fetch(`${API_BASE_URL}/api/consent-form`);
+		if (response.status === 404) {
+			return null;
+		}
+		if (!response.ok) {
+			throw new Error(`Failed to fetch consent form: ${response.statusText}`);
+		}
+
+		const result = await response.json();
+		return result.data;
+	} catch (error) {
+		console.error('Error fetching consent form:', error);
+		return null;
+	}
+}
+
+/**
+ * Record the participant's answer to a consent form. Returns whether the
+ * backend accepted it as consent to take part.
+ */
+export async function submitConsent(
+	consentFormId: number,
+	agree: boolean,
+	choices: Record<string, boolean>
+): Promise<boolean> {
+	try {
+		const participantId = await createParticipant();
+		const response = await fetch(`${API_BASE_URL}/api/consent`, {
+			method: 'POST',
+			headers: {
+				'Content-Type': 'application/json'
+			},
+			body: JSON.stringify({
+				participant_id: participantId,
+				consent_form_id: consentFormId,
+				agree,
+				choices,
+				user_agent: navigator.userAgent
+			})
+		});
+
+		if (!response.ok) {
+			throw new Error(`Failed to submit consent: ${response.statusText}`);
+		}
+
+		const result = await response.json();
+		return result.consented === true;
+	} catch (error) {
+		console.error('Error submitting consent:', error);
+		return false;
+	}
+}
+
+/**
+ * Withdraw the participant from the study, deleting all their data
+ */
+export async function withdrawParticipant(participantId: number, withdrawalToken: string): Promise<boolean> {
+	try {
+		const response = await fetch(`${API_BASE_URL}/api/participant/withdraw`, {
+			method: 'POST',
+			headers: {
+				'Content-Type': 'application/json'
+			},
+			body: JSON.stringify({
+				participant_id: participantId,
+				withdrawal_token: withdrawalToken
+			})
+		});
+
+		if (!response.ok) {
+			throw new Error(`Failed to withdraw: ${response.statusText}`);
+		}
+
+		sessionStorage.removeItem('participant_id');
+		sessionStorage.removeItem('withdrawal_token');
+		return true;
+	} catch (error) {
+		console.error('Error withdrawing participant:', error);
+		return false;
+	}
+}
+
+/**
+ * Submit each quiz answer to the quiz_responses table, where the backend
+ * scores them. Returns once all were sent, whether or not some failed.
+ */
+async function submitQuizAnswers(sessionUid: string, quizAnswers: Record<string, number>): Promise<void> {
+	const quizSubmissionPromises = [];
+	for (const [questionId, answerIndex] of Object.entries(quizAnswers)) {
+		quizSubmissionPromises.push(
+			submitQuizResponse({
+				session_id: sessionUid,
+				question_id: questionId,
+				answer_index: answerIndex
+			}).catch((error) => {
+				console.error(`Failed to submit quiz response for ${questionId}:`, error);
+				return false;
+			})
+		);
+	}
+
+	const results = await Promise.all(quizSubmissionPromises);
+	const successCount = results.filter((r) => r === true).length;
+	console.log(`Submitted ${successCount}/${quizSubmissionPromises.length} quiz responses individually`);
+}
+
 /**
  * Collect all session data from sessionStorage and submit
  */
@@ -355,45 +741,29 @@ export async function submitCompleteSession(quizAnswers: Record<string, number>)
 		}));
 		sessionData.quiz_responses_json = JSON.stringify(quizResponses);
 
-		// Submit to backend
-		const result = await submitStudySession(sessionData);
-
-		if (result.success && result.id) {
-			// Also submit individual quiz responses to the quiz_responses table
-			const sessionDbId = result.id;
-
-			// Fetch quiz questions from API to get correct answers
-			const studyTextId = sessionStorage.getItem('study_text_id');
-			const quizQuestions = await fetchQuizQuestions(
-				studyTextId ? parseInt(studyTextId, 10) : undefined
-			);
-
-			// Submit each quiz response individually
-			const quizSubmissionPromises = [];
-			for (const [questionId, answerIndex] of Object.entries(quizAnswers)) {
-				const question = quizQuestions.find((q) => q.id === questionId);
-				const isCorrect = question ? answerIndex === question.answer : undefined;
-
-				quizSubmissionPromises.push(
-					submitQuizResponse({
-						session_id: sessionDbId,
-						question_id: questionId,
-						answer_index: answerIndex,
-						is_correct: isCorrect
-					}).catch((error) => {
-						console.error(`Failed to submit quiz response for ${questionId}:`, error);
-						return false;
-					})
-				);
-			}
-
-			// Wait for all quiz responses to be submitted (but don't fail if some fail)
-			const results = await Promise.all(quizSubmissionPromises);
-			const successCount = results.filter((r) => r === true).length;
-			console.log(
-				`Submitted ${successCount}/${quizSubmissionPromises.length} quiz responses individually`
-			);
+		// Complete the session started on the first page, once its answers are in
+		const startedUid = sessionStorage.getItem('session_id');
+		if (startedUid) {
+			await submitQuizAnswers(startedUid, quizAnswers);
+			const result = await updateSession({
+				status: 'completed',
+				calibration_points: sessionData.calibration_points,
+				time_left_ms: sessionData.time_left_ms,
+				time_right_ms: sessionData.time_right_ms,
+				time_a_ms: sessionData.time_a_ms,
+				time_b_ms: sessionData.time_b_ms,
+				font_preference: sessionData.font_preference,
+				preferred_font_type: sessionData.preferred_font_type,
+				quiz_responses_json: sessionData.quiz_responses_json
+			});
+			return result.success;
+		}
 
+		// No session was started: save the data in a new session. It is not
+		// completed, as its phases were not recorded, so no completion code is issued.
+		const result = await submitStudySession(sessionData);
+		if (result.success && result.session_id) {
+			await submitQuizAnswers(result.session_id, quizAnswers);
 			return true;
 		}
 
@@ -0,0 +1,76 @@
+// Bounding boxes of a rendered passage, sent to the backend so gaze samples
+// can be mapped to the words and lines the participant was looking at.
+// Coordinates are viewport pixels, the same space WebGazer predicts in.
+
+export interface LayoutAOI {
+	kind: 'word' | 'line' | 'panel';
+	index: number;
+	line: number;
+	text?: string;
+	x: number;
+	y: number;
+	width: number;
+	height: number;
+}
+
+function box(rect: DOMRect) {
+	return { x: rect.left, y: rect.top, width: rect.width, height: rect.height };
+}
+
+/**
+ * Measure the panel, lines and words of the text rendered inside textElement.
+ * Words are grouped into lines by their vertical position.
+ */
+export function measureTextLayout(
+	panelElement: HTMLElement,
+	textElement: HTMLElement
+): LayoutAOI[] {
+	const aois: LayoutAOI[] = [
+		{ kind: 'panel', index: 0, line: 0, ...box(panelElement.getBoundingClientRect()) }
+	];
+
+	const words: LayoutAOI[] = [];
+	const lines: LayoutAOI[] = [];
+	const lineTexts: string[][] = [];
+	const walker = document.createTreeWalker(textElement, NodeFilter.SHOW_TEXT);
+	const range = document.createRange();
+	for (let node = walker.nextNode(); node; node = walker.nextNode()) {
+		const content = node.textContent ?? '';
+		for (const match of content.matchAll(/\S+/g)) {
+			range.setStart(node, match.index!);
+			range.setEnd(node, match.index! + match[0].length);
+			const rect = range.getBoundingClientRect();
+			if (rect.width === 0 || rect.height === 0) {
+				continue;
+			}
+
+			// A word starts a new line when it is below the middle of the current line
+			let current = lines[lines.length - 1];
+			if (!current || rect.top > current.y + current.height / 2) {
+				current = { kind: 'line', index: lines.length, line: lines.length, ...box(rect) };
+				lines.push(current);
+				lineTexts.push([]);
+			} else {
+				const right = Math.max(current.x + current.width, rect.right);
+				const bottom = Math.max(current.y + current.height, rect.bottom);
+				current.x = Math.min(current.x, rect.left);
+				current.y = Math.min(current.y, rect.top);
+				current.width = right - current.x;
+				current.height = bottom - current.y;
+			}
+			lineTexts[current.line].push(match[0]);
+
+			words.push({
+				kind: 'word',
+				index: words.length,
+				line: current.line,
+				text: match[0],
+				...box(rect)
+			});
+		}
+	}
+	range.detach();
+
+	lines.forEach((line, i) => (line.text = lineTexts[i].join(' ')));
+	return [...aois, ...lines, ...words];
+}